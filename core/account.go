@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"storjnet/utils"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/rs/zerolog/log"
+)
+
+const PasswordResetTokenLifetime = time.Hour
+const PasswordResetResendInterval = time.Minute
+
+var ErrPasswordResetTooFrequent = merry.New("password_reset_too_frequent")
+var ErrPasswordResetNotFound = merry.New("password_reset_not_found")
+
+func hashPasswordResetToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// setUserPassword updates password and logs out all user sessions.
+func setUserPassword(tx *pg.Tx, user *User, password string) error {
+	_, err := tx.QueryOne(user, `
+		UPDATE users SET password_hash = crypt(?, gen_salt('bf'))
+		WHERE id = ? RETURNING *`,
+		password, user.ID)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	return merry.Wrap(DelOtherUserSessions(tx, user, nil))
+}
+
+// CheckUserCredentials checks password and (if 2FA is enabled) TOTP or recovery code of already logged in user.
+// Required for account changes, so a stolen session alone is not enough for them.
+func CheckUserCredentials(db *pg.DB, user *User, password, totpCode string) error {
+	if _, err := FindUserByUsernameAndPassword(db, user.Username, password); err != nil {
+		return merry.Wrap(err)
+	}
+	if user.HasTOTP() {
+		return merry.Wrap(CheckUserTOTPCode(db, user, totpCode))
+	}
+	return nil
+}
+
+// ChangeUserPassword sets new password if the old one (and 2FA code if enabled) is correct
+// (ErrUserNotFound/ErrTOTPRequired/ErrWrongTOTPCode otherwise).
+// Other sessions are logged out, the current client gets a new session.
+func ChangeUserPassword(db *pg.DB, wr http.ResponseWriter, r *http.Request, user *User, oldPassword, totpCode, newPassword string) error {
+	if err := CheckUserCredentials(db, user, oldPassword, totpCode); err != nil {
+		return merry.Wrap(err)
+	}
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if err := setUserPassword(tx, user, newPassword); err != nil {
+			return merry.Wrap(err)
+		}
+		_, err := StartUserSession(tx, wr, r, user)
+		return merry.Wrap(err)
+	}))
+}
+
+// StartPasswordReset sends a password reset link (to siteURL) to the (verified) email of the user found by username or email.
+// Returns ErrUserNotFound if there is no such user or the user has no email.
+func StartPasswordReset(db *pg.DB, mailer utils.Mailer, siteURL, login, lang string) error {
+	user := &User{}
+	err := db.Model(user).Where("(username = ? OR email = ?) AND email IS NOT NULL AND NOT is_org", login, login).First()
+	if err == pg.ErrNoRows {
+		return ErrUserNotFound.Here()
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+
+	token := utils.RandHexString(40)
+	tokenHash := hashPasswordResetToken(token)
+	err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var lastCreatedAt time.Time
+		_, err := tx.QueryOne(pg.Scan(&lastCreatedAt), `
+			SELECT created_at FROM user_password_resets WHERE user_id = ? FOR UPDATE`, user.ID)
+		if err != nil && err != pg.ErrNoRows {
+			return merry.Wrap(err)
+		}
+		if time.Since(lastCreatedAt) < PasswordResetResendInterval {
+			return ErrPasswordResetTooFrequent.Here()
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_password_resets (user_id, token_hash) VALUES (?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET token_hash = EXCLUDED.token_hash, created_at = NOW()`,
+			user.ID, tokenHash)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return merry.Wrap(err)
+	}
+
+	// sending after commit: slow SMTP server should not hold the lock, and unsaved token should not be sent
+	link := strings.TrimRight(siteURL, "/") + "/password_reset#" + token
+	subject := loc(lang, "storjnet: password reset", "storjnet: сброс пароля")
+	text := loc(lang,
+		"To set a new password for "+user.Username+" on storjnet.info open this link within an hour:\n"+link+
+			"\n\nIf you did not request it, just ignore this email.",
+		"Чтобы задать новый пароль для "+user.Username+" на storjnet.info, откройте эту ссылку в течение часа:\n"+link+
+			"\n\nЕсли вы не запрашивали сброс, просто проигнорируйте это письмо.")
+	if err := mailer.Send(user.Email, subject, text); err != nil {
+		// token was not delivered, removing it so the user may retry without waiting
+		_, delErr := db.Exec(`DELETE FROM user_password_resets WHERE user_id = ? AND token_hash = ?`, user.ID, tokenHash)
+		if delErr != nil {
+			log.Error().Err(delErr).Int64("userID", user.ID).Msg("failed to remove undelivered password reset token")
+		}
+		return merry.Wrap(err)
+	}
+	return nil
+}
+
+// FinishPasswordReset sets new password of the user the token was sent to, and logs the user in
+// (unless 2FA is enabled: the email alone is not enough, so the user has to log in with a code).
+func FinishPasswordReset(db *pg.DB, wr http.ResponseWriter, r *http.Request, token, newPassword string) (*User, error) {
+	user := &User{}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.QueryOne(pg.Scan(&user.ID), `
+			DELETE FROM user_password_resets
+			WHERE token_hash = ? AND created_at > NOW() - ? * INTERVAL '1 second'
+			RETURNING user_id`,
+			hashPasswordResetToken(token), int64(PasswordResetTokenLifetime/time.Second))
+		if err == pg.ErrNoRows {
+			return ErrPasswordResetNotFound.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if err := setUserPassword(tx, user, newPassword); err != nil {
+			return merry.Wrap(err)
+		}
+		if user.HasTOTP() {
+			return nil
+		}
+		_, err = StartUserSession(tx, wr, r, user)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return user, nil
+}
+
+// accountTables are tables with user (or org) data, deleted along with the account.
+// Order matters: rows must be deleted before the rows they reference.
+var accountTables = []string{
+	"user_webhooks", //with deliveries
+	"user_node_events",
+	"user_alert_settings",
+	"user_email_verifications",
+	"user_password_resets",
+	"user_sessions",
+	"user_totp_recovery_codes",
+	"user_api_tokens",
+	"user_maintenance_windows",
+	"user_node_group_shares",
+	"user_node_groups", //with members
+	"user_nodes_sat_history",
+	"user_nodes_history",
+	"user_nodes",
+	"user_texts",
+}
+
+func deleteAccount(tx *pg.Tx, userID int64) error {
+	for _, table := range accountTables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	if _, err := tx.Exec(`UPDATE client_errors SET user_id = NULL WHERE user_id = ?`, userID); err != nil {
+		return merry.Wrap(err)
+	}
+	_, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	return merry.Wrap(err)
+}
+
+// DeleteUser deletes user with all nodes, history, texts and settings. Organizations
+// where the user is the only member are deleted too. Returns ErrLastOrgOwner if the user
+// is the only owner of an organization with other members (ownership must be passed first).
+func DeleteUser(db *pg.DB, user *User) error {
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var orgs []struct {
+			OrgID        int64
+			MembersCount int64
+			OwnersCount  int64
+			Role         string
+		}
+		_, err := tx.Query(&orgs, `
+			SELECT m.org_id, m.role,
+				(SELECT count(*) FROM org_members WHERE org_id = m.org_id) AS members_count,
+				(SELECT count(*) FROM org_members WHERE org_id = m.org_id AND role = ?) AS owners_count
+			FROM org_members AS m WHERE m.user_id = ?
+			FOR UPDATE`, OrgRoleOwner, user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		for _, org := range orgs {
+			if org.MembersCount == 1 {
+				if err := deleteAccount(tx, org.OrgID); err != nil {
+					return merry.Wrap(err)
+				}
+			} else if org.Role == OrgRoleOwner && org.OwnersCount == 1 {
+				return ErrLastOrgOwner.Here()
+			}
+		}
+		return merry.Wrap(deleteAccount(tx, user.ID))
+	}))
+}
@@ -0,0 +1,279 @@
+package core
+
+import (
+	"math/bits"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+// should match user_alert_settings defaults
+const (
+	DefaultAlertFailsCount  = 3
+	DefaultAlertDownMinutes = 0
+)
+
+var ErrTGLinkCodeNotFound = merry.New("tg_link_code_not_found")
+
+type UserNodeEventKind string
+
+const (
+	UserNodeEventDown            UserNodeEventKind = "down"
+	UserNodeEventUp              UserNodeEventKind = "up"
+	UserNodeEventFlapping        UserNodeEventKind = "flapping"
+	UserNodeEventFlappingStopped UserNodeEventKind = "flapping_stopped"
+)
+
+// Flapping detection: node starts flapping after FlapStartChanges up/down changes
+// within FlapWindowChecks last checks and stops when there are at most FlapStopChanges of them.
+const (
+	FlapWindowChecks = 21
+	FlapStartChanges = 6
+	FlapStopChanges  = 2
+)
+
+type UserAlertSettings struct {
+	tableName       struct{}  `pg:"user_alert_settings"`
+	UserID          int64     `json:"-"`
+	FailsCount      int64     `json:"failsCount"`
+	DownMinutes     int64     `json:"downMinutes"`
+	Lang            string    `json:"lang"`
+	TGChatID        int64     `json:"-"`
+	TGLinkCode      string    `json:"tgLinkCode"`
+	TGLinked        bool      `json:"tgLinked" pg:"-"`
+	EmailNodeEvents bool      `json:"emailNodeEvents"`
+	EmailVersions   bool      `json:"emailVersions"`
+	Email           string    `json:"email" pg:"-"`
+	PendingEmail    string    `json:"pendingEmail" pg:"-"`
+	UpdatedAt       time.Time `json:"-"`
+}
+
+func (s *UserAlertSettings) fillExtra(db *pg.DB, user *User) error {
+	pendingEmail, err := LoadUserPendingEmail(db, user)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	s.TGLinked = s.TGChatID != 0
+	s.Email = user.Email
+	s.PendingEmail = pendingEmail
+	return nil
+}
+
+// UserNodeAlertRules define when a node is considered down:
+// after FailsCount consecutive failed pings AND at least DownMinutes after the first of them.
+type UserNodeAlertRules struct {
+	FailsCount  int64
+	DownMinutes int64
+}
+
+type UserNodeAlertState struct {
+	FailsCount     int64
+	DownSince      time.Time
+	AlertIsDown    bool
+	CheckBits      int64
+	CheckBitsCount int64
+	IsFlapping     bool
+}
+
+// StateChangesCount returns number of up/down changes among recent checks
+func (s *UserNodeAlertState) StateChangesCount() int {
+	if s.CheckBitsCount < 2 {
+		return 0
+	}
+	mask := uint64(1)<<(s.CheckBitsCount-1) - 1
+	return bits.OnesCount64(uint64(s.CheckBits^(s.CheckBits>>1)) & mask)
+}
+
+// updateFlapping adds check result to recent ones. Returns whether node has just started or stopped flapping.
+func (s *UserNodeAlertState) updateFlapping(pingOk bool) (started, stopped bool) {
+	s.CheckBits = (s.CheckBits << 1) & (1<<FlapWindowChecks - 1)
+	if pingOk {
+		s.CheckBits |= 1
+	}
+	if s.CheckBitsCount < FlapWindowChecks {
+		s.CheckBitsCount++
+	}
+
+	changes := s.StateChangesCount()
+	if !s.IsFlapping && changes >= FlapStartChanges {
+		s.IsFlapping = true
+		return true, false
+	}
+	if s.IsFlapping && changes <= FlapStopChanges {
+		s.IsFlapping = false
+		return false, true
+	}
+	return false, false
+}
+
+// Update applies ping result to the state. Returns event kind (or empty string if nothing has happened)
+// and the moment node went down (first failed ping).
+//
+// While node is flapping only a single UserNodeEventFlapping is returned (when flapping starts),
+// down/up events are suppressed. Down state is not remembered during flapping,
+// so if the node is still down when flapping stops, the down event will be emitted.
+// Otherwise UserNodeEventFlappingStopped is returned when flapping stops (node may have recovered
+// while up events were suppressed, so the last "down" or "flapping" event should not stay the final one).
+func (s *UserNodeAlertState) Update(rules UserNodeAlertRules, pingedAt time.Time, pingOk bool) (UserNodeEventKind, time.Time) {
+	flappingStarted, flappingStopped := s.updateFlapping(pingOk)
+	kind, downSince := s.updateDown(rules, pingedAt, pingOk)
+	if flappingStopped && kind == "" {
+		return UserNodeEventFlappingStopped, downSince
+	}
+	if !s.IsFlapping {
+		return kind, downSince
+	}
+	if kind == UserNodeEventDown {
+		s.AlertIsDown = false
+	}
+	if flappingStarted {
+		return UserNodeEventFlapping, downSince
+	}
+	return "", downSince
+}
+
+func (s *UserNodeAlertState) updateDown(rules UserNodeAlertRules, pingedAt time.Time, pingOk bool) (UserNodeEventKind, time.Time) {
+	downSince := s.DownSince
+	if pingOk {
+		wasDown := s.AlertIsDown
+		s.FailsCount = 0
+		s.DownSince = time.Time{}
+		s.AlertIsDown = false
+		if wasDown {
+			return UserNodeEventUp, downSince
+		}
+		return "", downSince
+	}
+
+	if s.FailsCount == 0 || s.DownSince.IsZero() {
+		s.DownSince = pingedAt
+		downSince = pingedAt
+	}
+	s.FailsCount++
+	if !s.AlertIsDown &&
+		s.FailsCount >= rules.FailsCount &&
+		pingedAt.Sub(s.DownSince) >= time.Duration(rules.DownMinutes)*time.Minute {
+		s.AlertIsDown = true
+		return UserNodeEventDown, downSince
+	}
+	return "", downSince
+}
+
+type UserNodeEvent struct {
+	ID        int64
+	UserID    int64
+	RawNodeID []byte
+	NodeID    storj.NodeID
+	Kind      UserNodeEventKind
+	Address   string
+	LastPing  int64 // last successful ping duration (ms), 0 if unknown
+	SatLabel  string
+	DownSince time.Time
+	CreatedAt time.Time
+}
+
+func (e *UserNodeEvent) Downtime() time.Duration {
+	return e.CreatedAt.Sub(e.DownSince)
+}
+
+func ConvertUserNodeEventIDs(events []*UserNodeEvent) error {
+	var err error
+	for _, event := range events {
+		event.NodeID, err = storj.NodeIDFromBytes(event.RawNodeID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func SaveUserNodeEvent(db DBTx, event *UserNodeEvent) error {
+	_, err := db.QueryOne(pg.Scan(&event.ID), `
+		INSERT INTO user_node_events (user_id, node_id, kind, address, last_ping, sat_label, down_since, created_at)
+		VALUES (?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?)
+		RETURNING id`,
+		event.UserID, event.NodeID, event.Kind, event.Address, event.LastPing, event.SatLabel,
+		event.DownSince, event.CreatedAt)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	// each user webhook gets its own delivery (with its own retries)
+	_, err = db.Exec(`
+		INSERT INTO user_webhook_deliveries (webhook_id, event_id)
+		SELECT id, ? FROM user_webhooks WHERE user_id = ?`,
+		event.ID, event.UserID)
+	return merry.Wrap(err)
+}
+
+func LoadUserAlertSettings(db *pg.DB, user *User) (*UserAlertSettings, error) {
+	settings := &UserAlertSettings{}
+	err := db.Model(settings).Where("user_id = ?", user.ID).Select()
+	if err == pg.ErrNoRows {
+		// creating default settings, mainly to have a TG link code
+		_, err = db.QueryOne(settings, `
+			INSERT INTO user_alert_settings (user_id, tg_link_code) VALUES (?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+			RETURNING *`,
+			user.ID, utils.RandHexString(16))
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if err := settings.fillExtra(db, user); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return settings, nil
+}
+
+func SetUserAlertSettings(db *pg.DB, user *User, failsCount, downMinutes int64, emailNodeEvents, emailVersions bool, lang string) (*UserAlertSettings, error) {
+	if _, err := LoadUserAlertSettings(db, user); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	settings := &UserAlertSettings{}
+	_, err := db.QueryOne(settings, `
+		UPDATE user_alert_settings SET fails_count = ?, down_minutes = ?,
+			email_node_events = ?, email_versions = ?, lang = ?, updated_at = NOW()
+		WHERE user_id = ?
+		RETURNING *`,
+		failsCount, downMinutes, emailNodeEvents, emailVersions, lang, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if err := settings.fillExtra(db, user); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return settings, nil
+}
+
+// LinkUserAlertsTGChat attaches TG chat to the account with matching link code.
+// Returns username and alert messages language.
+func LinkUserAlertsTGChat(db *pg.DB, linkCode string, chatID int64) (string, string, error) {
+	var res struct{ Username, Lang string }
+	_, err := db.QueryOne(&res, `
+		UPDATE user_alert_settings SET tg_chat_id = ?, updated_at = NOW()
+		FROM users WHERE users.id = user_id AND tg_link_code = ?
+		RETURNING username, lang`,
+		chatID, linkCode)
+	if err == pg.ErrNoRows {
+		return "", "", ErrTGLinkCodeNotFound.Here()
+	}
+	if err != nil {
+		return "", "", merry.Wrap(err)
+	}
+	return res.Username, res.Lang, nil
+}
+
+// UnlinkUserAlertsTGChat detaches TG chat from all accounts. Returns detached accounts count.
+func UnlinkUserAlertsTGChat(db *pg.DB, chatID int64) (int, error) {
+	res, err := db.Exec(`
+		UPDATE user_alert_settings SET tg_chat_id = NULL, updated_at = NOW()
+		WHERE tg_chat_id = ?`,
+		chatID)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserNodeAlertState_UpdateFlapping(t *testing.T) {
+	rules := UserNodeAlertRules{FailsCount: 1, DownMinutes: 0}
+	var s UserNodeAlertState
+	stamp := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	check := func(ok bool) UserNodeEventKind {
+		stamp = stamp.Add(time.Minute)
+		kind, _ := s.Update(rules, stamp, ok)
+		return kind
+	}
+
+	var kinds []UserNodeEventKind
+	for i := 0; i < 5; i++ {
+		for _, ok := range []bool{true, false} {
+			if kind := check(ok); kind != "" {
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	// sixth up/down change (third recovery) starts flapping, following changes are silent
+	expected := []UserNodeEventKind{
+		UserNodeEventDown, UserNodeEventUp, UserNodeEventDown, UserNodeEventUp, UserNodeEventDown, UserNodeEventFlapping,
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("events: %v", kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Fatalf("events: %v", kinds)
+		}
+	}
+	if !s.IsFlapping || s.AlertIsDown {
+		t.Fatalf("state: %+v", s)
+	}
+
+	// node stays down: flapping stops when old changes leave the window, then down event is sent
+	kinds = nil
+	for i := 0; i < FlapWindowChecks; i++ {
+		if kind := check(false); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) != 1 || kinds[0] != UserNodeEventDown || s.IsFlapping {
+		t.Fatalf("events: %v, state: %+v", kinds, s)
+	}
+}
+
+func TestUserNodeAlertState_UpdateFlappingStopped(t *testing.T) {
+	rules := UserNodeAlertRules{FailsCount: 1, DownMinutes: 0}
+	var s UserNodeAlertState
+	stamp := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	var kinds []UserNodeEventKind
+	check := func(ok bool) {
+		stamp = stamp.Add(time.Minute)
+		if kind, _ := s.Update(rules, stamp, ok); kind != "" {
+			kinds = append(kinds, kind)
+		}
+	}
+
+	// down -> flapping (it starts on a successful check, the up event is swallowed) -> down -> up
+	check(true)
+	for i := 0; i < 3; i++ {
+		check(false)
+		check(true)
+	}
+	check(false)
+	expected := []UserNodeEventKind{
+		UserNodeEventDown, UserNodeEventUp, UserNodeEventDown, UserNodeEventUp, UserNodeEventDown, UserNodeEventFlapping,
+	}
+	if !s.IsFlapping || len(kinds) != len(expected) {
+		t.Fatalf("events: %v, state: %+v", kinds, s)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Fatalf("events: %v", kinds)
+		}
+	}
+
+	// node recovers: up is suppressed during flapping, but flapping end is reported
+	kinds = nil
+	for i := 0; i < FlapWindowChecks; i++ {
+		check(true)
+	}
+	if len(kinds) != 1 || kinds[0] != UserNodeEventFlappingStopped || s.IsFlapping || s.AlertIsDown {
+		t.Fatalf("events: %v, state: %+v", kinds, s)
+	}
+}
@@ -0,0 +1,115 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"storjnet/utils"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/rs/zerolog/log"
+)
+
+const MaxUserAPITokens = 20
+const APITokenPrefix = "snt_"
+
+var ErrTooManyAPITokens = merry.New("too_many_api_tokens")
+var ErrAPITokenNotFound = merry.New("api_token_not_found")
+
+type UserAPIToken struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	Name       string    `json:"name"`
+	ReadOnly   bool      `json:"readOnly"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+}
+
+// only token hashes are stored, tokens themselves are shown just once (on creation)
+func hashAPIToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func LoadUserAPITokens(db *pg.DB, user *User) ([]*UserAPIToken, error) {
+	tokens := make([]*UserAPIToken, 0)
+	_, err := db.Query(&tokens, `
+		SELECT id, user_id, name, read_only, created_at, last_used_at FROM user_api_tokens
+		WHERE user_id = ? ORDER BY id`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return tokens, nil
+}
+
+// CreateUserAPIToken returns saved token info and the token itself.
+func CreateUserAPIToken(db *pg.DB, user *User, name string, readOnly bool) (*UserAPIToken, string, error) {
+	token := APITokenPrefix + utils.RandHexString(40)
+	apiToken := &UserAPIToken{}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_api_tokens WHERE user_id = ?`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserAPITokens {
+			return ErrTooManyAPITokens.Here()
+		}
+		_, err := tx.QueryOne(apiToken, `
+			INSERT INTO user_api_tokens (user_id, name, token_hash, read_only) VALUES (?, ?, ?, ?)
+			RETURNING id, user_id, name, read_only, created_at, last_used_at`,
+			user.ID, name, hashAPIToken(token), readOnly)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, "", merry.Wrap(err)
+	}
+	return apiToken, token, nil
+}
+
+func DelUserAPIToken(db *pg.DB, user *User, tokenID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM user_api_tokens WHERE id = ? AND user_id = ?`,
+		tokenID, user.ID)
+	return merry.Wrap(err)
+}
+
+func FindUserByAPIToken(db *pg.DB, token string) (*User, *UserAPIToken, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, nil, ErrAPITokenNotFound.Here()
+	}
+	apiToken := &UserAPIToken{}
+	_, err := db.QueryOne(apiToken, `
+		SELECT id, user_id, name, read_only, created_at, last_used_at FROM user_api_tokens
+		WHERE token_hash = ?`, hashAPIToken(token))
+	if err == pg.ErrNoRows {
+		return nil, nil, ErrAPITokenNotFound.Here()
+	}
+	if err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+	user := &User{}
+	if err := db.Model(user).Where("id = ?", apiToken.UserID).Select(); err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+	updateAPITokenLastUsedAtIfNeed(db, apiToken)
+	return user, apiToken, nil
+}
+
+func updateAPITokenLastUsedAtIfNeed(db *pg.DB, apiToken *UserAPIToken) {
+	if time.Since(apiToken.LastUsedAt) < time.Minute {
+		return
+	}
+	id := apiToken.ID
+	go func() {
+		_, err := db.Exec("UPDATE user_api_tokens SET last_used_at = now() WHERE id = ?", id)
+		if err != nil {
+			log.Error().Err(err).Int64("token_id", id).Msg("failed to update API token last_used_at")
+		}
+	}()
+}
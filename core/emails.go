@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+)
+
+const EmailVerificationCodeLifetime = time.Hour
+const EmailVerificationResendInterval = time.Minute
+const EmailVerificationMaxAttempts = 5
+
+var ErrEmailExsists = merry.New("email_exists")
+var ErrEmailVerificationTooFrequent = merry.New("email_verification_too_frequent")
+var ErrEmailVerificationNotFound = merry.New("email_verification_not_found")
+var ErrEmailVerificationWrongCode = merry.New("email_verification_wrong_code")
+
+func makeEmailVerificationCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n.Int64())
+}
+
+// LoadUserPendingEmail returns email that is waiting for verification (or empty string).
+func LoadUserPendingEmail(db *pg.DB, user *User) (string, error) {
+	var email string
+	_, err := db.QueryOne(pg.Scan(&email), `
+		SELECT email FROM user_email_verifications
+		WHERE user_id = ? AND created_at > NOW() - ? * INTERVAL '1 second' AND attempts < ?`,
+		user.ID, int64(EmailVerificationCodeLifetime/time.Second), EmailVerificationMaxAttempts)
+	if err == pg.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", merry.Wrap(err)
+	}
+	return email, nil
+}
+
+// StartUserEmailVerification saves new email verification code and sends it to the email.
+func StartUserEmailVerification(db *pg.DB, mailer utils.Mailer, user *User, email, lang string) error {
+	code := makeEmailVerificationCode()
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var lastCreatedAt time.Time
+		_, err := tx.QueryOne(pg.Scan(&lastCreatedAt), `
+			SELECT created_at FROM user_email_verifications WHERE user_id = ? FOR UPDATE`, user.ID)
+		if err != nil && err != pg.ErrNoRows {
+			return merry.Wrap(err)
+		}
+		if time.Since(lastCreatedAt) < EmailVerificationResendInterval {
+			return ErrEmailVerificationTooFrequent.Here()
+		}
+		_, err = tx.Exec(`
+			INSERT INTO user_email_verifications (user_id, email, code) VALUES (?, ?, ?)
+			ON CONFLICT (user_id) DO UPDATE SET
+				email = EXCLUDED.email, code = EXCLUDED.code, attempts = 0, created_at = NOW()`,
+			user.ID, email, code)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		// sending inside transaction: if sending fails, code will not be saved
+		subject := loc(lang, "storjnet: email verification", "storjnet: подтверждение почты")
+		text := loc(lang,
+			"Verification code for "+user.Username+" on storjnet.info: "+code+"\n\nIf you did not request it, just ignore this email.",
+			"Код подтверждения для "+user.Username+" на storjnet.info: "+code+"\n\nЕсли вы его не запрашивали, просто проигнорируйте это письмо.")
+		return merry.Wrap(mailer.Send(email, subject, text))
+	})
+	return merry.Wrap(err)
+}
+
+// FinishUserEmailVerification checks the code and sets user email on success.
+func FinishUserEmailVerification(db *pg.DB, user *User, code string) (string, error) {
+	var email string
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		verif := &struct {
+			Email     string
+			Code      string
+			Attempts  int64
+			CreatedAt time.Time
+		}{}
+		_, err := tx.QueryOne(verif, `
+			SELECT email, code, attempts, created_at FROM user_email_verifications
+			WHERE user_id = ? FOR UPDATE`, user.ID)
+		if err == pg.ErrNoRows {
+			return ErrEmailVerificationNotFound.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if verif.Attempts >= EmailVerificationMaxAttempts || time.Since(verif.CreatedAt) > EmailVerificationCodeLifetime {
+			return ErrEmailVerificationNotFound.Here()
+		}
+		if verif.Code != code {
+			return ErrEmailVerificationWrongCode.Here()
+		}
+
+		_, err = tx.Exec(`UPDATE users SET email = ? WHERE id = ?`, verif.Email, user.ID)
+		if utils.IsConstrError(err, "users", "unique_violation", "users_email_key") {
+			return ErrEmailExsists.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		_, err = tx.Exec(`DELETE FROM user_email_verifications WHERE user_id = ?`, user.ID)
+		email = verif.Email
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		// transaction is rolled back, so updating wrong attempts counter separately
+		if merry.Is(err, ErrEmailVerificationWrongCode) {
+			if _, uerr := db.Exec(`UPDATE user_email_verifications SET attempts = attempts + 1 WHERE user_id = ?`, user.ID); uerr != nil {
+				return "", merry.Wrap(uerr)
+			}
+		}
+		return "", merry.Wrap(err)
+	}
+	user.Email = email
+	return email, nil
+}
+
+func DelUserEmail(db *pg.DB, user *User) error {
+	_, err := db.Exec(`UPDATE users SET email = NULL WHERE id = ?`, user.ID)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	user.Email = ""
+	return nil
+}
+
+func loc(lang, en, ru string) string {
+	if lang == "ru" {
+		return ru
+	}
+	return en
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+const MaxUserMaintenanceWindows = 50
+
+var ErrTooManyMaintenanceWindows = merry.New("too_many_maintenance_windows")
+var ErrMaintenanceNodeNotFound = merry.New("maintenance_node_not_found")
+
+const (
+	MaintenanceOnce   = "none"
+	MaintenanceDaily  = "daily"
+	MaintenanceWeekly = "weekly"
+)
+
+// InMaintenanceSQL is true if the user_nodes row is inside one of its maintenance windows right now.
+// Recurring windows repeat every 24 hours (or 7 days) since starts_at.
+const InMaintenanceSQL = `EXISTS (
+	SELECT 1 FROM user_maintenance_windows AS mw
+	WHERE mw.user_id = user_nodes.user_id
+	  AND (mw.node_id IS NULL OR mw.node_id = user_nodes.node_id)
+	  AND mw.starts_at <= NOW()
+	  AND CASE mw.recurrence
+		WHEN 'daily' THEN EXTRACT(EPOCH FROM NOW() - mw.starts_at)::bigint % (24*3600) < mw.duration_minutes*60
+		WHEN 'weekly' THEN EXTRACT(EPOCH FROM NOW() - mw.starts_at)::bigint % (7*24*3600) < mw.duration_minutes*60
+		ELSE NOW() < mw.starts_at + mw.duration_minutes * INTERVAL '1 minute'
+	  END)`
+
+type MaintenanceWindow struct {
+	ID              int64         `json:"id"`
+	RawNodeID       []byte        `json:"-"`
+	NodeID          *storj.NodeID `json:"nodeId"`
+	StartsAt        time.Time     `json:"startsAt"`
+	DurationMinutes int64         `json:"durationMinutes"`
+	Recurrence      string        `json:"recurrence"`
+	CreatedAt       time.Time     `json:"createdAt"`
+}
+
+func IsValidMaintenanceWindow(startsAt time.Time, durationMinutes int64, recurrence string) bool {
+	if startsAt.IsZero() || durationMinutes <= 0 {
+		return false
+	}
+	switch recurrence {
+	case MaintenanceOnce:
+		return durationMinutes <= 7*24*60
+	case MaintenanceDaily:
+		return durationMinutes < 24*60
+	case MaintenanceWeekly:
+		return durationMinutes < 7*24*60
+	}
+	return false
+}
+
+func LoadUserMaintenanceWindows(db *pg.DB, user *User) ([]*MaintenanceWindow, error) {
+	windows := make([]*MaintenanceWindow, 0)
+	_, err := db.Query(&windows, `
+		SELECT id, node_id AS raw_node_id, starts_at, duration_minutes, recurrence, created_at
+		FROM user_maintenance_windows
+		WHERE user_id = ? ORDER BY starts_at, id`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	for _, window := range windows {
+		if window.RawNodeID != nil {
+			nodeID, err := storj.NodeIDFromBytes(window.RawNodeID)
+			if err != nil {
+				return nil, merry.Wrap(err)
+			}
+			window.NodeID = &nodeID
+		}
+	}
+	return windows, nil
+}
+
+// AddUserMaintenanceWindow saves new window (for all user nodes if window.NodeID is nil).
+// Finished one-off windows of the user are removed.
+func AddUserMaintenanceWindow(db *pg.DB, user *User, window *MaintenanceWindow) error {
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		_, err := tx.Exec(`
+			DELETE FROM user_maintenance_windows
+			WHERE user_id = ? AND recurrence = 'none'
+			  AND starts_at + duration_minutes * INTERVAL '1 minute' < NOW()`,
+			user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+
+		var count int
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_maintenance_windows WHERE user_id = ?`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserMaintenanceWindows {
+			return ErrTooManyMaintenanceWindows.Here()
+		}
+
+		if window.NodeID != nil {
+			var exists bool
+			_, err := tx.QueryOne(pg.Scan(&exists), `
+				SELECT EXISTS (SELECT 1 FROM user_nodes WHERE user_id = ? AND node_id = ?)`,
+				user.ID, *window.NodeID)
+			if err != nil {
+				return merry.Wrap(err)
+			}
+			if !exists {
+				return ErrMaintenanceNodeNotFound.Here()
+			}
+		}
+
+		var rawNodeID []byte
+		if window.NodeID != nil {
+			rawNodeID = window.NodeID.Bytes()
+		}
+		_, err = tx.QueryOne(window, `
+			INSERT INTO user_maintenance_windows (user_id, node_id, starts_at, duration_minutes, recurrence)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id, created_at`,
+			user.ID, rawNodeID, window.StartsAt, window.DurationMinutes, window.Recurrence)
+		return merry.Wrap(err)
+	}))
+}
+
+func DelUserMaintenanceWindow(db *pg.DB, user *User, windowID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM user_maintenance_windows WHERE id = ? AND user_id = ?`,
+		windowID, user.ID)
+	return merry.Wrap(err)
+}
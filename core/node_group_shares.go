@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"sort"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+const MaxUserNodeGroupShares = 20
+
+var ErrTooManyNodeGroupShares = merry.New("too_many_node_group_shares")
+var ErrNodeGroupShareKeyExists = merry.New("node_group_share_key_exists")
+
+var publicShareKeyRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{2,31}$`)
+
+// UserNodeGroupShare is a read-only status page of a node group available without login at /share/<key>.
+// Public shares have readable user-chosen keys and may be indexed, secret ones have random keys.
+type UserNodeGroupShare struct {
+	ID        int64     `json:"id"`
+	Key       string    `json:"key"`
+	UserID    int64     `json:"-"`
+	GroupID   int64     `json:"groupId"`
+	GroupName string    `json:"groupName"`
+	IsPublic  bool      `json:"isPublic"`
+	MaskIDs   bool      `json:"maskIds"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SharedNode is a node as it is shown on a share page. If share IDs are masked,
+// the ID is shortened and the address is hidden. Ref is used instead of the ID in share API.
+type SharedNode struct {
+	Ref               int       `json:"ref"`
+	ID                string    `json:"id"`
+	Address           string    `json:"address"`
+	PingMode          string    `json:"pingMode"`
+	PingProto         string    `json:"pingProto"`
+	PingInterval      int64     `json:"pingInterval"`
+	LastPingedAt      time.Time `json:"lastPingedAt"`
+	LastPing          int64     `json:"lastPing"`
+	LastPingWasOk     bool      `json:"lastPingWasOk"`
+	LastUpAt          time.Time `json:"lastUpAt"`
+	LastQUICPing      int64     `json:"lastQuicPing"`
+	LastQUICPingWasOk bool      `json:"lastQuicPingWasOk"`
+	LastQUICUpAt      time.Time `json:"lastQuicUpAt"`
+	InMaintenance     bool      `json:"inMaintenance"`
+	IsFlapping        bool      `json:"isFlapping"`
+}
+
+func IsValidPublicShareKey(key string) bool {
+	return publicShareKeyRe.MatchString(key)
+}
+
+// MaskNodeID leaves only a few first and last chars of the ID, enough to tell nodes apart.
+func MaskNodeID(id storj.NodeID) string {
+	str := id.String()
+	return str[:4] + "…" + str[len(str)-4:]
+}
+
+func LoadUserNodeGroupShares(db *pg.DB, user *User) ([]*UserNodeGroupShare, error) {
+	shares := make([]*UserNodeGroupShare, 0)
+	_, err := db.Query(&shares, `
+		SELECT s.id, s.key, s.user_id, s.group_id, g.name AS group_name, s.is_public, s.mask_ids, s.created_at
+		FROM user_node_group_shares AS s JOIN user_node_groups AS g ON g.id = s.group_id
+		WHERE s.user_id = ? ORDER BY s.id`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return shares, nil
+}
+
+// AddUserNodeGroupShare creates a share. Public shares use the given key (must be valid
+// by IsValidPublicShareKey), secret ones get a random key.
+func AddUserNodeGroupShare(db *pg.DB, user *User, groupID int64, isPublic bool, publicKey string, maskIDs bool) (*UserNodeGroupShare, error) {
+	share := &UserNodeGroupShare{GroupID: groupID, IsPublic: isPublic, MaskIDs: maskIDs, Key: publicKey}
+	if !isPublic {
+		share.Key = utils.RandHexString(24)
+	}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_node_group_shares WHERE user_id = ?`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserNodeGroupShares {
+			return ErrTooManyNodeGroupShares.Here()
+		}
+		_, err := tx.QueryOne(pg.Scan(&share.GroupName), `
+			SELECT name FROM user_node_groups WHERE id = ? AND user_id = ?`, groupID, user.ID)
+		if err == pg.ErrNoRows {
+			return ErrNodeGroupNotFound.Here()
+		} else if err != nil {
+			return merry.Wrap(err)
+		}
+		_, err = tx.QueryOne(share, `
+			INSERT INTO user_node_group_shares (key, user_id, group_id, is_public, mask_ids) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (key) DO NOTHING
+			RETURNING id, created_at`,
+			share.Key, user.ID, groupID, isPublic, maskIDs)
+		if err == pg.ErrNoRows {
+			return ErrNodeGroupShareKeyExists.Here()
+		}
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return share, nil
+}
+
+func DelUserNodeGroupShare(db *pg.DB, user *User, shareID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM user_node_group_shares WHERE id = ? AND user_id = ?`,
+		shareID, user.ID)
+	return merry.Wrap(err)
+}
+
+// LoadNodeGroupShare returns share by its key or nil if there is no such share.
+func LoadNodeGroupShare(db *pg.DB, key string) (*UserNodeGroupShare, error) {
+	share := &UserNodeGroupShare{}
+	_, err := db.QueryOne(share, `
+		SELECT s.id, s.key, s.user_id, s.group_id, g.name AS group_name, s.is_public, s.mask_ids, s.created_at
+		FROM user_node_group_shares AS s JOIN user_node_groups AS g ON g.id = s.group_id
+		WHERE s.key = ?`, key)
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return share, nil
+}
+
+// LoadSharedNodes returns current nodes of the shared group sorted by ID (so refs are stable
+// while the group is not changed) and their real IDs (same order).
+func LoadSharedNodes(db *pg.DB, share *UserNodeGroupShare) ([]*SharedNode, []storj.NodeID, error) {
+	nodes, err := LoadUserNodes(db, &User{ID: share.UserID}, share.GroupName)
+	if err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return bytes.Compare(nodes[i].RawID, nodes[j].RawID) < 0 })
+
+	sharedNodes := make([]*SharedNode, len(nodes))
+	nodeIDs := make([]storj.NodeID, len(nodes))
+	for i, node := range nodes {
+		sn := &SharedNode{
+			Ref:               i,
+			ID:                node.ID.String(),
+			Address:           node.Address,
+			PingMode:          node.PingMode,
+			PingProto:         node.PingProto,
+			PingInterval:      node.PingInterval,
+			LastPingedAt:      node.LastPingedAt,
+			LastPing:          node.LastPing,
+			LastPingWasOk:     node.LastPingWasOk,
+			LastUpAt:          node.LastUpAt,
+			LastQUICPing:      node.LastQUICPing,
+			LastQUICPingWasOk: node.LastQUICPingWasOk,
+			LastQUICUpAt:      node.LastQUICUpAt,
+			InMaintenance:     node.InMaintenance,
+			IsFlapping:        node.IsFlapping,
+		}
+		if share.MaskIDs {
+			sn.ID = MaskNodeID(node.ID)
+			sn.Address = ""
+		}
+		sharedNodes[i] = sn
+		nodeIDs[i] = node.ID
+	}
+	return sharedNodes, nodeIDs, nil
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+const MaxUserNodeGroups = 100
+
+var ErrTooManyNodeGroups = merry.New("too_many_node_groups")
+var ErrNodeGroupExists = merry.New("node_group_exists")
+var ErrNodeGroupNotFound = merry.New("node_group_not_found")
+
+// UserNodeGroup is a named set of user nodes (like "site-A" or "raspberry"), a node may be in several groups.
+type UserNodeGroup struct {
+	ID           int64          `json:"id"`
+	Name         string         `json:"name"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	NodesCount   int64          `json:"nodesCount"`
+	UpCount      int64          `json:"upCount"`
+	DownCount    int64          `json:"downCount"`
+	NodeIDs      []storj.NodeID `json:"nodeIds" pg:"-"`
+	MonthUptime  float64        `json:"monthUptime"` // percent, current month, -1 if there were no checks
+	MonthOutages int64          `json:"monthOutages"`
+}
+
+// LoadUserNodeGroups returns user groups with current status counts (nodes with pings turned off are neither up nor down)
+// and aggregated uptime of group nodes for the current month.
+func LoadUserNodeGroups(db *pg.DB, user *User) ([]*UserNodeGroup, error) {
+	groups := make([]*UserNodeGroup, 0)
+	_, err := db.Query(&groups, `
+		SELECT g.id, g.name, g.created_at,
+			count(n.node_id) AS nodes_count,
+			count(*) FILTER (WHERE n.ping_mode != 'off' AND n.last_ping_was_ok) AS up_count,
+			count(*) FILTER (WHERE n.ping_mode != 'off' AND NOT n.last_ping_was_ok) AS down_count
+		FROM user_node_groups AS g
+		LEFT JOIN user_node_group_members AS m ON m.group_id = g.id
+		LEFT JOIN user_nodes AS n ON n.node_id = m.node_id AND n.user_id = m.user_id
+		WHERE g.user_id = ?
+		GROUP BY g.id
+		ORDER BY g.name`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if len(groups) == 0 {
+		return groups, nil
+	}
+
+	var members []struct {
+		GroupID   int64
+		RawNodeID []byte
+	}
+	_, err = db.Query(&members, `
+		SELECT group_id, node_id AS raw_node_id FROM user_node_group_members
+		WHERE user_id = ? ORDER BY node_id`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	reports, err := LoadUserNodesUptimeReport(db, user, time.Now().In(time.UTC))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	reportByID := make(map[storj.NodeID]*UserNodeUptimeReport, len(reports))
+	for _, rep := range reports {
+		reportByID[rep.NodeID] = rep
+	}
+
+	groupByID := make(map[int64]*UserNodeGroup, len(groups))
+	checked := make(map[int64]int64, len(groups))
+	down := make(map[int64]int64, len(groups))
+	for _, group := range groups {
+		group.NodeIDs = make([]storj.NodeID, 0)
+		groupByID[group.ID] = group
+	}
+	for _, member := range members {
+		nodeID, err := storj.NodeIDFromBytes(member.RawNodeID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		group := groupByID[member.GroupID]
+		group.NodeIDs = append(group.NodeIDs, nodeID)
+		if rep, ok := reportByID[nodeID]; ok {
+			checked[group.ID] += rep.CheckedMinutes
+			down[group.ID] += rep.DownMinutes
+			group.MonthOutages += rep.OutagesCount
+		}
+	}
+	for _, group := range groups {
+		group.MonthUptime = -1
+		if checked[group.ID] > 0 {
+			group.MonthUptime = float64(checked[group.ID]-down[group.ID]) / float64(checked[group.ID]) * 100
+		}
+	}
+	return groups, nil
+}
+
+func AddUserNodeGroup(db *pg.DB, user *User, name string) (*UserNodeGroup, error) {
+	group := &UserNodeGroup{NodeIDs: []storj.NodeID{}, MonthUptime: -1}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_node_groups WHERE user_id = ?`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserNodeGroups {
+			return ErrTooManyNodeGroups.Here()
+		}
+		_, err := tx.QueryOne(group, `
+			INSERT INTO user_node_groups (user_id, name) VALUES (?, ?)
+			ON CONFLICT (user_id, name) DO NOTHING
+			RETURNING id, name, created_at`,
+			user.ID, name)
+		if err == pg.ErrNoRows {
+			return ErrNodeGroupExists.Here()
+		}
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return group, nil
+}
+
+func DelUserNodeGroup(db *pg.DB, user *User, groupID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM user_node_groups WHERE id = ? AND user_id = ?`,
+		groupID, user.ID)
+	return merry.Wrap(err)
+}
+
+// SetUserNodeGroupMembers adds nodes to the group (or removes them if remove is true).
+// Unknown node IDs (not in user_nodes) are ignored.
+func SetUserNodeGroupMembers(db *pg.DB, user *User, groupID int64, nodeIDs []storj.NodeID, remove bool) error {
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var exists bool
+		_, err := tx.QueryOne(pg.Scan(&exists), `
+			SELECT EXISTS (SELECT 1 FROM user_node_groups WHERE id = ? AND user_id = ?)`,
+			groupID, user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if !exists {
+			return ErrNodeGroupNotFound.Here()
+		}
+
+		for _, nodeID := range nodeIDs {
+			if remove {
+				_, err = tx.Exec(`
+					DELETE FROM user_node_group_members WHERE group_id = ? AND node_id = ?`,
+					groupID, nodeID)
+			} else {
+				_, err = tx.Exec(`
+					INSERT INTO user_node_group_members (group_id, node_id, user_id)
+					SELECT ?, node_id, user_id FROM user_nodes WHERE node_id = ? AND user_id = ?
+					ON CONFLICT DO NOTHING`,
+					groupID, nodeID, user.ID)
+			}
+			if err != nil {
+				return merry.Wrap(err)
+			}
+		}
+		return nil
+	}))
+}
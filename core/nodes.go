@@ -14,14 +14,65 @@ type BriefNode struct {
 	Address string       `json:"address"`
 }
 
+// SatPing is a result of a node check from a single satellite (vantage point).
+type SatPing struct {
+	Sat  string `json:"sat"`
+	Ok   bool   `json:"ok"`
+	Ping int64  `json:"ping"`
+}
+
+const (
+	PingProtoTCP  = "tcp"
+	PingProtoQUIC = "quic"
+	PingProtoBoth = "both"
+)
+
+// Allowed ping intervals (in minutes). History of a node is stored with the same resolution.
+var PingIntervals = []int64{1, 5, 15}
+
+const DefaultPingInterval = 1
+
 type Node struct {
 	BriefNode
-	PingMode      string    `json:"pingMode"`
-	LastPingedAt  time.Time `json:"lastPingedAt"`
-	LastPing      int64     `json:"lastPing"`
-	LastPingWasOk bool      `json:"lastPingWasOk"`
-	LastUpAt      time.Time `json:"lastUpAt"`
-	CreatedAt     time.Time `json:"-"`
+	PingMode          string    `json:"pingMode"`
+	PingProto         string    `json:"pingProto"`
+	PingAllSats       bool      `json:"pingAllSats"`
+	PingInterval      int64     `json:"pingInterval"`
+	LastPingedAt      time.Time `json:"lastPingedAt"`
+	LastPing          int64     `json:"lastPing"`
+	LastPingWasOk     bool      `json:"lastPingWasOk"`
+	LastUpAt          time.Time `json:"lastUpAt"`
+	LastSatPings      []SatPing `json:"lastSatPings"`
+	LastQUICPing      int64     `json:"lastQuicPing"`
+	LastQUICPingWasOk bool      `json:"lastQuicPingWasOk"`
+	LastQUICUpAt      time.Time `json:"lastQuicUpAt"`
+	InMaintenance     bool      `json:"inMaintenance"`
+	IsFlapping        bool      `json:"isFlapping"`
+	Groups            []string  `json:"groups" pg:",array"`
+	CreatedAt         time.Time `json:"-"`
+}
+
+func IsValidPingProto(proto string) bool {
+	return proto == PingProtoTCP || proto == PingProtoQUIC || proto == PingProtoBoth
+}
+
+func IsValidPingInterval(interval int64) bool {
+	for _, v := range PingIntervals {
+		if v == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// PrimaryPingIsQUIC is true if main node status and history are based on QUIC checks
+func (n *Node) PrimaryPingIsQUIC() bool {
+	return n.PingProto == PingProtoQUIC
+}
+
+// NeedsQUICPing is true if QUIC reachability must be checked and saved (to separate history)
+func (n *Node) NeedsQUICPing() bool {
+	return n.PingProto == PingProtoQUIC || n.PingProto == PingProtoBoth
 }
 
 type UserNode struct {
@@ -64,12 +115,16 @@ func ConvertUserNodeIDs(nodes []*UserNode) error {
 
 func SetUserNode(db *pg.DB, user *User, node *Node) error {
 	_, err := db.Exec(`
-		INSERT INTO user_nodes (node_id, user_id, address, ping_mode, details_updated_at) VALUES (?, ?, ?, ?, now())
+		INSERT INTO user_nodes (node_id, user_id, address, ping_mode, ping_proto, ping_all_sats, ping_interval, details_updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, now())
 		ON CONFLICT (node_id, user_id) DO UPDATE SET
 			address = EXCLUDED.address,
 			ping_mode = EXCLUDED.ping_mode,
+			ping_proto = EXCLUDED.ping_proto,
+			ping_all_sats = EXCLUDED.ping_all_sats,
+			ping_interval = EXCLUDED.ping_interval,
 			details_updated_at = now()`,
-		node.ID, user.ID, node.Address, node.PingMode)
+		node.ID, user.ID, node.Address, node.PingMode, node.PingProto, node.PingAllSats, node.PingInterval)
 	return merry.Wrap(err)
 }
 
@@ -80,11 +135,30 @@ func DelUserNode(db *pg.DB, user *User, nodeID storj.NodeID) error {
 	return merry.Wrap(err)
 }
 
-func LoadUserNodes(db *pg.DB, user *User) ([]*Node, error) {
+// LoadUserNodes returns user nodes, only ones from the named group if groupName is not empty.
+func LoadUserNodes(db *pg.DB, user *User, groupName string) ([]*Node, error) {
+	groupCond := ""
+	if groupName != "" {
+		groupCond = ` AND EXISTS (
+			SELECT 1 FROM user_node_group_members AS m JOIN user_node_groups AS g ON g.id = m.group_id
+			WHERE m.node_id = user_nodes.node_id AND m.user_id = user_nodes.user_id AND g.name = ?name)`
+	}
 	nodes := make([]*Node, 0)
 	_, err := db.Query(&nodes, `
-		SELECT node_id AS raw_id, address, ping_mode, last_pinged_at, last_ping, last_ping_was_ok, last_up_at
-		FROM user_nodes WHERE user_id = ?`, user.ID)
+		SELECT node_id AS raw_id, address, ping_mode, ping_proto, ping_all_sats, ping_interval,
+			last_pinged_at, last_ping, last_ping_was_ok, last_up_at, last_sat_pings,
+			last_quic_ping, last_quic_ping_was_ok, last_quic_up_at, is_flapping,
+			`+InMaintenanceSQL+` AS in_maintenance,
+			ARRAY(
+				SELECT g.name FROM user_node_group_members AS m JOIN user_node_groups AS g ON g.id = m.group_id
+				WHERE m.node_id = user_nodes.node_id AND m.user_id = user_nodes.user_id
+				ORDER BY g.name
+			) AS groups
+		FROM user_nodes WHERE user_id = ?user_id`+groupCond,
+		struct {
+			UserID int64
+			Name   string
+		}{user.ID, groupName})
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
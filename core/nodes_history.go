@@ -6,11 +6,79 @@ import (
 	"storj.io/common/storj"
 )
 
+// UserNodeHistory holds one day of pings. Each array item covers Resolution minutes
+// (node ping interval at the moment the day row was created), so there are 1440/Resolution items.
 type UserNodeHistory struct {
-	tableName struct{}     `pg:"user_nodes_history"`
-	RawNodeID []byte       `json:"-"`
-	NodeID    storj.NodeID `json:"nodeId"`
-	UserID    int64        `json:"userId"`
-	Date      time.Time    `json:"date"`
-	Pings     []uint16     `json:"pings" pg:",array"`
+	tableName  struct{}     `pg:"user_nodes_history"`
+	RawNodeID  []byte       `json:"-"`
+	NodeID     storj.NodeID `json:"nodeId"`
+	UserID     int64        `json:"userId"`
+	Date       time.Time    `json:"date"`
+	Resolution int64        `json:"resolution"`
+	Pings      []int16      `json:"pings" pg:",array"`
+}
+
+// UserNodeSatHistory is like UserNodeHistory but for a single vantage point (satellite/proxy).
+// Filled only for nodes with PingAllSats.
+type UserNodeSatHistory struct {
+	tableName  struct{}     `pg:"user_nodes_sat_history"`
+	RawNodeID  []byte       `json:"-"`
+	NodeID     storj.NodeID `json:"nodeId"`
+	UserID     int64        `json:"userId"`
+	SatLabel   string       `json:"satLabel"`
+	Date       time.Time    `json:"date"`
+	Resolution int64        `json:"resolution"`
+	Pings      []int16      `json:"pings" pg:",array"`
+}
+
+// Special history ping values (after DecodeHistoryPing).
+const (
+	HistoryPingNoData = 0
+	HistoryPingFail   = 1
+)
+
+// DecodeHistoryPing splits history array value (timeHint*2000 + ping, negated for checks
+// made during maintenance windows) into ping in ms (or HistoryPingNoData/HistoryPingFail),
+// time hint (0-14, ping position inside array item) and maintenance flag.
+func DecodeHistoryPing(value int16) (int64, int64, bool) {
+	isMaintenance := value < 0
+	v := int64(value)
+	if isMaintenance {
+		v = -v
+	}
+	return v % 2000, v / 2000, isMaintenance
+}
+
+// HistoryPingRecord is a decoded history array item
+type HistoryPingRecord struct {
+	Time        time.Time `json:"time"`
+	Ok          bool      `json:"ok"`
+	Ping        int64     `json:"ping"`
+	Maintenance bool      `json:"maintenance"`
+}
+
+// DecodeHistoryPings converts day history array into records (skipping items without data).
+// Record time is restored from item index and time hint, so it is accurate to 4*resolution seconds.
+func DecodeHistoryPings(date time.Time, resolution int64, pings []int16) []HistoryPingRecord {
+	if resolution <= 0 {
+		resolution = 1
+	}
+	records := make([]HistoryPingRecord, 0, len(pings))
+	for i, value := range pings {
+		ping, timeHint, isMaintenance := DecodeHistoryPing(value)
+		if ping == HistoryPingNoData {
+			continue
+		}
+		seconds := int64(i)*resolution*60 + timeHint*4*resolution
+		rec := HistoryPingRecord{
+			Time:        date.Add(time.Duration(seconds) * time.Second),
+			Ok:          ping != HistoryPingFail,
+			Maintenance: isMaintenance,
+		}
+		if rec.Ok {
+			rec.Ping = ping
+		}
+		records = append(records, rec)
+	}
+	return records
 }
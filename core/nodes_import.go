@@ -0,0 +1,105 @@
+package core
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+const MaxImportedNodes = 1000
+
+var ErrTooManyImportedNodes = merry.New("too_many_imported_nodes")
+
+// NodeImportError describes why a line of a bulk node list was skipped.
+type NodeImportError struct {
+	Line        int    `json:"line"` //starts from 1
+	Text        string `json:"text"`
+	Error       string `json:"error"`
+	Description string `json:"description,omitempty"`
+}
+
+func IsValidPingMode(mode string) bool {
+	return mode == "off" || mode == "dial" || mode == "ping"
+}
+
+// FormatNodeURL returns node in "id@address" form (same as in storj.NodeURL).
+func FormatNodeURL(node *BriefNode) string {
+	return node.ID.String() + "@" + node.Address
+}
+
+// ParseNodeURLs parses "id@address" lines. Empty lines and lines starting with "#" are ignored.
+// Wrong and duplicate lines are returned as errors, valid nodes are returned in the original order.
+func ParseNodeURLs(lines []string) ([]*BriefNode, []*NodeImportError) {
+	nodes := make([]*BriefNode, 0)
+	errs := make([]*NodeImportError, 0)
+	lineNums := map[storj.NodeID]int{}
+	for i, line := range lines {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		lineErr := func(code, descr string) {
+			errs = append(errs, &NodeImportError{Line: i + 1, Text: text, Error: code, Description: descr})
+		}
+
+		idStr, address, found := strings.Cut(text, "@")
+		if !found {
+			lineErr("WRONG_NODE_URL", "expected <node id>@<address>")
+			continue
+		}
+		id, err := storj.NodeIDFromString(strings.TrimSpace(idStr))
+		if err != nil {
+			lineErr("NODE_ID_DECODE_ERROR", err.Error())
+			continue
+		}
+		address = strings.TrimSpace(address)
+		if host, port, err := net.SplitHostPort(address); err != nil || host == "" || port == "" {
+			lineErr("WRONG_ADDRESS", "expected <host>:<port>")
+			continue
+		}
+		if prevLine, ok := lineNums[id]; ok {
+			lineErr("DUPLICATE_NODE", "same node ID on line "+strconv.Itoa(prevLine))
+			continue
+		}
+		lineNums[id] = i + 1
+		nodes = append(nodes, &BriefNode{ID: id, Address: address})
+	}
+	return nodes, errs
+}
+
+// ImportUserNodes adds nodes with the given ping mode. Already existing nodes
+// get new address and ping mode, their other settings are preserved.
+func ImportUserNodes(db *pg.DB, user *User, nodes []*BriefNode, pingMode string) ([]*Node, error) {
+	if len(nodes) > MaxImportedNodes {
+		return nil, ErrTooManyImportedNodes.Here()
+	}
+	res := make([]*Node, 0, len(nodes))
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		for _, brief := range nodes {
+			node := &Node{BriefNode: *brief, PingMode: pingMode}
+			_, err := tx.QueryOne(node, `
+				INSERT INTO user_nodes (node_id, user_id, address, ping_mode, details_updated_at)
+				VALUES (?, ?, ?, ?, now())
+				ON CONFLICT (node_id, user_id) DO UPDATE SET
+					address = EXCLUDED.address,
+					ping_mode = EXCLUDED.ping_mode,
+					details_updated_at = now()
+				RETURNING ping_proto, ping_all_sats, ping_interval`,
+				node.ID, user.ID, node.Address, node.PingMode)
+			if err != nil {
+				return merry.Wrap(err)
+			}
+			res = append(res, node)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return res, nil
+}
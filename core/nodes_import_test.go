@@ -0,0 +1,42 @@
+package core
+
+import (
+	"testing"
+
+	"storj.io/common/storj"
+)
+
+func TestParseNodeURLs(t *testing.T) {
+	id1 := storj.NodeID{1, 2, 3}
+	id2 := storj.NodeID{4, 5, 6}
+	lines := []string{
+		"# my nodes",
+		id1.String() + "@1.2.3.4:28967",
+		"",
+		"  " + id2.String() + " @ node.example.com:28968  ",
+		id1.String() + "@5.6.7.8:28967",
+		"12345@1.2.3.4:28967",
+		id2.String() + "@1.2.3.4",
+		"1.2.3.4:28967",
+	}
+	nodes, errs := ParseNodeURLs(lines)
+
+	if len(nodes) != 2 ||
+		nodes[0].ID != id1 || nodes[0].Address != "1.2.3.4:28967" ||
+		nodes[1].ID != id2 || nodes[1].Address != "node.example.com:28968" {
+		t.Errorf("unexpected nodes: %#v", nodes)
+	}
+
+	expected := []struct {
+		line int
+		code string
+	}{{5, "DUPLICATE_NODE"}, {6, "NODE_ID_DECODE_ERROR"}, {7, "WRONG_ADDRESS"}, {8, "WRONG_NODE_URL"}}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d: %#v", len(expected), len(errs), errs)
+	}
+	for i, exp := range expected {
+		if errs[i].Line != exp.line || errs[i].Error != exp.code {
+			t.Errorf("error #%d: expected line %d %s, got %#v", i, exp.line, exp.code, errs[i])
+		}
+	}
+}
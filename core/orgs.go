@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+)
+
+// Organization is a special users row (with is_org flag) that owns nodes and settings.
+// Its members work with them in org context with permissions defined by role.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleEditor = "editor"
+	OrgRoleViewer = "viewer"
+)
+
+const MaxUserOrgs = 10
+const MaxOrgMembers = 50
+
+var ErrTooManyOrgs = merry.New("too_many_orgs")
+var ErrTooManyOrgMembers = merry.New("too_many_org_members")
+var ErrOrgNotFound = merry.New("org_not_found")
+var ErrLastOrgOwner = merry.New("last_org_owner")
+
+type Org struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"` //role of the current user
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type OrgMember struct {
+	UserID    int64     `json:"userId"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func IsValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleEditor || role == OrgRoleViewer
+}
+
+func LoadUserOrgs(db *pg.DB, user *User) ([]*Org, error) {
+	orgs := make([]*Org, 0)
+	_, err := db.Query(&orgs, `
+		SELECT u.id, u.username AS name, m.role, u.created_at
+		FROM org_members AS m JOIN users AS u ON u.id = m.org_id
+		WHERE m.user_id = ? ORDER BY u.username`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return orgs, nil
+}
+
+// CreateOrg creates organization (name must not be taken by other orgs or users) with user as owner.
+func CreateOrg(db *pg.DB, user *User, name string) (*Org, error) {
+	org := &Org{Name: name, Role: OrgRoleOwner}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		_, err := tx.QueryOne(pg.Scan(&count), `
+			SELECT count(*) FROM org_members WHERE user_id = ? AND role = ?`, user.ID, OrgRoleOwner)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserOrgs {
+			return ErrTooManyOrgs.Here()
+		}
+		// password is random and never shown: org users can not log in (and are filtered out on login anyway)
+		_, err = tx.QueryOne(org, `
+			INSERT INTO users (username, password_hash, is_org)
+			VALUES (?, crypt(?, gen_salt('bf')), true)
+			RETURNING id, created_at`,
+			name, utils.RandHexString(32))
+		if utils.IsConstrError(err, "users", "unique_violation", "users_username_key") {
+			return ErrUsernameExsists.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		_, err = tx.Exec(`
+			INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)`,
+			org.ID, user.ID, OrgRoleOwner)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return org, nil
+}
+
+// FindOrgForMember returns organization pseudo-user and member role.
+// Returns ErrOrgNotFound if there is no such org or user is not its member.
+func FindOrgForMember(db *pg.DB, user *User, orgID int64) (*User, string, error) {
+	org := &User{}
+	var role string
+	_, err := db.QueryOne(pg.Scan(&org.ID, &org.Username, &org.CreatedAt, &role), `
+		SELECT u.id, u.username, u.created_at, m.role
+		FROM org_members AS m JOIN users AS u ON u.id = m.org_id
+		WHERE m.org_id = ? AND m.user_id = ? AND u.is_org`, orgID, user.ID)
+	if err == pg.ErrNoRows {
+		return nil, "", ErrOrgNotFound.Here()
+	}
+	if err != nil {
+		return nil, "", merry.Wrap(err)
+	}
+	org.IsOrg = true
+	return org, role, nil
+}
+
+func LoadOrgMembers(db *pg.DB, orgID int64) ([]*OrgMember, error) {
+	members := make([]*OrgMember, 0)
+	_, err := db.Query(&members, `
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM org_members AS m JOIN users AS u ON u.id = m.user_id
+		WHERE m.org_id = ? ORDER BY m.created_at`, orgID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return members, nil
+}
+
+// SetOrgMember adds user (by username) to the organization or changes its role.
+func SetOrgMember(db *pg.DB, orgID int64, username, role string) (*OrgMember, error) {
+	member := &OrgMember{Username: username, Role: role}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking org row to avoid concurrent inserts over limit and removal of all owners
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, orgID); err != nil {
+			return merry.Wrap(err)
+		}
+		_, err := tx.QueryOne(pg.Scan(&member.UserID), `
+			SELECT id FROM users WHERE username = ? AND NOT is_org`, username)
+		if err == pg.ErrNoRows {
+			return ErrUserNotFound.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		var isMember bool
+		_, err = tx.QueryOne(pg.Scan(&count, &isMember), `
+			SELECT count(*), coalesce(bool_or(user_id = ?), false) FROM org_members WHERE org_id = ?`,
+			member.UserID, orgID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if !isMember && count >= MaxOrgMembers {
+			return ErrTooManyOrgMembers.Here()
+		}
+		if role != OrgRoleOwner {
+			if err := checkNotLastOrgOwner(tx, orgID, member.UserID); err != nil {
+				return merry.Wrap(err)
+			}
+		}
+		_, err = tx.QueryOne(member, `
+			INSERT INTO org_members (org_id, user_id, role) VALUES (?, ?, ?)
+			ON CONFLICT (org_id, user_id) DO UPDATE SET role = EXCLUDED.role
+			RETURNING created_at`,
+			orgID, member.UserID, role)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return member, nil
+}
+
+// DelOrgMember removes user from the organization. The last owner can not be removed.
+func DelOrgMember(db *pg.DB, orgID, userID int64) error {
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, orgID); err != nil {
+			return merry.Wrap(err)
+		}
+		if err := checkNotLastOrgOwner(tx, orgID, userID); err != nil {
+			return merry.Wrap(err)
+		}
+		_, err := tx.Exec(`DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+		return merry.Wrap(err)
+	}))
+}
+
+// checkNotLastOrgOwner returns ErrLastOrgOwner if user is the only owner of the org
+func checkNotLastOrgOwner(tx *pg.Tx, orgID, userID int64) error {
+	var isLast bool
+	_, err := tx.QueryOne(pg.Scan(&isLast), `
+		SELECT EXISTS (SELECT 1 FROM org_members WHERE org_id = ?0 AND user_id = ?1 AND role = ?2)
+			AND NOT EXISTS (SELECT 1 FROM org_members WHERE org_id = ?0 AND user_id != ?1 AND role = ?2)`,
+		orgID, userID, OrgRoleOwner)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if isLast {
+		return ErrLastOrgOwner.Here()
+	}
+	return nil
+}
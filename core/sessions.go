@@ -0,0 +1,175 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/rs/zerolog/log"
+)
+
+// UserSession is created on each login, sessid is stored in the cookie.
+type UserSession struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	Sessid     string    `json:"-"`
+	UserAgent  string    `json:"userAgent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	IsCurrent  bool      `json:"isCurrent" pg:"-"`
+}
+
+var trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets reverse proxies (IPs or CIDRs) allowed to pass client IP in X-Real-IP header.
+// Loopback addresses are always trusted.
+func SetTrustedProxies(addrs []string) error {
+	nets := make([]*net.IPNet, 0, len(addrs))
+	for _, addr := range addrs {
+		if !strings.Contains(addr, "/") {
+			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+				addr += "/32"
+			} else {
+				addr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(addr)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		nets = append(nets, ipNet)
+	}
+	trustedProxies = nets
+	return nil
+}
+
+func isTrustedProxy(ip net.IP) bool {
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestIP returns client IP: remote address or X-Real-IP header if the request came from a trusted proxy.
+func RequestIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	remoteIP := net.ParseIP(host)
+	if err != nil || remoteIP == nil {
+		return ""
+	}
+	if isTrustedProxy(remoteIP) {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+	}
+	return remoteIP.String()
+}
+
+func requestUserAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	return ua
+}
+
+func setSessionCookie(wr http.ResponseWriter, sessid string) {
+	cookie := &http.Cookie{
+		Name:     "sessid",
+		Value:    sessid,
+		Path:     "/",
+		Expires:  time.Now().Add(SessionDuration),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	wr.Header().Set("Set-Cookie", cookie.String())
+}
+
+func ClearSessionCookie(wr http.ResponseWriter) {
+	cookie := &http.Cookie{Name: "sessid", Value: "", Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode}
+	wr.Header().Set("Set-Cookie", cookie.String())
+}
+
+// StartUserSession creates new session (with new sessid) and sets session cookie.
+func StartUserSession(db pg.DBI, wr http.ResponseWriter, r *http.Request, user *User) (*UserSession, error) {
+	session := &UserSession{}
+	_, err := db.QueryOne(session, `
+		INSERT INTO user_sessions (user_id, user_agent, ip) VALUES (?, ?, NULLIF(?, '')::inet)
+		RETURNING *`,
+		user.ID, requestUserAgent(r), RequestIP(r))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	setSessionCookie(wr, session.Sessid)
+	return session, nil
+}
+
+// UpdateSessionData prolongs session cookie and updates session last seen time, IP and user agent (if needed).
+func UpdateSessionData(db *pg.DB, wr http.ResponseWriter, r *http.Request, session *UserSession) {
+	setSessionCookie(wr, session.Sessid)
+	ip := RequestIP(r)
+	userAgent := requestUserAgent(r)
+	if time.Since(session.LastSeenAt) < time.Minute && ip == session.IP && userAgent == session.UserAgent {
+		return
+	}
+	id := session.ID
+	go func() {
+		_, err := db.Exec(`
+			UPDATE user_sessions SET last_seen_at = NOW(), ip = NULLIF(?, '')::inet, user_agent = ?
+			WHERE id = ?`, ip, userAgent, id)
+		if err != nil {
+			log.Error().Err(err).Int64("session_id", id).Msg("failed to update session")
+		}
+	}()
+}
+
+// LoadUserSessions returns active user sessions, current one (if not nil) is marked with IsCurrent.
+func LoadUserSessions(db *pg.DB, user *User, current *UserSession) ([]*UserSession, error) {
+	sessions := make([]*UserSession, 0)
+	_, err := db.Query(&sessions, `
+		SELECT * FROM user_sessions
+		WHERE user_id = ? AND last_seen_at > NOW() - ? * INTERVAL '1 second'
+		ORDER BY last_seen_at DESC`,
+		user.ID, int64(SessionDuration/time.Second))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	for _, s := range sessions {
+		s.IsCurrent = current != nil && s.ID == current.ID
+	}
+	return sessions, nil
+}
+
+func DelUserSession(db *pg.DB, user *User, sessionID int64) error {
+	_, err := db.Exec(`DELETE FROM user_sessions WHERE id = ? AND user_id = ?`, sessionID, user.ID)
+	return merry.Wrap(err)
+}
+
+// DelExpiredUserSessions removes sessions not used for SessionDuration (they can not be used anymore), returns removed count.
+func DelExpiredUserSessions(db *pg.DB) (int, error) {
+	res, err := db.Exec(`DELETE FROM user_sessions WHERE last_seen_at <= NOW() - ? * INTERVAL '1 second'`,
+		int64(SessionDuration/time.Second))
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	return res.RowsAffected(), nil
+}
+
+// DelOtherUserSessions logs out everywhere except the current session (all sessions if current is nil).
+func DelOtherUserSessions(db pg.DBI, user *User, current *UserSession) error {
+	currentID := int64(0)
+	if current != nil {
+		currentID = current.ID
+	}
+	_, err := db.Exec(`DELETE FROM user_sessions WHERE user_id = ? AND id != ?`, user.ID, currentID)
+	return merry.Wrap(err)
+}
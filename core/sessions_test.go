@@ -0,0 +1,73 @@
+package core
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+func TestRequestIP(t *testing.T) {
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTrustedProxies(nil)
+
+	for _, c := range []struct{ remoteAddr, realIP, expected string }{
+		{"1.2.3.4:5678", "", "1.2.3.4"},
+		{"1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"127.0.0.1:5678", "5.6.7.8", "5.6.7.8"},
+		{"[::1]:5678", "5.6.7.8", "5.6.7.8"},
+		{"10.1.2.3:5678", "5.6.7.8", "5.6.7.8"},
+		{"192.168.1.5:5678", "5.6.7.8", "5.6.7.8"},
+		{"192.168.1.6:5678", "5.6.7.8", "192.168.1.6"},
+		{"127.0.0.1:5678", "garbage", "127.0.0.1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remoteAddr
+		if c.realIP != "" {
+			r.Header.Set("X-Real-IP", c.realIP)
+		}
+		if ip := RequestIP(r); ip != c.expected {
+			t.Errorf("%s, X-Real-IP %q: expected %s, got %s", c.remoteAddr, c.realIP, c.expected, ip)
+		}
+	}
+}
+
+func TestDelExpiredUserSessions(t *testing.T) {
+	db := testDB(t)
+	user := createTestUser(t, db, "pass", false)
+	newSession := func() *UserSession {
+		session, err := StartUserSession(db, httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	active := newSession()
+	expired := newSession()
+	_, err := db.Exec(`UPDATE user_sessions SET last_seen_at = NOW() - ? * INTERVAL '1 second' WHERE id = ?`,
+		int64((SessionDuration+time.Minute)/time.Second), expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DelExpiredUserSessions(db); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := LoadUserSessions(db, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != active.ID {
+		t.Errorf("expected only active session to be left, got %+v", sessions)
+	}
+	var count int
+	if _, err := db.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_sessions WHERE id = ?`, expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("expired session is not deleted")
+	}
+}
@@ -2,10 +2,11 @@ package core
 
 import "time"
 
+// StorjTokenTxSummary contains hourly (24 items) STORJ transaction sums for a day.
 type StorjTokenTxSummary struct {
-	Date         time.Time
-	Preparings   []float32 `pg:",array"`
-	Payouts      []float32 `pg:",array"`
-	PayoutCounts []int32   `pg:",array"`
-	Withdrawals  []float32 `pg:",array"`
+	Date         time.Time `json:"date"`
+	Preparings   []float32 `json:"preparings" pg:",array"`
+	Payouts      []float32 `json:"payouts" pg:",array"`
+	PayoutCounts []int32   `json:"payoutCounts" pg:",array"`
+	Withdrawals  []float32 `json:"withdrawals" pg:",array"`
 }
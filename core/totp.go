@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"image/png"
+	"storjnet/utils"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/pquerna/otp/totp"
+)
+
+const TOTPIssuer = "storjnet.info"
+const TOTPPeriod = 30 * time.Second
+const TOTPRecoveryCodesCount = 10
+
+var ErrTOTPRequired = merry.New("totp_required")
+var ErrWrongTOTPCode = merry.New("wrong_totp_code")
+var ErrTOTPAlreadyEnabled = merry.New("totp_already_enabled")
+var ErrTOTPNotEnabled = merry.New("totp_not_enabled")
+var ErrTOTPSetupNotStarted = merry.New("totp_setup_not_started")
+
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	URL    string `json:"url"`
+	QRCode string `json:"qrCode"` //PNG data URL
+}
+
+type TOTPStatus struct {
+	Enabled           bool  `json:"enabled"`
+	RecoveryCodesLeft int64 `json:"recoveryCodesLeft"`
+}
+
+func (u *User) HasTOTP() bool {
+	return u.TOTPSecret != ""
+}
+
+// totpCodeStep returns time step of the code if it is valid at the given time.
+// Codes from the previous and the next steps are accepted too (clock drift).
+func totpCodeStep(secret, code string, now time.Time) (int64, bool) {
+	for _, delta := range []int64{0, -1, 1} {
+		t := now.Add(time.Duration(delta) * TOTPPeriod)
+		expected, err := totp.GenerateCode(secret, t)
+		if err == nil && expected == code {
+			return t.Unix() / int64(TOTPPeriod/time.Second), true
+		}
+	}
+	return 0, false
+}
+
+// normalizeRecoveryCode removes separators and case differences, so "ABCDE-12345" matches "abcde12345"
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+func hashRecoveryCode(code string) []byte {
+	hash := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hash[:]
+}
+
+// checkTOTPCode checks TOTP code (or one of recovery codes) of the user with enabled 2FA.
+// Each TOTP code may be used only once, used recovery codes are deleted.
+func checkTOTPCode(tx *pg.Tx, userID int64, code string) error {
+	var secret string
+	var lastStep int64
+	_, err := tx.QueryOne(pg.Scan(&secret, &lastStep), `
+		SELECT totp_secret, totp_last_step FROM users WHERE id = ? FOR UPDATE`, userID)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if secret == "" {
+		return ErrTOTPNotEnabled.Here()
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := totpCodeStep(secret, strings.ReplaceAll(code, " ", ""), time.Now()); ok {
+		if step <= lastStep {
+			return ErrWrongTOTPCode.Here()
+		}
+		_, err := tx.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ?`, step, userID)
+		return merry.Wrap(err)
+	}
+
+	res, err := tx.Exec(`
+		DELETE FROM user_totp_recovery_codes WHERE user_id = ? AND code_hash = ?`,
+		userID, hashRecoveryCode(code))
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrWrongTOTPCode.Here()
+	}
+	return nil
+}
+
+// CheckUserTOTPCode is used on login as a second step after password check.
+func CheckUserTOTPCode(db *pg.DB, user *User, code string) error {
+	if code == "" {
+		return ErrTOTPRequired.Here()
+	}
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		return merry.Wrap(checkTOTPCode(tx, user.ID, code))
+	}))
+}
+
+func LoadUserTOTPStatus(db *pg.DB, user *User) (*TOTPStatus, error) {
+	status := &TOTPStatus{Enabled: user.HasTOTP()}
+	_, err := db.QueryOne(pg.Scan(&status.RecoveryCodesLeft), `
+		SELECT count(*) FROM user_totp_recovery_codes WHERE user_id = ?`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return status, nil
+}
+
+// StartTOTPSetup generates a new secret. It is saved as pending and
+// becomes active after confirmation with a valid code (see EnableTOTP).
+func StartTOTPSetup(db *pg.DB, user *User) (*TOTPSetup, error) {
+	if user.HasTOTP() {
+		return nil, ErrTOTPAlreadyEnabled.Here()
+	}
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: TOTPIssuer, AccountName: user.Username})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	_, err = db.Exec(`UPDATE users SET totp_pending_secret = ? WHERE id = ?`, key.Secret(), user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return &TOTPSetup{
+		Secret: key.Secret(),
+		URL:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}, nil
+}
+
+// EnableTOTP activates pending secret if the code is valid. Returns new recovery codes
+// (they are stored hashed and can not be shown again).
+func EnableTOTP(db *pg.DB, user *User, code string) ([]string, error) {
+	var recoveryCodes []string
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var secret, pendingSecret string
+		_, err := tx.QueryOne(pg.Scan(&secret, &pendingSecret), `
+			SELECT totp_secret, totp_pending_secret FROM users WHERE id = ? FOR UPDATE`, user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if secret != "" {
+			return ErrTOTPAlreadyEnabled.Here()
+		}
+		if pendingSecret == "" {
+			return ErrTOTPSetupNotStarted.Here()
+		}
+		step, ok := totpCodeStep(pendingSecret, strings.ReplaceAll(code, " ", ""), time.Now())
+		if !ok {
+			return ErrWrongTOTPCode.Here()
+		}
+
+		_, err = tx.QueryOne(user, `
+			UPDATE users SET totp_secret = totp_pending_secret, totp_pending_secret = NULL, totp_last_step = ?
+			WHERE id = ? RETURNING *`, step, user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		recoveryCodes, err = setTOTPRecoveryCodes(tx, user.ID)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return recoveryCodes, nil
+}
+
+// RegenerateTOTPRecoveryCodes replaces all recovery codes with new ones (code confirmation is required).
+func RegenerateTOTPRecoveryCodes(db *pg.DB, user *User, code string) ([]string, error) {
+	var recoveryCodes []string
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if err := checkTOTPCode(tx, user.ID, code); err != nil {
+			return merry.Wrap(err)
+		}
+		var err error
+		recoveryCodes, err = setTOTPRecoveryCodes(tx, user.ID)
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return recoveryCodes, nil
+}
+
+// DisableTOTP turns 2FA off if the code (or a recovery code) is valid.
+func DisableTOTP(db *pg.DB, user *User, code string) error {
+	return merry.Wrap(db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if err := checkTOTPCode(tx, user.ID, code); err != nil {
+			return merry.Wrap(err)
+		}
+		_, err := tx.QueryOne(user, `
+			UPDATE users SET totp_secret = NULL, totp_pending_secret = NULL, totp_last_step = 0
+			WHERE id = ? RETURNING *`, user.ID)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		_, err = tx.Exec(`DELETE FROM user_totp_recovery_codes WHERE user_id = ?`, user.ID)
+		return merry.Wrap(err)
+	}))
+}
+
+func setTOTPRecoveryCodes(tx *pg.Tx, userID int64) ([]string, error) {
+	_, err := tx.Exec(`DELETE FROM user_totp_recovery_codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	codes := make([]string, TOTPRecoveryCodesCount)
+	for i := range codes {
+		code := utils.RandHexString(10)
+		codes[i] = code[:5] + "-" + code[5:]
+		_, err := tx.Exec(`
+			INSERT INTO user_totp_recovery_codes (user_id, code_hash) VALUES (?, ?)`,
+			userID, hashRecoveryCode(codes[i]))
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+	return codes, nil
+}
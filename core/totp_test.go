@@ -0,0 +1,49 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+func TestTOTPCodeStep(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	nowStep := now.Unix() / 30
+
+	for _, delta := range []int64{-1, 0, 1} {
+		code, err := totp.GenerateCode(secret, now.Add(time.Duration(delta)*TOTPPeriod))
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := totpCodeStep(secret, code, now)
+		if !ok || step != nowStep+delta {
+			t.Errorf("delta %d: expected step %d, got %d %v", delta, nowStep+delta, step, ok)
+		}
+	}
+
+	oldCode, err := totp.GenerateCode(secret, now.Add(-2*TOTPPeriod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := totpCodeStep(secret, oldCode, now); ok {
+		t.Errorf("outdated code %s should not be accepted", oldCode)
+	}
+	if _, ok := totpCodeStep(secret, "", now); ok {
+		t.Errorf("empty code should not be accepted")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	hash := hashRecoveryCode("abcde-12345")
+	for _, code := range []string{"ABCDE-12345", "abcde12345", " abcde 12345 "} {
+		if !bytes.Equal(hashRecoveryCode(code), hash) {
+			t.Errorf("%q should match abcde-12345", code)
+		}
+	}
+	if bytes.Equal(hashRecoveryCode("abcde-12346"), hash) {
+		t.Errorf("different codes should not match")
+	}
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+type UserNodeUptimeReport struct {
+	NodeID               storj.NodeID `json:"nodeId"`
+	Address              string       `json:"address"`
+	Month                string       `json:"month"`
+	CheckedMinutes       int64        `json:"checkedMinutes"`
+	DownMinutes          int64        `json:"downMinutes"`
+	MaintenanceMinutes   int64        `json:"maintenanceMinutes"`
+	UptimePercent        float64      `json:"uptimePercent"`
+	OutagesCount         int64        `json:"outagesCount"`
+	LongestOutageMinutes int64        `json:"longestOutageMinutes"`
+	MedianPing           int64        `json:"medianPing"`
+	P95Ping              int64        `json:"p95Ping"`
+}
+
+// fillFromHistories calculates report stats. Histories must be sorted by date.
+// Items without data and items from maintenance windows are skipped (they neither break nor extend outages).
+func (r *UserNodeUptimeReport) fillFromHistories(histories []*UserNodeHistory) {
+	var pings []int64
+	upMinutes := int64(0)
+	curOutage := int64(0)
+	for _, hist := range histories {
+		resolution := hist.Resolution
+		if resolution <= 0 {
+			resolution = 1
+		}
+		for _, value := range hist.Pings {
+			ping, _, isMaintenance := DecodeHistoryPing(value)
+			if isMaintenance {
+				r.MaintenanceMinutes += resolution
+				continue
+			}
+			switch ping {
+			case HistoryPingNoData:
+				continue
+			case HistoryPingFail:
+				if curOutage == 0 {
+					r.OutagesCount++
+				}
+				curOutage += resolution
+				r.DownMinutes += resolution
+				if curOutage > r.LongestOutageMinutes {
+					r.LongestOutageMinutes = curOutage
+				}
+			default:
+				curOutage = 0
+				upMinutes += resolution
+				pings = append(pings, ping)
+			}
+		}
+	}
+	r.CheckedMinutes = upMinutes + r.DownMinutes
+	if r.CheckedMinutes > 0 {
+		r.UptimePercent = math.Round(float64(upMinutes)/float64(r.CheckedMinutes)*100*1000) / 1000
+	}
+	sort.Slice(pings, func(i, j int) bool { return pings[i] < pings[j] })
+	r.MedianPing = percentile(pings, 0.5)
+	r.P95Ping = percentile(pings, 0.95)
+}
+
+// percentile returns nearest-rank percentile of sorted values (0 for empty slice)
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// LoadUserNodesUptimeReport calculates uptime stats of each user node for the calendar month (UTC)
+// containing monthStart.
+func LoadUserNodesUptimeReport(db *pg.DB, user *User, monthStart time.Time) ([]*UserNodeUptimeReport, error) {
+	monthStart = time.Date(monthStart.Year(), monthStart.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+
+	nodes, err := LoadUserNodes(db, user, "")
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	var histories []*UserNodeHistory
+	_, err = db.Query(&histories, `
+		SELECT node_id AS raw_node_id, date, resolution, pings FROM user_nodes_history
+		WHERE user_id = ? AND date >= ? AND date < ?
+		ORDER BY node_id, date`,
+		user.ID, monthStart.Format("2006-01-02"), monthEnd.Format("2006-01-02"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	reports := make([]*UserNodeUptimeReport, len(nodes))
+	for i, node := range nodes {
+		var nodeHistories []*UserNodeHistory
+		for _, hist := range histories {
+			if bytes.Equal(hist.RawNodeID, node.RawID) {
+				nodeHistories = append(nodeHistories, hist)
+			}
+		}
+		reports[i] = &UserNodeUptimeReport{
+			NodeID:  node.ID,
+			Address: node.Address,
+			Month:   monthStart.Format("2006-01"),
+		}
+		reports[i].fillFromHistories(nodeHistories)
+	}
+	return reports, nil
+}
+
+// RollingUptimeWindows are periods (up to now) of user nodes rolling uptime.
+var RollingUptimeWindows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour}
+
+// rollingUptime returns share (0-1) of successful checks made since the given time
+// (weighted by history resolution, maintenance checks are skipped) and false if there were no checks.
+func rollingUptime(histories []*UserNodeHistory, since time.Time) (float64, bool) {
+	upMinutes, checkedMinutes := int64(0), int64(0)
+	for _, hist := range histories {
+		resolution := hist.Resolution
+		if resolution <= 0 {
+			resolution = 1
+		}
+		for _, rec := range DecodeHistoryPings(hist.Date, resolution, hist.Pings) {
+			if rec.Maintenance || rec.Time.Before(since) {
+				continue
+			}
+			checkedMinutes += resolution
+			if rec.Ok {
+				upMinutes += resolution
+			}
+		}
+	}
+	if checkedMinutes == 0 {
+		return 0, false
+	}
+	return float64(upMinutes) / float64(checkedMinutes), true
+}
+
+// LoadUserNodesRollingUptime returns rolling uptime of user nodes for each of RollingUptimeWindows.
+// Nodes (and windows) without checks are absent.
+func LoadUserNodesRollingUptime(db *pg.DB, user *User, now time.Time) (map[storj.NodeID]map[time.Duration]float64, error) {
+	maxWindow := RollingUptimeWindows[len(RollingUptimeWindows)-1]
+	var histories []*UserNodeHistory
+	_, err := db.Query(&histories, `
+		SELECT node_id AS raw_node_id, date, resolution, pings FROM user_nodes_history
+		WHERE user_id = ? AND date >= ?
+		ORDER BY node_id, date`,
+		user.ID, now.Add(-maxWindow).In(time.UTC).Format("2006-01-02"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	nodeHistories := make(map[storj.NodeID][]*UserNodeHistory)
+	for _, hist := range histories {
+		nodeID, err := storj.NodeIDFromBytes(hist.RawNodeID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		nodeHistories[nodeID] = append(nodeHistories[nodeID], hist)
+	}
+
+	res := make(map[storj.NodeID]map[time.Duration]float64, len(nodeHistories))
+	for nodeID, hists := range nodeHistories {
+		for _, window := range RollingUptimeWindows {
+			if uptime, ok := rollingUptime(hists, now.Add(-window)); ok {
+				if res[nodeID] == nil {
+					res[nodeID] = make(map[time.Duration]float64, len(RollingUptimeWindows))
+				}
+				res[nodeID][window] = uptime
+			}
+		}
+	}
+	return res, nil
+}
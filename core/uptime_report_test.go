@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserNodeUptimeReport_fillFromHistories(t *testing.T) {
+	const ok, fail, none = 2000*3 + 40, 2000*7 + 1, 0
+
+	histories := []*UserNodeHistory{
+		{Resolution: 1, Pings: []int16{ok, fail, fail, none, fail, 2000 + 60, 120, fail}},
+		// outage continues from the previous day
+		{Resolution: 5, Pings: []int16{fail, fail, ok, none, 30, -fail, -ok}},
+	}
+	var r UserNodeUptimeReport
+	r.fillFromHistories(histories)
+
+	if r.DownMinutes != 4+10 {
+		t.Errorf("down minutes: %d", r.DownMinutes)
+	}
+	if r.CheckedMinutes != 3+4+10+10 {
+		t.Errorf("checked minutes: %d", r.CheckedMinutes)
+	}
+	if r.MaintenanceMinutes != 10 {
+		t.Errorf("maintenance minutes: %d", r.MaintenanceMinutes)
+	}
+	if r.OutagesCount != 2 {
+		t.Errorf("outages count: %d", r.OutagesCount)
+	}
+	if r.LongestOutageMinutes != 1+10 {
+		t.Errorf("longest outage: %d", r.LongestOutageMinutes)
+	}
+	if r.UptimePercent != 48.148 {
+		t.Errorf("uptime: %f", r.UptimePercent)
+	}
+	// pings: 30 40 40 60 120
+	if r.MedianPing != 40 || r.P95Ping != 120 {
+		t.Errorf("median/p95: %d/%d", r.MedianPing, r.P95Ping)
+	}
+}
+
+func TestRollingUptime(t *testing.T) {
+	const ok, fail = 40, 1
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	histories := []*UserNodeHistory{
+		{Date: day, Resolution: 5, Pings: []int16{fail, ok, ok, 0, -fail}},
+		{Date: day.AddDate(0, 0, 1), Resolution: 1, Pings: []int16{ok, fail, ok, ok}},
+	}
+
+	uptime, hasChecks := rollingUptime(histories, day)
+	if !hasChecks || uptime != float64(10+3)/float64(15+4) {
+		t.Errorf("full uptime: %f %v", uptime, hasChecks)
+	}
+	uptime, hasChecks = rollingUptime(histories, day.AddDate(0, 0, 1).Add(time.Minute))
+	if !hasChecks || uptime != 2.0/3.0 {
+		t.Errorf("last day uptime: %f %v", uptime, hasChecks)
+	}
+	if _, hasChecks = rollingUptime(histories, day.AddDate(0, 0, 2)); hasChecks {
+		t.Errorf("expected no checks")
+	}
+}
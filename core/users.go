@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"net/http"
 	"storjnet/utils"
 	"strings"
@@ -22,56 +23,89 @@ type User struct {
 	Email        string
 	Username     string
 	PasswordHash string
-	Sessid       string
+	IsOrg        bool // organization pseudo-user, can not log in, owns nodes of its members (see OrgMember)
 	CreatedAt    time.Time
 	LastSeenAt   time.Time
+
+	TOTPSecret        string // empty if 2FA is disabled
+	TOTPPendingSecret string // generated on 2FA setup, becomes TOTPSecret after confirmation
+	TOTPLastStep      int64  // time step of the last accepted TOTP code, prevents code reuse
 }
 
-func RegisterUser(db *pg.DB, wr http.ResponseWriter, username, password string) (*User, error) {
+func RegisterUser(db *pg.DB, wr http.ResponseWriter, r *http.Request, username, password string) (*User, error) {
 	user := &User{}
-	_, err := db.QueryOne(user,
-		"INSERT INTO users (username, password_hash, sessid) VALUES (?, crypt(?, gen_salt('bf')), gen_random_uuid()) RETURNING *",
-		username, password)
-	if utils.IsConstrError(err, "users", "unique_violation", "users_username_key") {
-		return nil, ErrUsernameExsists.Here()
-	}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.QueryOne(user,
+			"INSERT INTO users (username, password_hash) VALUES (?, crypt(?, gen_salt('bf'))) RETURNING *",
+			username, password)
+		if utils.IsConstrError(err, "users", "unique_violation", "users_username_key") {
+			return ErrUsernameExsists.Here()
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		_, err = StartUserSession(tx, wr, r, user)
+		return merry.Wrap(err)
+	})
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	setSessionCookie(wr, user.Sessid)
 	return user, nil
 }
 
-func LoginUser(db *pg.DB, wr http.ResponseWriter, username, password string) (*User, error) {
+// LoginUser checks password and (if 2FA is enabled) TOTP or recovery code, then starts a new session.
+// Returns ErrTOTPRequired if the password is correct but the code is missing.
+func LoginUser(db *pg.DB, wr http.ResponseWriter, r *http.Request, username, password, totpCode string) (*User, error) {
 	user, err := FindUserByUsernameAndPassword(db, username, password)
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	setSessionCookie(wr, user.Sessid)
+	if user.HasTOTP() {
+		if err := CheckUserTOTPCode(db, user, totpCode); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+	if _, err := StartUserSession(db, wr, r, user); err != nil {
+		return nil, merry.Wrap(err)
+	}
 	UpdateUserLastSeenAtIfNeed(db, user)
 	return user, nil
 }
 
-func FindUserBySessid(db *pg.DB, sessid string) (*User, error) {
-	user := &User{}
-	err := db.Model(user).Where("sessid = ?", sessid).Select()
+// FindUserBySessid returns user and session by session cookie value.
+// Sessions unused for SessionDuration are considered expired.
+func FindUserBySessid(db *pg.DB, sessid string) (*User, *UserSession, error) {
+	session := &UserSession{}
+	_, err := db.QueryOne(session, `
+		SELECT * FROM user_sessions
+		WHERE sessid = ? AND last_seen_at > NOW() - ? * INTERVAL '1 second'`,
+		sessid, int64(SessionDuration/time.Second))
 	if err == pg.ErrNoRows {
-		return nil, ErrUserNotFound.Here()
+		return nil, nil, ErrUserNotFound.Here()
 	}
 	if perr, ok := merry.Unwrap(err).(pg.Error); ok {
 		if strings.HasPrefix(perr.Field('M'), "invalid input syntax for type uuid:") {
-			return nil, ErrUserNotFound.Here()
+			return nil, nil, ErrUserNotFound.Here()
 		}
 	}
 	if err != nil {
-		return nil, merry.Wrap(err)
+		return nil, nil, merry.Wrap(err)
 	}
-	return user, nil
+
+	user := &User{}
+	err = db.Model(user).Where("id = ? AND NOT is_org", session.UserID).Select()
+	if err == pg.ErrNoRows {
+		return nil, nil, ErrUserNotFound.Here()
+	}
+	if err != nil {
+		return nil, nil, merry.Wrap(err)
+	}
+	return user, session, nil
 }
 
 func FindUserByUsernameAndPassword(db *pg.DB, username, password string) (*User, error) {
 	user := &User{}
-	err := db.Model(user).Where("username = ? AND password_hash = crypt(?, password_hash)", username, password).Select()
+	err := db.Model(user).Where("username = ? AND NOT is_org AND password_hash = crypt(?, password_hash)", username, password).Select()
 	if err == pg.ErrNoRows {
 		return nil, ErrUserNotFound.Here()
 	}
@@ -81,23 +115,6 @@ func FindUserByUsernameAndPassword(db *pg.DB, username, password string) (*User,
 	return user, nil
 }
 
-func UpdateSessionData(db *pg.DB, wr http.ResponseWriter, user *User) error {
-	setSessionCookie(wr, user.Sessid)
-	return nil
-}
-
-func setSessionCookie(wr http.ResponseWriter, sessid string) {
-	cookie := &http.Cookie{
-		Name:     "sessid",
-		Value:    sessid,
-		Path:     "/",
-		Expires:  time.Now().Add(SessionDuration),
-		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
-	}
-	wr.Header().Set("Set-Cookie", cookie.String())
-}
-
 func UpdateUserLastSeenAtIfNeed(db *pg.DB, user *User) {
 	if time.Since(user.LastSeenAt) < time.Minute {
 		return
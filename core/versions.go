@@ -40,6 +40,7 @@ type VersionChecker interface {
 	SaveCurVersion() error
 	DebugVersions() (string, string)
 	MessageNew() string
+	EmailNew(lang string) (string, string)
 	MessageCur() string
 }
 
@@ -142,6 +143,21 @@ func (c *StrojIoVersionChecker) MessageNew() string {
 		c.curVersion.Version, c.curVersion.Cursor)
 }
 
+func (c *StrojIoVersionChecker) EmailNew(lang string) (string, string) {
+	if c.curVersion.Version.Equals(c.prevVersion.Version) && c.curVersion.Cursor.IsFinal() {
+		subject := fmt.Sprintf(loc(lang, "Final cursor for v%s", "Финальный курсор для v%s"), c.curVersion.Version)
+		return subject, fmt.Sprintf(loc(lang,
+			"Final cursor %s (v%s) on version.storj.io\n\nhttps://version.storj.io",
+			"Финальный курсор %s (v%s) на version.storj.io\n\nhttps://version.storj.io"),
+			c.curVersion.Cursor, c.curVersion.Version)
+	}
+	subject := fmt.Sprintf(loc(lang, "New version v%s", "Новая версия v%s"), c.curVersion.Version)
+	return subject, fmt.Sprintf(loc(lang,
+		"New version v%s (cursor: %s)\nRecommended for nodes on version.storj.io\n\nhttps://version.storj.io",
+		"Новая версия v%s (cursor: %s)\nРекомендуемая для нод на version.storj.io\n\nhttps://version.storj.io"),
+		c.curVersion.Version, c.curVersion.Cursor)
+}
+
 func (c *StrojIoVersionChecker) MessageCur() string {
 	return fmt.Sprintf("%s (version.storj.io)", c.curVersion.VString())
 }
@@ -220,6 +236,14 @@ func (c *GitHubVersionChecker) MessageNew() string {
 	return fmt.Sprintf("Новый релиз *v%s*\nНа [ГитХабе](https://github.com/storj/storj/releases/tag/v%s), с ченджлогом и бинарниками.", c.curVersion, c.curVersion)
 }
 
+func (c *GitHubVersionChecker) EmailNew(lang string) (string, string) {
+	subject := fmt.Sprintf(loc(lang, "New release v%s", "Новый релиз v%s"), c.curVersion)
+	return subject, fmt.Sprintf(loc(lang,
+		"New release v%s\nOn GitHub, with changelog and binaries:\nhttps://github.com/storj/storj/releases/tag/v%s",
+		"Новый релиз v%s\nНа ГитХабе, с ченджлогом и бинарниками:\nhttps://github.com/storj/storj/releases/tag/v%s"),
+		c.curVersion, c.curVersion)
+}
+
 func (c *GitHubVersionChecker) MessageCur() string {
 	return fmt.Sprintf("v%s ([GitHub](https://github.com/storj/storj/releases/tag/v%s))", c.curVersion, c.curVersion)
 }
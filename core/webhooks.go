@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"storj.io/common/storj"
+)
+
+const MaxUserWebhooks = 5
+
+var ErrTooManyWebhooks = merry.New("too_many_webhooks")
+
+type UserWebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   UserWebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered UserWebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    UserWebhookDeliveryStatus = "failed"
+)
+
+type UserWebhookDelivery struct {
+	ID            int64                     `json:"id"`
+	WebhookID     int64                     `json:"-"`
+	EventID       int64                     `json:"eventId"`
+	EventKind     UserNodeEventKind         `json:"eventKind"`
+	RawNodeID     []byte                    `json:"-"`
+	NodeID        storj.NodeID              `json:"nodeId"`
+	Attempts      int64                     `json:"attempts"`
+	NextAttemptAt time.Time                 `json:"nextAttemptAt"`
+	DeliveredAt   time.Time                 `json:"deliveredAt"`
+	FailedAt      time.Time                 `json:"failedAt"`
+	LastStatus    int64                     `json:"lastStatus"`
+	LastError     string                    `json:"lastError"`
+	CreatedAt     time.Time                 `json:"createdAt"`
+	Status        UserWebhookDeliveryStatus `json:"status" pg:"-"`
+}
+
+type UserWebhook struct {
+	ID         int64                  `json:"id"`
+	URL        string                 `json:"url"`
+	Secret     string                 `json:"secret"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	Deliveries []*UserWebhookDelivery `json:"deliveries" pg:"-"`
+}
+
+func (d *UserWebhookDelivery) updateStatus() {
+	switch {
+	case !d.DeliveredAt.IsZero():
+		d.Status = WebhookDeliveryDelivered
+	case !d.FailedAt.IsZero():
+		d.Status = WebhookDeliveryFailed
+	default:
+		d.Status = WebhookDeliveryPending
+	}
+}
+
+// LoadUserWebhooks returns user webhooks, each with some recent deliveries.
+func LoadUserWebhooks(db *pg.DB, user *User, deliveriesLimit int) ([]*UserWebhook, error) {
+	webhooks := make([]*UserWebhook, 0)
+	_, err := db.Query(&webhooks, `
+		SELECT id, url, secret, created_at FROM user_webhooks
+		WHERE user_id = ? ORDER BY id`, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if len(webhooks) == 0 {
+		return webhooks, nil
+	}
+
+	var deliveries []*UserWebhookDelivery
+	_, err = db.Query(&deliveries, `
+		SELECT d.*, e.kind AS event_kind, e.node_id AS raw_node_id
+		FROM user_webhooks AS w
+		CROSS JOIN LATERAL (
+			SELECT * FROM user_webhook_deliveries WHERE webhook_id = w.id
+			ORDER BY id DESC LIMIT ?
+		) AS d
+		JOIN user_node_events AS e ON e.id = d.event_id
+		WHERE w.user_id = ?
+		ORDER BY d.id DESC`,
+		deliveriesLimit, user.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	webhookByID := make(map[int64]*UserWebhook, len(webhooks))
+	for _, webhook := range webhooks {
+		webhook.Deliveries = make([]*UserWebhookDelivery, 0)
+		webhookByID[webhook.ID] = webhook
+	}
+	for _, delivery := range deliveries {
+		delivery.NodeID, err = storj.NodeIDFromBytes(delivery.RawNodeID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		delivery.updateStatus()
+		webhook := webhookByID[delivery.WebhookID]
+		webhook.Deliveries = append(webhook.Deliveries, delivery)
+	}
+	return webhooks, nil
+}
+
+func AddUserWebhook(db *pg.DB, user *User, url string) (*UserWebhook, error) {
+	webhook := &UserWebhook{Deliveries: make([]*UserWebhookDelivery, 0)}
+	err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// locking user row to avoid concurrent inserts over limit
+		if _, err := tx.Exec(`SELECT 1 FROM users WHERE id = ? FOR UPDATE`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		var count int
+		if _, err := tx.QueryOne(pg.Scan(&count), `SELECT count(*) FROM user_webhooks WHERE user_id = ?`, user.ID); err != nil {
+			return merry.Wrap(err)
+		}
+		if count >= MaxUserWebhooks {
+			return ErrTooManyWebhooks.Here()
+		}
+		_, err := tx.QueryOne(webhook, `
+			INSERT INTO user_webhooks (user_id, url, secret) VALUES (?, ?, ?)
+			RETURNING id, url, secret, created_at`,
+			user.ID, url, utils.RandHexString(64))
+		return merry.Wrap(err)
+	})
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return webhook, nil
+}
+
+func DelUserWebhook(db *pg.DB, user *User, webhookID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM user_webhooks WHERE id = ? AND user_id = ?`,
+		webhookID, user.ID)
+	return merry.Wrap(err)
+}
@@ -4,12 +4,14 @@ import (
 	"os"
 	"storjnet/core"
 	"storjnet/nodes"
+	"storjnet/notifier"
 	"storjnet/optimizer"
 	"storjnet/server"
 	"storjnet/tgbot"
 	"storjnet/transactions"
 	"storjnet/updater"
 	"storjnet/utils"
+	"storjnet/utils/metrics"
 	"storjnet/utils/storjutils"
 	"storjnet/versions"
 	"time"
@@ -23,7 +25,11 @@ import (
 var env = utils.Env{Val: "dev"}
 
 var httpCmdFlags = struct {
-	serverAddr string
+	serverAddr     string
+	tgBotUsername  string
+	authLimit      utils.LockoutLimiterConfig
+	rateLimit      utils.RateLimitConfig
+	trustedProxies []string
 }{}
 var pingProxyCmdFlags = struct {
 	serverAddr      string
@@ -41,6 +47,8 @@ var nodesCmdFlags = struct {
 	satelliteAddress string
 	socksProxy       string
 }{}
+var smtpConfig utils.SMTPConfig
+var metricsAddr string
 var statNodesGroup string
 var nodeLocsSnapFPath string
 var transactionsFlags = struct {
@@ -54,24 +62,34 @@ var (
 		// SilenceUsage: true,
 	}
 	httpCmd = &cobra.Command{
-		Use:   "http",
-		Short: "start HTTP-server",
-		RunE:  CMDHttp,
+		Use:     "http",
+		Short:   "start HTTP-server",
+		PreRunE: startMetricsServer,
+		RunE:    CMDHttp,
 	}
 	pingProxyCmd = &cobra.Command{
-		Use:   "ping-proxy",
-		Short: "start proxy for node dialing and pings",
-		RunE:  CMDPingProxy,
+		Use:     "ping-proxy",
+		Short:   "start proxy for node dialing and pings",
+		PreRunE: startMetricsServer,
+		RunE:    CMDPingProxy,
 	}
 	updateCmd = &cobra.Command{
-		Use:   "update",
-		Short: "start updater (pinger, uptime checker, etc.)",
-		RunE:  CMDUpdate,
+		Use:     "update",
+		Short:   "start updater (pinger, uptime checker, etc.)",
+		PreRunE: startMetricsServer,
+		RunE:    CMDUpdate,
 	}
 	tgBotCmd = &cobra.Command{
-		Use:   "tg-bot",
-		Short: "start TG bot",
-		RunE:  CMDTGBot,
+		Use:     "tg-bot",
+		Short:   "start TG bot",
+		PreRunE: startMetricsServer,
+		RunE:    CMDTGBot,
+	}
+	notifyCmd = &cobra.Command{
+		Use:     "notify",
+		Short:   "start notifier (sends user nodes alerts)",
+		PreRunE: startMetricsServer,
+		RunE:    CMDNotify,
 	}
 	checkVersionsCmd = &cobra.Command{
 		Use:   "check-versions",
@@ -89,9 +107,10 @@ var (
 		RunE:  CMDFetchNodes,
 	}
 	probeNodesCmd = &cobra.Command{
-		Use:   "probe-nodes",
-		Short: "start probing saved nodes and updating activity timestamp",
-		RunE:  CMDProbeNodes,
+		Use:     "probe-nodes",
+		Short:   "start probing saved nodes and updating activity timestamp",
+		PreRunE: startMetricsServer,
+		RunE:    CMDProbeNodes,
 	}
 	statNodesCmd = &cobra.Command{
 		Use:   "stat-nodes",
@@ -115,8 +134,15 @@ var (
 	}
 )
 
+func startMetricsServer(cmd *cobra.Command, args []string) error {
+	return merry.Wrap(metrics.StartServer(metricsAddr))
+}
+
 func CMDHttp(cmd *cobra.Command, args []string) error {
-	return merry.Wrap(server.StartHTTPServer(httpCmdFlags.serverAddr, env))
+	if err := core.SetTrustedProxies(httpCmdFlags.trustedProxies); err != nil {
+		return merry.Wrap(err)
+	}
+	return merry.Wrap(server.StartHTTPServer(httpCmdFlags.serverAddr, env, httpCmdFlags.tgBotUsername, smtpConfig, httpCmdFlags.authLimit, httpCmdFlags.rateLimit))
 }
 
 func CMDPingProxy(cmd *cobra.Command, args []string) error {
@@ -137,8 +163,12 @@ func CMDTGBot(cmd *cobra.Command, args []string) error {
 	return merry.Wrap(tgbot.StartTGBot(tgBotCmdFlags.botToken, tgBotCmdFlags.socks5ProxyAddr, webhookConfig))
 }
 
+func CMDNotify(cmd *cobra.Command, args []string) error {
+	return merry.Wrap(notifier.StartNotifier(tgBotCmdFlags.botToken, tgBotCmdFlags.socks5ProxyAddr, smtpConfig))
+}
+
 func CMDCheckVersions(cmd *cobra.Command, args []string) error {
-	return merry.Wrap(versions.CheckVersions(tgBotCmdFlags.botToken, tgBotCmdFlags.socks5ProxyAddr))
+	return merry.Wrap(versions.CheckVersions(tgBotCmdFlags.botToken, tgBotCmdFlags.socks5ProxyAddr, smtpConfig))
 }
 
 func CMDFetchTransactions(cmd *cobra.Command, args []string) error {
@@ -180,11 +210,25 @@ func CMDOptimizeDB(cmd *cobra.Command, args []string) error {
 	return merry.Wrap(optimizer.OptimizeDB())
 }
 
+func addSMTPFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVar(&smtpConfig.Addr, "smtp-addr", "", "SMTP server address:port for emails (optional)")
+	flags.StringVar(&smtpConfig.Username, "smtp-user", "", "SMTP username (optional)")
+	flags.StringVar(&smtpConfig.Password, "smtp-password", "", "SMTP password (optional)")
+	flags.StringVar(&smtpConfig.From, "smtp-from", "storjnet <noreply@storjnet.info>", "emails From address")
+	flags.StringVar(&smtpConfig.SiteURL, "site-url", "https://storjnet.info", "site address for links in emails")
+}
+
+func addMetricsFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&metricsAddr, "metrics-addr", "", "address:port for Prometheus metrics of the process at /metrics (optional)")
+}
+
 func init() {
 	rootCmd.AddCommand(httpCmd)
 	rootCmd.AddCommand(pingProxyCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(tgBotCmd)
+	rootCmd.AddCommand(notifyCmd)
 	rootCmd.AddCommand(checkVersionsCmd)
 	rootCmd.AddCommand(fetchTransactionsCmd)
 	rootCmd.AddCommand(fetchNodesCmd)
@@ -197,11 +241,25 @@ func init() {
 	flags := httpCmd.Flags()
 	flags.Var(&env, "env", "evironment, dev or prod")
 	flags.StringVar(&httpCmdFlags.serverAddr, "addr", "127.0.0.1:9003", "HTTP server address:port")
+	flags.StringVar(&httpCmdFlags.tgBotUsername, "tg-bot-username", "", "TG bot username for alerts chat linking (optional)")
+	flags.StringSliceVar(&httpCmdFlags.trustedProxies, "trusted-proxies", nil, "reverse proxies IPs/CIDRs allowed to set X-Real-IP (loopback is always allowed)")
+	flags.IntVar(&httpCmdFlags.authLimit.MaxAttempts, "auth-max-attempts", 5, "failed login attempts (per IP and per username) before lockout")
+	flags.DurationVar(&httpCmdFlags.authLimit.Lockout, "auth-lockout", time.Minute, "first login lockout duration, doubled on each next failure")
+	flags.DurationVar(&httpCmdFlags.authLimit.MaxLockout, "auth-max-lockout", time.Hour, "max login lockout duration")
+	flags.IntVar(&httpCmdFlags.rateLimit.IPLimit, "rate-limit-ip", 60, "public API requests per period from one IP")
+	flags.IntVar(&httpCmdFlags.rateLimit.TokenLimit, "rate-limit-token", 600, "public API requests per period with one API token")
+	flags.DurationVar(&httpCmdFlags.rateLimit.Period, "rate-limit-period", time.Minute, "public API rate limit period")
+	flags.StringVar(&httpCmdFlags.rateLimit.Store, "rate-limit-store", "memory", "rate limit buckets storage: memory or pg (shared by several HTTP servers)")
+	addSMTPFlags(httpCmd)
+	addMetricsFlags(httpCmd)
 
 	flags = pingProxyCmd.Flags()
 	flags.StringVar(&pingProxyCmdFlags.serverAddr, "addr", "127.0.0.1:9005", "ping proxy server address:port")
 	flags.StringVar(&pingProxyCmdFlags.identityDirPath, "identity-dir", "identity", "path to dir with satellite identity")
 	flags.StringVar(&pingProxyCmdFlags.mode, "mode", "http", "proxy server mode: http or udp")
+	addMetricsFlags(pingProxyCmd)
+
+	addMetricsFlags(updateCmd)
 
 	flags = tgBotCmd.Flags()
 	flags.StringVar(&tgBotCmdFlags.botToken, "tg-bot-token", "", "TG bot API token")
@@ -210,11 +268,19 @@ func init() {
 	flags.StringVar(&tgBotCmdFlags.webhookListenAddr, "tg-webhook-addr", "", "TG webhook address:port for https server")
 	flags.StringVar(&tgBotCmdFlags.webhookListenPath, "tg-webhook-path", "", "TG webhook /requests/listen/path for https server")
 	flags.StringVar(&core.GitHubOAuthToken, "github-oauth-token", "", "GitHub API OAuth token (optional, for increasing API req rate)")
+	addMetricsFlags(tgBotCmd)
+
+	flags = notifyCmd.Flags()
+	flags.StringVar(&tgBotCmdFlags.botToken, "tg-bot-token", "", "TG bot API token")
+	flags.StringVar(&tgBotCmdFlags.socks5ProxyAddr, "tg-proxy", "", "SOCKS5 proxy for TG requests")
+	addSMTPFlags(notifyCmd)
+	addMetricsFlags(notifyCmd)
 
 	flags = checkVersionsCmd.Flags()
 	flags.StringVar(&tgBotCmdFlags.botToken, "tg-bot-token", "", "TG bot API token")
 	flags.StringVar(&tgBotCmdFlags.socks5ProxyAddr, "tg-proxy", "", "SOCKS5 proxy for TG requests")
 	flags.StringVar(&core.GitHubOAuthToken, "github-oauth-token", "", "GitHub API OAuth token (optional, for increasing API req rate)")
+	addSMTPFlags(checkVersionsCmd)
 
 	flags = fetchTransactionsCmd.Flags()
 	flags.StringVar(&transactionsFlags.summaryStartDate, "summary-start-date", "", "start date for updating daily summaries")
@@ -224,6 +290,8 @@ func init() {
 	flags.StringVar(&nodesCmdFlags.socksProxy, "socks-proxy", "", "proxy for satellite requests, address:port or address:port:user:passwd")
 	fetchNodesCmd.MarkFlagRequired("satellite")
 
+	addMetricsFlags(probeNodesCmd)
+
 	flags = statNodesCmd.Flags()
 	flags.StringVar(&statNodesGroup, "group", "all", "stats group: nodes/daily/official/all")
 
@@ -0,0 +1,47 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_alert_settings (
+				user_id integer PRIMARY KEY REFERENCES storjnet.users (id),
+				fails_count smallint NOT NULL DEFAULT 3,
+				down_minutes smallint NOT NULL DEFAULT 0,
+				lang text NOT NULL DEFAULT 'en',
+				tg_chat_id bigint,
+				tg_link_code text NOT NULL UNIQUE,
+				updated_at timestamptz NOT NULL DEFAULT NOW()
+			);
+
+			ALTER TABLE storjnet.user_nodes ADD COLUMN fails_count integer NOT NULL DEFAULT 0;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN down_since timestamptz;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN alert_is_down bool NOT NULL DEFAULT false;
+
+			CREATE TYPE storjnet.user_node_event_kind AS ENUM ('down', 'up');
+
+			CREATE TABLE storjnet.user_node_events (
+				id bigserial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				node_id bytea NOT NULL,
+				kind storjnet.user_node_event_kind NOT NULL,
+				address text NOT NULL,
+				down_since timestamptz NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				tg_sent_at timestamptz,
+				CHECK (length(node_id) = 32)
+			);
+			CREATE INDEX user_node_events__tg_unsent__index ON storjnet.user_node_events (id) WHERE tg_sent_at IS NULL;
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_node_events;
+			DROP TYPE storjnet.user_node_event_kind;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN alert_is_down;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN down_since;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN fails_count;
+			DROP TABLE storjnet.user_alert_settings;
+			`)
+	})
+}
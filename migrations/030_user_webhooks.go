@@ -0,0 +1,45 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_node_events ADD COLUMN last_ping int;
+			ALTER TABLE storjnet.user_node_events ADD COLUMN sat_label text NOT NULL DEFAULT '';
+
+			CREATE TABLE storjnet.user_webhooks (
+				id serial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				url text NOT NULL,
+				secret text NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX user_webhooks__user_id__index ON storjnet.user_webhooks (user_id);
+
+			CREATE TABLE storjnet.user_webhook_deliveries (
+				id bigserial PRIMARY KEY,
+				webhook_id integer NOT NULL REFERENCES storjnet.user_webhooks (id) ON DELETE CASCADE,
+				event_id bigint NOT NULL REFERENCES storjnet.user_node_events (id) ON DELETE CASCADE,
+				attempts smallint NOT NULL DEFAULT 0,
+				next_attempt_at timestamptz NOT NULL DEFAULT NOW(),
+				delivered_at timestamptz,
+				failed_at timestamptz,
+				last_status smallint,
+				last_error text,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				UNIQUE (webhook_id, event_id)
+			);
+			CREATE INDEX user_webhook_deliveries__pending__index ON storjnet.user_webhook_deliveries (next_attempt_at)
+				WHERE delivered_at IS NULL AND failed_at IS NULL;
+			CREATE INDEX user_webhook_deliveries__event_id__index ON storjnet.user_webhook_deliveries (event_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_webhook_deliveries;
+			DROP TABLE storjnet.user_webhooks;
+			ALTER TABLE storjnet.user_node_events DROP COLUMN sat_label;
+			ALTER TABLE storjnet.user_node_events DROP COLUMN last_ping;
+			`)
+	})
+}
@@ -0,0 +1,30 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_email_verifications (
+				user_id integer PRIMARY KEY REFERENCES storjnet.users (id),
+				email text NOT NULL,
+				code text NOT NULL,
+				attempts smallint NOT NULL DEFAULT 0,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			);
+
+			ALTER TABLE storjnet.user_alert_settings ADD COLUMN email_node_events bool NOT NULL DEFAULT false;
+			ALTER TABLE storjnet.user_alert_settings ADD COLUMN email_versions bool NOT NULL DEFAULT false;
+
+			ALTER TABLE storjnet.user_node_events ADD COLUMN email_sent_at timestamptz;
+			CREATE INDEX user_node_events__email_unsent__index ON storjnet.user_node_events (id) WHERE email_sent_at IS NULL;
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_node_events DROP COLUMN email_sent_at;
+			ALTER TABLE storjnet.user_alert_settings DROP COLUMN email_versions;
+			ALTER TABLE storjnet.user_alert_settings DROP COLUMN email_node_events;
+			DROP TABLE storjnet.user_email_verifications;
+			`)
+	})
+}
@@ -0,0 +1,24 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_api_tokens (
+				id serial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				name text NOT NULL,
+				token_hash bytea NOT NULL UNIQUE,
+				read_only bool NOT NULL DEFAULT false,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				last_used_at timestamptz
+			);
+			CREATE INDEX user_api_tokens__user_id__index ON storjnet.user_api_tokens (user_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_api_tokens;
+			`)
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_nodes ADD COLUMN ping_all_sats bool NOT NULL DEFAULT false;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN last_sat_pings jsonb;
+
+			CREATE TABLE storjnet.user_nodes_sat_history (
+				node_id bytea NOT NULL,
+				user_id integer NOT NULL,
+				sat_label text NOT NULL,
+				date date NOT NULL,
+				pings smallint[] NOT NULL,
+				CHECK (length(node_id) = 32),
+				CHECK (array_dims(pings) = '[1:1440]'),
+				PRIMARY KEY (node_id, user_id, date, sat_label)
+			) PARTITION BY RANGE (date);
+
+			CREATE TABLE storjnet.user_nodes_sat_history__current
+				PARTITION OF storjnet.user_nodes_sat_history DEFAULT;
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_nodes_sat_history;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN last_sat_pings;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN ping_all_sats;
+			`)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TYPE storjnet.node_ping_proto AS ENUM ('tcp', 'quic', 'both');
+
+			ALTER TABLE storjnet.user_nodes ADD COLUMN ping_proto storjnet.node_ping_proto NOT NULL DEFAULT 'tcp';
+			ALTER TABLE storjnet.user_nodes ADD COLUMN last_quic_ping int;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN last_quic_ping_was_ok bool;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN last_quic_up_at timestamptz;
+
+			ALTER TABLE storjnet.user_nodes_history ADD COLUMN quic_pings smallint[];
+			ALTER TABLE storjnet.user_nodes_history ADD CONSTRAINT user_nodes_history_quic_pings_check
+				CHECK (quic_pings IS NULL OR array_dims(quic_pings) = '[1:1440]');
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_nodes_history DROP COLUMN quic_pings;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN last_quic_up_at;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN last_quic_ping_was_ok;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN last_quic_ping;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN ping_proto;
+			DROP TYPE storjnet.node_ping_proto;
+			`)
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_nodes ADD COLUMN ping_interval smallint NOT NULL DEFAULT 1
+				CHECK (ping_interval IN (1, 5, 15));
+
+			ALTER TABLE storjnet.user_nodes_history ADD COLUMN resolution smallint NOT NULL DEFAULT 1;
+			ALTER TABLE storjnet.user_nodes_history DROP CONSTRAINT user_nodes_history_pings_check;
+			ALTER TABLE storjnet.user_nodes_history ADD CONSTRAINT user_nodes_history_pings_check
+				CHECK (resolution IN (1, 5, 15) AND array_dims(pings) = '[1:' || 1440/resolution || ']');
+			ALTER TABLE storjnet.user_nodes_history DROP CONSTRAINT user_nodes_history_quic_pings_check;
+			ALTER TABLE storjnet.user_nodes_history ADD CONSTRAINT user_nodes_history_quic_pings_check
+				CHECK (quic_pings IS NULL OR array_dims(quic_pings) = '[1:' || 1440/resolution || ']');
+
+			ALTER TABLE storjnet.user_nodes_sat_history ADD COLUMN resolution smallint NOT NULL DEFAULT 1;
+			ALTER TABLE storjnet.user_nodes_sat_history DROP CONSTRAINT user_nodes_sat_history_pings_check;
+			ALTER TABLE storjnet.user_nodes_sat_history ADD CONSTRAINT user_nodes_sat_history_pings_check
+				CHECK (resolution IN (1, 5, 15) AND array_dims(pings) = '[1:' || 1440/resolution || ']');
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DELETE FROM storjnet.user_nodes_sat_history WHERE resolution != 1;
+			ALTER TABLE storjnet.user_nodes_sat_history DROP CONSTRAINT user_nodes_sat_history_pings_check;
+			ALTER TABLE storjnet.user_nodes_sat_history ADD CONSTRAINT user_nodes_sat_history_pings_check
+				CHECK (array_dims(pings) = '[1:1440]');
+			ALTER TABLE storjnet.user_nodes_sat_history DROP COLUMN resolution;
+
+			DELETE FROM storjnet.user_nodes_history WHERE resolution != 1;
+			ALTER TABLE storjnet.user_nodes_history DROP CONSTRAINT user_nodes_history_quic_pings_check;
+			ALTER TABLE storjnet.user_nodes_history ADD CONSTRAINT user_nodes_history_quic_pings_check
+				CHECK (quic_pings IS NULL OR array_dims(quic_pings) = '[1:1440]');
+			ALTER TABLE storjnet.user_nodes_history DROP CONSTRAINT user_nodes_history_pings_check;
+			ALTER TABLE storjnet.user_nodes_history ADD CONSTRAINT user_nodes_history_pings_check
+				CHECK (array_dims(pings) = '[1:1440]');
+			ALTER TABLE storjnet.user_nodes_history DROP COLUMN resolution;
+
+			ALTER TABLE storjnet.user_nodes DROP COLUMN ping_interval;
+			`)
+	})
+}
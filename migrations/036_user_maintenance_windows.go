@@ -0,0 +1,29 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TYPE storjnet.maintenance_recurrence AS ENUM ('none', 'daily', 'weekly');
+
+			CREATE TABLE storjnet.user_maintenance_windows (
+				id serial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				node_id bytea, -- NULL means all user nodes
+				starts_at timestamptz NOT NULL,
+				duration_minutes integer NOT NULL,
+				recurrence storjnet.maintenance_recurrence NOT NULL DEFAULT 'none',
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				CHECK (node_id IS NULL OR length(node_id) = 32),
+				CHECK (duration_minutes > 0)
+			);
+			CREATE INDEX user_maintenance_windows__user_id__index ON storjnet.user_maintenance_windows (user_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_maintenance_windows;
+			DROP TYPE storjnet.maintenance_recurrence;
+			`)
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	// not in transaction: new enum value can not be used in the same transaction where it was added,
+	// so statements are idempotent instead (for reruns after partial failure)
+	migrations.MustRegister(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TYPE storjnet.user_node_event_kind ADD VALUE IF NOT EXISTS 'flapping'
+			`, `
+			-- recent check results (bit 0 - latest, 1 - ok) for flapping detection
+			ALTER TABLE storjnet.user_nodes ADD COLUMN IF NOT EXISTS check_bits integer NOT NULL DEFAULT 0;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN IF NOT EXISTS check_bits_count smallint NOT NULL DEFAULT 0;
+			ALTER TABLE storjnet.user_nodes ADD COLUMN IF NOT EXISTS is_flapping bool NOT NULL DEFAULT false;
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.user_nodes DROP COLUMN is_flapping;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN check_bits_count;
+			ALTER TABLE storjnet.user_nodes DROP COLUMN check_bits;
+
+			DELETE FROM storjnet.user_node_events WHERE kind = 'flapping';
+			ALTER TYPE storjnet.user_node_event_kind RENAME TO user_node_event_kind__old;
+			CREATE TYPE storjnet.user_node_event_kind AS ENUM ('down', 'up');
+			ALTER TABLE storjnet.user_node_events
+				ALTER COLUMN kind TYPE storjnet.user_node_event_kind USING kind::text::storjnet.user_node_event_kind;
+			DROP TYPE storjnet.user_node_event_kind__old;
+			`)
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_node_groups (
+				id serial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				name text NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				UNIQUE (user_id, name)
+			);
+
+			CREATE TABLE storjnet.user_node_group_members (
+				group_id integer NOT NULL REFERENCES storjnet.user_node_groups (id) ON DELETE CASCADE,
+				node_id bytea NOT NULL,
+				user_id integer NOT NULL,
+				PRIMARY KEY (group_id, node_id),
+				FOREIGN KEY (node_id, user_id) REFERENCES storjnet.user_nodes (node_id, user_id) ON DELETE CASCADE
+			);
+			CREATE INDEX user_node_group_members__node_id_user_id__index
+				ON storjnet.user_node_group_members (node_id, user_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_node_group_members;
+			DROP TABLE storjnet.user_node_groups;
+			`)
+	})
+}
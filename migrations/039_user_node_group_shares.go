@@ -0,0 +1,24 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_node_group_shares (
+				id serial PRIMARY KEY,
+				key text NOT NULL UNIQUE,
+				user_id integer NOT NULL REFERENCES storjnet.users (id),
+				group_id integer NOT NULL REFERENCES storjnet.user_node_groups (id) ON DELETE CASCADE,
+				is_public boolean NOT NULL DEFAULT false,
+				mask_ids boolean NOT NULL DEFAULT true,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX user_node_group_shares__user_id__index ON storjnet.user_node_group_shares (user_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_node_group_shares;
+			`)
+	})
+}
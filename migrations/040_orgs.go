@@ -0,0 +1,28 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.users ADD COLUMN is_org boolean NOT NULL DEFAULT false;
+
+			CREATE TYPE storjnet.org_member_role AS ENUM ('owner', 'editor', 'viewer');
+
+			CREATE TABLE storjnet.org_members (
+				org_id integer NOT NULL REFERENCES storjnet.users (id) ON DELETE CASCADE,
+				user_id integer NOT NULL REFERENCES storjnet.users (id) ON DELETE CASCADE,
+				role storjnet.org_member_role NOT NULL,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (org_id, user_id)
+			);
+			CREATE INDEX org_members__user_id__index ON storjnet.org_members (user_id);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.org_members;
+			DROP TYPE storjnet.org_member_role;
+			ALTER TABLE storjnet.users DROP COLUMN is_org;
+			`)
+	})
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_password_resets (
+				user_id integer PRIMARY KEY REFERENCES storjnet.users (id) ON DELETE CASCADE,
+				token_hash bytea NOT NULL UNIQUE,
+				created_at timestamptz NOT NULL DEFAULT NOW()
+			);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_password_resets;
+			`)
+	})
+}
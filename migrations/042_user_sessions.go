@@ -0,0 +1,35 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE TABLE storjnet.user_sessions (
+				id serial PRIMARY KEY,
+				user_id integer NOT NULL REFERENCES storjnet.users (id) ON DELETE CASCADE,
+				sessid uuid NOT NULL UNIQUE DEFAULT gen_random_uuid(),
+				user_agent text NOT NULL DEFAULT '',
+				ip inet,
+				created_at timestamptz NOT NULL DEFAULT NOW(),
+				last_seen_at timestamptz NOT NULL DEFAULT NOW()
+			);
+			CREATE INDEX user_sessions__user_id__index ON storjnet.user_sessions (user_id);
+
+			INSERT INTO storjnet.user_sessions (user_id, sessid, created_at, last_seen_at)
+			SELECT id, sessid, created_at, coalesce(last_seen_at, created_at) FROM storjnet.users WHERE NOT is_org;
+
+			ALTER TABLE storjnet.users DROP COLUMN sessid;
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.users ADD COLUMN sessid uuid NOT NULL DEFAULT gen_random_uuid();
+			ALTER TABLE storjnet.users ALTER COLUMN sessid DROP DEFAULT;
+			UPDATE storjnet.users SET sessid = s.sessid FROM (
+				SELECT DISTINCT ON (user_id) user_id, sessid FROM storjnet.user_sessions ORDER BY user_id, last_seen_at DESC
+			) AS s WHERE s.user_id = users.id;
+
+			DROP TABLE storjnet.user_sessions;
+			`)
+	})
+}
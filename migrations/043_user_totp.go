@@ -0,0 +1,27 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TABLE storjnet.users ADD COLUMN totp_secret text;
+			ALTER TABLE storjnet.users ADD COLUMN totp_pending_secret text;
+			ALTER TABLE storjnet.users ADD COLUMN totp_last_step bigint NOT NULL DEFAULT 0;
+			`, `
+			CREATE TABLE storjnet.user_totp_recovery_codes (
+				user_id integer NOT NULL REFERENCES storjnet.users (id) ON DELETE CASCADE,
+				code_hash bytea NOT NULL,
+				PRIMARY KEY (user_id, code_hash)
+			);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.user_totp_recovery_codes;
+			`, `
+			ALTER TABLE storjnet.users DROP COLUMN totp_secret;
+			ALTER TABLE storjnet.users DROP COLUMN totp_pending_secret;
+			ALTER TABLE storjnet.users DROP COLUMN totp_last_step;
+			`)
+	})
+}
@@ -0,0 +1,18 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	migrations.MustRegisterTx(func(db migrations.DB) error {
+		return execSome(db, `
+			CREATE UNLOGGED TABLE storjnet.rate_limit_buckets (
+				key text PRIMARY KEY,
+				tat timestamptz NOT NULL
+			);
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DROP TABLE storjnet.rate_limit_buckets;
+			`)
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import "github.com/go-pg/migrations/v8"
+
+func init() {
+	// not in transaction: new enum value can not be used in the same transaction where it was added
+	migrations.MustRegister(func(db migrations.DB) error {
+		return execSome(db, `
+			ALTER TYPE storjnet.user_node_event_kind ADD VALUE IF NOT EXISTS 'flapping_stopped'
+			`)
+	}, func(db migrations.DB) error {
+		return execSome(db, `
+			DELETE FROM storjnet.user_node_events WHERE kind = 'flapping_stopped';
+			ALTER TYPE storjnet.user_node_event_kind RENAME TO user_node_event_kind__old;
+			CREATE TYPE storjnet.user_node_event_kind AS ENUM ('down', 'up', 'flapping');
+			ALTER TABLE storjnet.user_node_events
+				ALTER COLUMN kind TYPE storjnet.user_node_event_kind USING kind::text::storjnet.user_node_event_kind;
+			DROP TYPE storjnet.user_node_event_kind__old;
+			`)
+	})
+}
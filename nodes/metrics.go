@@ -0,0 +1,19 @@
+package nodes
+
+import "storjnet/utils/metrics"
+
+var (
+	nodeProbesCount = metrics.Default.NewCounter("storjnet_node_probes_total",
+		"Network nodes probes (dials from any satellite) by protocol and result.", "proto", "result")
+	probeQueueLength = metrics.Default.NewGauge("storjnet_probe_queue_length",
+		"Network nodes waiting in prober channels.", "chan")
+	probeLag = metrics.Default.NewGauge("storjnet_probe_lag_seconds",
+		"How late (relative to the update interval) was the oldest node of the last loaded chunk.")
+)
+
+func probeResultLabel(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return "error"
+}
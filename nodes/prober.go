@@ -1,7 +1,6 @@
 package nodes
 
 import (
-	"context"
 	"storjnet/utils"
 	"storjnet/utils/storjutils"
 	"strconv"
@@ -18,15 +17,17 @@ import (
 
 const (
 	nodesUpdateInterval = `INTERVAL '8 minutes'`
+	nodesUpdateDuration = 8 * time.Minute
 	noNodesPauseDuraton = 30 * time.Second
 	probeRoutinesCount  = 64
 )
 
 type ProbeNode struct {
-	RawID  []byte
-	ID     storj.NodeID
-	IPAddr string
-	Port   uint16
+	RawID     []byte
+	ID        storj.NodeID
+	IPAddr    string
+	Port      uint16
+	CheckedAt time.Time
 }
 type ProbeNodeErr struct {
 	Node    *ProbeNode
@@ -77,9 +78,9 @@ func startOldNodesLoader(db *pg.DB, nodesChan chan *ProbeNode, chunkSize int) ut
 		defer worker.Done()
 		for {
 			nodes := make([]*ProbeNode, chunkSize)
-			err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			err := utils.RunInTimedTransaction(db, "probe_load", func(tx *pg.Tx) error {
 				_, err := tx.Query(&nodes, `
-					SELECT id AS raw_id, ip_addr, port FROM nodes
+					SELECT id AS raw_id, ip_addr, port, checked_at FROM nodes
 					WHERE checked_at IS NULL
 					   OR (checked_at < NOW() - `+nodesUpdateInterval+`
 					       AND greatest(updated_at, last_received_from_sat_at) > NOW() - INTERVAL '7 days')
@@ -111,6 +112,11 @@ func startOldNodesLoader(db *pg.DB, nodesChan chan *ProbeNode, chunkSize int) ut
 			}
 
 			log.Info().Int("IDs count", len(nodes)).Msg("PROBE:OLD")
+			if len(nodes) > 0 && !nodes[0].CheckedAt.IsZero() {
+				probeLag.Set((time.Since(nodes[0].CheckedAt) - nodesUpdateDuration).Seconds())
+			} else {
+				probeLag.Set(0)
+			}
 			if len(nodes) == 0 {
 				time.Sleep(noNodesPauseDuraton)
 			}
@@ -142,6 +148,8 @@ func startNodesProber(nodesInChan chan *ProbeNode, nodesOutChan chan *ProbeNodeE
 			defer worker.Done()
 			for node := range nodesInChan {
 				tcpSat, quicSat, tcpErr, quicErr := probe(sats, node)
+				nodeProbesCount.Inc(storjutils.SatModeTCP.String(), probeResultLabel(tcpErr))
+				nodeProbesCount.Inc(storjutils.SatModeQUIC.String(), probeResultLabel(quicErr))
 				if tcpErr != nil && quicErr != nil {
 					atomic.AddInt64(&countErr, 1)
 					if !errIsKnown(tcpErr) {
@@ -185,7 +193,7 @@ func startPingedNodesSaver(db *pg.DB, nodesChan chan *ProbeNodeErr, chunkSize in
 
 	go func() {
 		defer worker.Done()
-		err := utils.SaveChunked(db, chunkSize, nodesChanI, func(tx *pg.Tx, items []interface{}) error {
+		err := utils.SaveChunked(db, "probe_save", chunkSize, nodesChanI, func(tx *pg.Tx, items []interface{}) error {
 			ids := make([]storj.NodeID, len(items))
 			tcpErrIDs := make([]storj.NodeID, 0, len(items))
 			quicErrIDs := make([]storj.NodeID, 0, len(items))
@@ -239,6 +247,8 @@ func StartProber() error {
 		}
 
 		iter += 1
+		probeQueueLength.Set(float64(len(nodesInChan)), "in")
+		probeQueueLength.Set(float64(len(nodesOutChan)), "out")
 		if iter%5 == 0 {
 			log.Info().Int("in_chan", len(nodesInChan)).Int("out_chan", len(nodesOutChan)).Msg("PROBE:STAT")
 		}
@@ -0,0 +1,112 @@
+package notifier
+
+import (
+	"storjnet/core"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/rs/zerolog/log"
+)
+
+type emailUserNodeEvent struct {
+	userNodeEventWithLang
+	Email string
+}
+
+func emailEventMessage(event *emailUserNodeEvent) (string, string) {
+	lang := event.Lang
+	nodeID := event.NodeID.String()
+	nodeText := shortNodeID(nodeID) + " (" + event.Address + ")"
+	details := "\n\n" + loc(lang, "Node ID: ", "ID ноды: ") + nodeID +
+		"\n" + loc(lang, "Address: ", "Адрес: ") + event.Address
+	if event.SatLabel != "" {
+		details += "\n" + loc(lang, "Checked from: ", "Проверено с: ") + event.SatLabel
+	}
+	details += "\n\nhttps://storjnet.info/~"
+
+	switch event.Kind {
+	case core.UserNodeEventDown:
+		since := event.DownSince.In(time.UTC).Format("2006-01-02 15:04 UTC")
+		return loc(lang, "Node "+nodeText+" is offline", "Нода "+nodeText+" недоступна"),
+			loc(lang,
+				"Node went offline, first failed ping at "+since+".",
+				"Нода недоступна, первый неудачный пинг в "+since+".") + details
+	case core.UserNodeEventUp:
+		downtime := formatDuration(event.Downtime(), lang)
+		return loc(lang, "Node "+nodeText+" is back online", "Нода "+nodeText+" снова доступна"),
+			loc(lang,
+				"Node recovered, downtime "+downtime+".",
+				"Нода снова доступна, простой "+downtime+".") + details
+	case core.UserNodeEventFlapping:
+		return loc(lang, "Node "+nodeText+" is flapping", "Нода "+nodeText+" нестабильна"),
+			loc(lang,
+				"Node goes up and down repeatedly. Down/up notifications are paused until it is stable.",
+				"Нода то пропадает, то появляется. Уведомления о падениях приостановлены до стабилизации.") + details
+	case core.UserNodeEventFlappingStopped:
+		return loc(lang, "Node "+nodeText+" is stable again", "Нода "+nodeText+" снова стабильна"),
+			loc(lang,
+				"Node is not flapping anymore. Down/up notifications are resumed.",
+				"Нода больше не пропадает раз за разом. Уведомления о падениях возобновлены.") + details
+	default:
+		subject := loc(lang, "Node ", "Нода ") + nodeText + ": " + string(event.Kind)
+		return subject, subject + details
+	}
+}
+
+func startEmailEventsSender(db *pg.DB, mailer utils.Mailer) utils.Worker {
+	worker := utils.NewSimpleWorker(1)
+
+	go func() {
+		defer worker.Done()
+		for {
+			var events []*emailUserNodeEvent
+			_, err := db.Query(&events, `
+				SELECT e.id, e.user_id, e.node_id AS raw_node_id, e.kind, e.address, e.sat_label,
+					e.down_since, e.created_at, s.lang, u.email
+				FROM user_node_events AS e
+				JOIN user_alert_settings AS s ON s.user_id = e.user_id
+				JOIN users AS u ON u.id = e.user_id
+				WHERE e.email_sent_at IS NULL
+				  AND s.email_node_events
+				  AND u.email IS NOT NULL
+				  AND e.created_at > NOW() - INTERVAL '1 day'
+				ORDER BY e.id
+				LIMIT 32`)
+			if err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+			baseEvents := make([]*core.UserNodeEvent, len(events))
+			for i, event := range events {
+				baseEvents[i] = &event.UserNodeEvent
+			}
+			if err := core.ConvertUserNodeEventIDs(baseEvents); err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+
+			for _, event := range events {
+				// marking as sent even in case of error: mailbox may not exist anymore
+				subject, text := emailEventMessage(event)
+				err := mailer.Send(event.Email, subject, text)
+				notificationsCount.Inc("email", sendResultLabel(err))
+				if err != nil {
+					log.Error().Err(err).Int64("event_id", event.ID).Msg("NOTIF:EMAIL: failed to send event")
+				}
+				if _, err := db.Exec(`UPDATE user_node_events SET email_sent_at = NOW() WHERE id = ?`, event.ID); err != nil {
+					worker.AddError(merry.Wrap(err))
+					return
+				}
+			}
+
+			if len(events) > 0 {
+				log.Info().Int("count", len(events)).Msg("NOTIF:EMAIL")
+			} else {
+				time.Sleep(5 * time.Second)
+			}
+		}
+	}()
+	return worker
+}
@@ -0,0 +1,13 @@
+package notifier
+
+import "storjnet/utils/metrics"
+
+var notificationsCount = metrics.Default.NewCounter("storjnet_notifications_total",
+	"Sent user nodes notifications by channel (tg, email, webhook) and result.", "channel", "result")
+
+func sendResultLabel(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return "error"
+}
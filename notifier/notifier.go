@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"fmt"
+	"storjnet/core"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/rs/zerolog/log"
+)
+
+type userNodeEventWithLang struct {
+	core.UserNodeEvent
+	Lang string
+}
+
+func loc(lang, en, ru string) string {
+	if lang == "ru" {
+		return ru
+	}
+	return en
+}
+
+func formatDuration(d time.Duration, lang string) string {
+	days := int64(d / (24 * time.Hour))
+	hours := int64((d / time.Hour) % 24)
+	minutes := int64((d / time.Minute) % 60)
+	res := fmt.Sprintf("%d %s", minutes, loc(lang, "min", "мин"))
+	if hours != 0 {
+		res = fmt.Sprintf("%d %s %s", hours, loc(lang, "h", "ч"), res)
+	}
+	if days != 0 {
+		res = fmt.Sprintf("%d %s %s", days, loc(lang, "d", "д"), res)
+	}
+	return res
+}
+
+func shortNodeID(id string) string {
+	return id[:4] + "-" + id[len(id)-2:]
+}
+
+func StartNotifier(tgBotToken, tgSocks5ProxyAddr string, smtpConfig utils.SMTPConfig) error {
+	db := utils.MakePGConnection()
+
+	workers := []utils.Worker{
+		startWebhooksSender(db),
+	}
+	if tgBotToken != "" {
+		bot, err := utils.TGMakeBot(tgBotToken, tgSocks5ProxyAddr)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		log.Info().Str("username", bot.Self.UserName).Msg("TG bot authorized")
+		workers = append(workers, startTGEventsSender(db, bot))
+	} else {
+		log.Warn().Msg("no TG bot token, TG notifications are disabled")
+	}
+	if smtpConfig.IsSet() {
+		workers = append(workers, startEmailEventsSender(db, utils.NewSMTPMailer(smtpConfig)))
+	} else {
+		log.Warn().Msg("no SMTP server address, email notifications are disabled")
+	}
+
+	for {
+		for _, worker := range workers {
+			if err := worker.PopError(); err != nil {
+				return err
+			}
+		}
+		time.Sleep(time.Second)
+	}
+}
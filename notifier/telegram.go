@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"storjnet/core"
+	"storjnet/utils"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/rs/zerolog/log"
+)
+
+type tgUserNodeEvent struct {
+	userNodeEventWithLang
+	TGChatID int64
+}
+
+func tgEventMessage(event *tgUserNodeEvent) string {
+	lang := event.Lang
+	nodeText := "`" + shortNodeID(event.NodeID.String()) + "` (`" + event.Address + "`)"
+	switch event.Kind {
+	case core.UserNodeEventDown:
+		since := event.DownSince.In(time.UTC).Format("15:04 UTC")
+		return loc(lang,
+			"🔴 Node "+nodeText+" went offline, first failed ping at "+since,
+			"🔴 Нода "+nodeText+" недоступна, первый неудачный пинг в "+since)
+	case core.UserNodeEventUp:
+		downtime := formatDuration(event.Downtime(), lang)
+		return loc(lang,
+			"🟢 Node "+nodeText+" recovered, downtime "+downtime,
+			"🟢 Нода "+nodeText+" снова доступна, простой "+downtime)
+	case core.UserNodeEventFlapping:
+		return loc(lang,
+			"🟠 Node "+nodeText+" is flapping (goes up and down repeatedly), notifications are paused until it is stable",
+			"🟠 Нода "+nodeText+" то пропадает, то появляется, уведомления приостановлены до стабилизации")
+	case core.UserNodeEventFlappingStopped:
+		return loc(lang,
+			"🔵 Node "+nodeText+" is stable again, notifications resumed",
+			"🔵 Нода "+nodeText+" снова стабильна, уведомления возобновлены")
+	default:
+		return loc(lang, "Node ", "Нода ") + nodeText + ": " + string(event.Kind)
+	}
+}
+
+func sendTGMessageWithRetries(bot *tgbotapi.BotAPI, chatID int64, text string) error {
+	var err error
+	for i := 0; i < 3; i++ {
+		err = utils.TGSendMessageMD(bot, chatID, text)
+		if err == nil {
+			return nil
+		}
+		log.Error().Err(err).Int("iter", i).Int64("chatID", chatID).Msg("message sending error")
+		time.Sleep(time.Second)
+	}
+	return merry.Wrap(err)
+}
+
+func startTGEventsSender(db *pg.DB, bot *tgbotapi.BotAPI) utils.Worker {
+	worker := utils.NewSimpleWorker(1)
+
+	go func() {
+		defer worker.Done()
+		for {
+			var events []*tgUserNodeEvent
+			_, err := db.Query(&events, `
+				SELECT e.id, e.user_id, e.node_id AS raw_node_id, e.kind, e.address, e.down_since, e.created_at,
+					s.lang, s.tg_chat_id
+				FROM user_node_events AS e
+				JOIN user_alert_settings AS s ON s.user_id = e.user_id
+				WHERE e.tg_sent_at IS NULL
+				  AND s.tg_chat_id IS NOT NULL
+				  AND e.created_at > NOW() - INTERVAL '1 day'
+				ORDER BY e.id
+				LIMIT 32`)
+			if err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+			baseEvents := make([]*core.UserNodeEvent, len(events))
+			for i, event := range events {
+				baseEvents[i] = &event.UserNodeEvent
+			}
+			if err := core.ConvertUserNodeEventIDs(baseEvents); err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+
+			for _, event := range events {
+				// marking as sent even in case of error: chat may be deleted or bot may be blocked
+				err := sendTGMessageWithRetries(bot, event.TGChatID, tgEventMessage(event))
+				notificationsCount.Inc("tg", sendResultLabel(err))
+				if err != nil {
+					log.Error().Err(err).Int64("event_id", event.ID).Msg("NOTIF:TG: failed to send event")
+				}
+				if _, err := db.Exec(`UPDATE user_node_events SET tg_sent_at = NOW() WHERE id = ?`, event.ID); err != nil {
+					worker.AddError(merry.Wrap(err))
+					return
+				}
+			}
+
+			if len(events) > 0 {
+				log.Info().Int("count", len(events)).Msg("NOTIF:TG")
+			} else {
+				time.Sleep(5 * time.Second)
+			}
+		}
+	}()
+	return worker
+}
@@ -0,0 +1,269 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"storjnet/core"
+	"storjnet/utils"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/rs/zerolog/log"
+)
+
+// delays between attempts: 1, 2, 4, ... 64 minutes (~2 hours total)
+const webhookMaxAttempts = 8
+const webhookFirstRetryDelay = time.Minute
+
+var ErrWebhookForbiddenAddr = merry.New("webhook address is not public")
+
+type webhookPayload struct {
+	Event           core.UserNodeEventKind `json:"event"`
+	EventID         int64                  `json:"eventId"`
+	NodeID          string                 `json:"nodeId"`
+	Address         string                 `json:"address"`
+	LastPing        *int64                 `json:"lastPing"` // ms, null if node was never pinged successfully
+	Satellite       string                 `json:"satellite"`
+	DownSince       time.Time              `json:"downSince"`
+	DowntimeSeconds int64                  `json:"downtimeSeconds"`
+	CreatedAt       time.Time              `json:"createdAt"`
+}
+
+type webhookDelivery struct {
+	ID       int64
+	Attempts int64
+	URL      string
+	Secret   string
+	Event    core.UserNodeEvent
+}
+
+type webhookDeliveryResult struct {
+	Status int
+	Err    error
+}
+
+// non-public networks not covered by net.IP.Is* methods
+var webhookForbiddenNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),     //"this" network
+	mustParseCIDR("100.64.0.0/10"), //carrier-grade NAT
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func isPublicWebhookIP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	// IPv4-mapped IPv6 (::ffff:10.0.0.1) is checked as IPv4
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, ipNet := range webhookForbiddenNets {
+		if ipNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl prevents webhooks from reaching local/private networks
+func webhookDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if !isPublicWebhookIP(net.ParseIP(host)) {
+		return ErrWebhookForbiddenAddr.Here()
+	}
+	return nil
+}
+
+var webhookHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: webhookDialControl}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// WebhookSignature is a hex HMAC-SHA256 of "<timestamp>.<body>" made with webhook secret.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func makeWebhookPayload(event *core.UserNodeEvent) webhookPayload {
+	payload := webhookPayload{
+		Event:     event.Kind,
+		EventID:   event.ID,
+		NodeID:    event.NodeID.String(),
+		Address:   event.Address,
+		Satellite: event.SatLabel,
+		DownSince: event.DownSince,
+		CreatedAt: event.CreatedAt,
+	}
+	if event.LastPing != 0 {
+		lastPing := event.LastPing
+		payload.LastPing = &lastPing
+	}
+	if event.Kind == core.UserNodeEventUp {
+		payload.DowntimeSeconds = int64(event.Downtime() / time.Second)
+	}
+	return payload
+}
+
+func sendWebhook(delivery *webhookDelivery) (int, error) {
+	body, err := json.Marshal(makeWebhookPayload(&delivery.Event))
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	stamp := time.Now().Unix()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "storjnet-webhook")
+	req.Header.Set("X-Storjnet-Event", string(delivery.Event.Kind))
+	req.Header.Set("X-Storjnet-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Storjnet-Timestamp", strconv.FormatInt(stamp, 10))
+	req.Header.Set("X-Storjnet-Signature", "sha256="+WebhookSignature(delivery.Secret, stamp, body))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, merry.Wrap(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, merry.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+	return resp.StatusCode, nil
+}
+
+func saveWebhookDeliveryResult(db *pg.DB, delivery *webhookDelivery, res webhookDeliveryResult) error {
+	attempts := delivery.Attempts + 1
+	if res.Err == nil {
+		_, err := db.Exec(`
+			UPDATE user_webhook_deliveries
+			SET attempts = ?, delivered_at = NOW(), last_status = ?, last_error = NULL
+			WHERE id = ?`,
+			attempts, res.Status, delivery.ID)
+		return merry.Wrap(err)
+	}
+	delay := webhookFirstRetryDelay << (attempts - 1)
+	_, err := db.Exec(`
+		UPDATE user_webhook_deliveries
+		SET attempts = ?, next_attempt_at = NOW() + ? * INTERVAL '1 second', last_status = NULLIF(?, 0), last_error = ?,
+			failed_at = CASE WHEN ? THEN NOW() END
+		WHERE id = ?`,
+		attempts, int64(delay/time.Second), res.Status, res.Err.Error(),
+		attempts >= webhookMaxAttempts, delivery.ID)
+	return merry.Wrap(err)
+}
+
+func startWebhooksSender(db *pg.DB) utils.Worker {
+	worker := utils.NewSimpleWorker(1)
+
+	go func() {
+		defer worker.Done()
+		for {
+			var rows []*struct {
+				DeliveryID int64
+				Attempts   int64
+				URL        string
+				Secret     string
+				core.UserNodeEvent
+			}
+			_, err := db.Query(&rows, `
+				SELECT d.id AS delivery_id, d.attempts, w.url, w.secret,
+					e.id, e.user_id, e.node_id AS raw_node_id, e.kind, e.address,
+					COALESCE(e.last_ping, 0) AS last_ping, e.sat_label, e.down_since, e.created_at
+				FROM user_webhook_deliveries AS d
+				JOIN user_webhooks AS w ON w.id = d.webhook_id
+				JOIN user_node_events AS e ON e.id = d.event_id
+				WHERE d.delivered_at IS NULL AND d.failed_at IS NULL
+				  AND d.next_attempt_at <= NOW()
+				ORDER BY d.next_attempt_at
+				LIMIT 32`)
+			if err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+
+			deliveries := make([]*webhookDelivery, len(rows))
+			events := make([]*core.UserNodeEvent, len(rows))
+			for i, row := range rows {
+				deliveries[i] = &webhookDelivery{ID: row.DeliveryID, Attempts: row.Attempts, URL: row.URL, Secret: row.Secret, Event: row.UserNodeEvent}
+				events[i] = &deliveries[i].Event
+			}
+			if err := core.ConvertUserNodeEventIDs(events); err != nil {
+				worker.AddError(merry.Wrap(err))
+				return
+			}
+
+			results := make([]webhookDeliveryResult, len(deliveries))
+			wg := sync.WaitGroup{}
+			for i, delivery := range deliveries {
+				wg.Add(1)
+				go func(i int, delivery *webhookDelivery) {
+					defer wg.Done()
+					status, err := sendWebhook(delivery)
+					results[i] = webhookDeliveryResult{Status: status, Err: err}
+				}(i, delivery)
+			}
+			wg.Wait()
+
+			countOk := 0
+			for i, delivery := range deliveries {
+				notificationsCount.Inc("webhook", sendResultLabel(results[i].Err))
+				if results[i].Err == nil {
+					countOk++
+				} else {
+					log.Warn().Err(results[i].Err).Int64("delivery_id", delivery.ID).
+						Int64("attempts", delivery.Attempts+1).Msg("NOTIF:WEBHOOK: failed to deliver")
+				}
+				if err := saveWebhookDeliveryResult(db, delivery, results[i]); err != nil {
+					worker.AddError(merry.Wrap(err))
+					return
+				}
+			}
+
+			if len(deliveries) > 0 {
+				log.Info().Int("count", len(deliveries)).Int("ok", countOk).Msg("NOTIF:WEBHOOK")
+			} else {
+				time.Sleep(5 * time.Second)
+			}
+		}
+	}()
+	return worker
+}
@@ -0,0 +1,41 @@
+package notifier
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicWebhookIP(t *testing.T) {
+	for _, c := range []struct {
+		ip     string
+		public bool
+	}{
+		{"1.2.3.4", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"100.128.0.1", true},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"::", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+		{"::ffff:1.2.3.4", true},
+	} {
+		if public := isPublicWebhookIP(net.ParseIP(c.ip)); public != c.public {
+			t.Errorf("%s: expected public=%v, got %v", c.ip, c.public, public)
+		}
+	}
+}
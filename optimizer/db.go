@@ -3,6 +3,7 @@ package optimizer
 import (
 	"context"
 	"regexp"
+	"storjnet/core"
 	"storjnet/utils"
 	"strings"
 	"time"
@@ -19,11 +20,14 @@ func OptimizeDB() error {
 	if err := updateDatePartitions(db, "user_nodes_history", 6); err != nil {
 		return merry.Wrap(err)
 	}
+	if err := updateDatePartitions(db, "user_nodes_sat_history", 6); err != nil {
+		return merry.Wrap(err)
+	}
 
 	log.Info().Msg("pausing a bit")
 	time.Sleep(3 * time.Second)
 
-	for _, name := range []string{"user_nodes_history__current" /*, "node_daily_stats"*/} {
+	for _, name := range []string{"user_nodes_history__current", "user_nodes_sat_history__current" /*, "node_daily_stats"*/} {
 		log.Info().Str("name", name).Msg("vacuuming")
 		if err := vacuumIfHaveEnoughSpace(db, name); err != nil {
 			return merry.Wrap(err)
@@ -34,6 +38,18 @@ func OptimizeDB() error {
 		return merry.Wrap(err)
 	}
 
+	if err := removeOldUserNodeEvents(db); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := removeExpiredRateLimitBuckets(db); err != nil {
+		return merry.Wrap(err)
+	}
+
+	if err := removeExpiredUserSessions(db); err != nil {
+		return merry.Wrap(err)
+	}
+
 	log.Info().Msg("done.")
 	return nil
 }
@@ -279,3 +295,30 @@ func removeOldCompaniesUnknownIPs(db *pg.DB) error {
 	log.Info().Int("count", res.RowsAffected()).Msg("removed old companies unknown IPs")
 	return nil
 }
+
+func removeOldUserNodeEvents(db *pg.DB) error {
+	res, err := db.Exec(`DELETE FROM user_node_events WHERE created_at < NOW() - INTERVAL '30 days'`)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	log.Info().Int("count", res.RowsAffected()).Msg("removed old user node events")
+	return nil
+}
+
+func removeExpiredRateLimitBuckets(db *pg.DB) error {
+	res, err := db.Exec(`DELETE FROM rate_limit_buckets WHERE tat < NOW()`)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	log.Info().Int("count", res.RowsAffected()).Msg("removed expired rate limit buckets")
+	return nil
+}
+
+func removeExpiredUserSessions(db *pg.DB) error {
+	count, err := core.DelExpiredUserSessions(db)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	log.Info().Int("count", count).Msg("removed expired user sessions")
+	return nil
+}
@@ -28,7 +28,7 @@ if [ $migrate = true ]; then
 fi
 
 if [ $restart = true ]; then
-    for name in storjnet-http storjnet-update storjnet-tgbot storjnet-probe; do
+    for name in storjnet-http storjnet-update storjnet-tgbot storjnet-probe storjnet-notify; do
         sudo systemctl restart $name
     done
 fi
@@ -0,0 +1,112 @@
+package server
+
+import (
+	_ "embed"
+	"errors"
+	"net/http"
+	"reflect"
+	"storjnet/core"
+	"strings"
+
+	httputils "github.com/3bl3gamer/go-http-utils"
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// apiJSONError allows typed handlers to respond with a JSON error (like 400 WRONG_SUBNET_FORMAT).
+type apiJSONError struct {
+	Resp httputils.JsonError
+}
+
+func (e apiJSONError) Error() string {
+	return e.Resp.Error
+}
+
+// typedHandler is a JSON handler with a concrete result type,
+// so the response format may be checked against openapi.json in tests.
+type typedHandler[T any] func(http.ResponseWriter, *http.Request, httprouter.Params) (T, error)
+
+func typed[T any](handle func(http.ResponseWriter, *http.Request, httprouter.Params) (T, error)) typedHandler[T] {
+	return handle
+}
+
+func (h typedHandler[T]) Handle(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	res, err := h(wr, r, ps)
+	var jsonErr apiJSONError
+	if errors.As(err, &jsonErr) {
+		return jsonErr.Resp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (h typedHandler[T]) ResponseType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+type apiV1Handler interface {
+	Handle(http.ResponseWriter, *http.Request, httprouter.Params) (interface{}, error)
+	ResponseType() reflect.Type
+}
+
+type apiV1Route struct {
+	Method      string
+	Path        string //relative to /api/v1
+	Middlewares []interface{}
+	Handler     apiV1Handler
+}
+
+func (r apiV1Route) Chain() []interface{} {
+	chain := make([]interface{}, 0, len(r.Middlewares)+1)
+	return append(append(chain, r.Middlewares...), r.Handler.Handle)
+}
+
+// apiV1Routes is the stable public API. Response formats of these endpoints
+// must not change in incompatible ways, all of them are described in openapi.json.
+var apiV1Routes = []apiV1Route{
+	{"GET", "/nodes/counts", []interface{}{WithGzip}, typed(HandleAPIv1NodesCounts)},
+	{"GET", "/nodes/countries", []interface{}{WithGzip}, typed(HandleAPIv1NodesCountries)},
+	{"GET", "/nodes/locations", []interface{}{WithGzip}, typed(HandleAPIv1NodesLocations)},
+	{"GET", "/nodes/location_summary", nil, typed(HandleAPINodesLocationSummary)},
+	{"GET", "/nodes/subnet_summary", nil, typed(HandleAPINodesSubnetSummary)},
+	{"GET", "/storj_token/summary", []interface{}{WithGzip}, typed(HandleAPIv1StorjTokenTxSummary)},
+	{"GET", "/neighbors/:subnet", []interface{}{WithRateLimit}, typed(HandleAPINeighbors)},
+	{"POST", "/neighbors", []interface{}{WithRateLimit}, typed(HandleAPINeighborsExt)},
+	{"POST", "/ips_info", []interface{}{WithRateLimit}, typed(HandleAPIIPsInfo)},
+}
+
+func HandleAPIv1OpenAPISpec(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	wr.Header().Set("Content-Type", "application/json")
+	_, err := wr.Write(openAPISpec)
+	return nil, merry.Wrap(err)
+}
+
+func HandleAPIv1NodesCounts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (*NodesCounts, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	startDate, endDate := extractStartEndDatesFromQuery(r.URL.Query(), false)
+	return loadNodesCounts(db, startDate, endDate)
+}
+
+func HandleAPIv1NodesCountries(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (*NodesCountries, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	query := r.URL.Query()
+	startDate, endDate := extractStartEndDatesFromQuery(query, false)
+	return loadNodesCountries(db, startDate, endDate, query.Get("all") == "1", strings.ToLower(query.Get("lang")))
+}
+
+func HandleAPIv1NodesLocations(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) ([]NodeLocation, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	return loadNodesLocations(db)
+}
+
+func HandleAPIv1StorjTokenTxSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) ([]*core.StorjTokenTxSummary, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	startDateStr, endDateStr := extractStartEndDatesStrFromQuery(r.URL.Query(), false)
+	return loadStorjTokenTxSummary(db, startDateStr, endDateStr)
+}
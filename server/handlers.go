@@ -3,20 +3,25 @@ package server
 import (
 	"database/sql"
 	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
+	"net/mail"
 	"net/netip"
 	"net/url"
 	"storjnet/core"
 	"storjnet/utils"
 	"storjnet/utils/storjutils"
+	"strconv"
 	"strings"
 	"time"
 
 	httputils "github.com/3bl3gamer/go-http-utils"
 	"github.com/ansel1/merry"
 	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
 	"github.com/julienschmidt/httprouter"
 	"github.com/oschwald/geoip2-golang"
 	"storj.io/common/storj"
@@ -73,6 +78,16 @@ func extractStartEndDatesStrFromQuery(query url.Values, shortKeys bool) (string,
 	return startTime.Format("2006-01-02"), endTime.Format("2006-01-02")
 }
 
+// wantsJSON checks if JSON is requested (with format=json or Accept header)
+// instead of the default binary format used by the site charts.
+func wantsJSON(wr http.ResponseWriter, r *http.Request) bool {
+	wr.Header().Add("Vary", "Accept")
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
 func extractEndDateFromQuery(query url.Values) time.Time {
 	endDateStr := query.Get("end_date")
 	endTime, err := parseIntervalDate(endDateStr, true)
@@ -122,7 +137,7 @@ func HandleUserDashboard(wr http.ResponseWriter, r *http.Request, ps httprouter.
 	if user == nil {
 		return map[string]interface{}{"FPath": "user_dashboard.html", "User": user}, nil
 	}
-	nodes, err := core.LoadUserNodes(db, user)
+	nodes, err := core.LoadUserNodes(db, user, "")
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
@@ -131,12 +146,42 @@ func HandleUserDashboard(wr http.ResponseWriter, r *http.Request, ps httprouter.
 	if err != nil && err != pg.ErrNoRows {
 		return nil, merry.Wrap(err)
 	}
+	alertSettings, err := core.LoadUserAlertSettings(db, user)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return map[string]interface{}{
+		"FPath":         "user_dashboard.html",
+		"User":          user,
+		"AuthUser":      r.Context().Value(CtxKeyAuthUser).(*core.User),
+		"OrgRole":       r.Context().Value(CtxKeyOrgRole).(string),
+		"UserNodes":     nodes,
+		"UserText":      userText,
+		"AlertSettings": alertSettings,
+		"ServerTime":    time.Now(),
+	}, nil
+}
+
+// HandleSharePage renders a read-only status page of a shared node group, no login required.
+func HandleSharePage(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (httputils.TemplateCtx, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	share, err := core.LoadNodeGroupShare(db, ps.ByName("key"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if share == nil {
+		wr.WriteHeader(http.StatusNotFound)
+		return map[string]interface{}{"FPath": "404.html"}, nil
+	}
+	nodes, _, err := core.LoadSharedNodes(db, share)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
 	return map[string]interface{}{
-		"FPath":      "user_dashboard.html",
-		"User":       user,
-		"UserNodes":  nodes,
-		"UserText":   userText,
-		"ServerTime": time.Now(),
+		"FPath":       "share.html",
+		"Share":       share,
+		"SharedNodes": nodes,
+		"ServerTime":  time.Now(),
 	}, nil
 }
 
@@ -200,7 +245,21 @@ func HandleAPIPingMyNode(wr http.ResponseWriter, r *http.Request, ps httprouter.
 	return map[string]interface{}{"dialDuration": durs.DialDuration, "pingDuration": durs.PingDuration}, nil
 }
 
-func HandleAPINeighbors(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+type SubnetNeighbors struct {
+	Count int64 `json:"count"`
+}
+
+type SubnetNeighborsItem struct {
+	Subnet            string `json:"subnet"`
+	NodesTotal        int64  `json:"nodesTotal"`
+	ForeignNodesCount int64  `json:"foreignNodesCount"`
+}
+
+type SubnetsNeighbors struct {
+	Counts []*SubnetNeighborsItem `json:"counts"`
+}
+
+func HandleAPINeighbors(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (SubnetNeighbors, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 	subnet := ps.ByName("subnet")
 
@@ -212,29 +271,25 @@ func HandleAPINeighbors(wr http.ResponseWriter, r *http.Request, ps httprouter.P
 	if err != nil {
 		if perr, ok := merry.Unwrap(err).(pg.Error); ok {
 			if strings.HasPrefix(perr.Field('M'), "invalid input syntax for type inet") {
-				return httputils.JsonError{Code: 400, Error: "WRONG_SUBNET_FORMAT"}, nil
+				return SubnetNeighbors{}, apiJSONError{httputils.JsonError{Code: 400, Error: "WRONG_SUBNET_FORMAT"}}
 			}
 		}
-		return nil, merry.Wrap(err)
+		return SubnetNeighbors{}, merry.Wrap(err)
 	}
-	return map[string]interface{}{"count": count}, nil
+	return SubnetNeighbors{Count: count}, nil
 }
 
-func HandleAPINeighborsExt(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPINeighborsExt(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (SubnetsNeighbors, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 	params := &struct {
 		Subnets   []string
 		MyNodeIDs []storj.NodeID
 	}{}
 	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
-		return *jsonErr, nil
+		return SubnetsNeighbors{}, apiJSONError{*jsonErr}
 	}
 
-	items := []*struct {
-		Subnet            string `json:"subnet"`
-		NodesTotal        int64  `json:"nodesTotal"`
-		ForeignNodesCount int64  `json:"foreignNodesCount"`
-	}{}
+	items := []*SubnetNeighborsItem{}
 	_, err := db.Query(&items, `
 		SELECT host(node_ip_subnet(ip_addr)) AS subnet,
 			count(*) AS nodes_total,
@@ -246,21 +301,49 @@ func HandleAPINeighborsExt(wr http.ResponseWriter, r *http.Request, ps httproute
 	if err != nil {
 		if perr, ok := merry.Unwrap(err).(pg.Error); ok {
 			if strings.HasPrefix(perr.Field('M'), "invalid input syntax for type inet") {
-				return httputils.JsonError{Code: 400, Error: "WRONG_SUBNET_FORMAT"}, nil
+				return SubnetsNeighbors{}, apiJSONError{httputils.JsonError{Code: 400, Error: "WRONG_SUBNET_FORMAT"}}
 			}
 		}
-		return nil, merry.Wrap(err)
+		return SubnetsNeighbors{}, merry.Wrap(err)
 	}
-	return map[string]interface{}{"counts": items}, nil
+	return SubnetsNeighbors{Counts: items}, nil
+}
+
+// IPsASInfo is an autonomous system with request IPs that belong to it.
+type IPsASInfo struct {
+	ASN       int64     `json:"asn"`
+	Org       string    `json:"org"`
+	Type      string    `json:"type"`
+	Domain    string    `json:"domain"`
+	Descr     string    `json:"descr"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Prefixes  []string  `json:"prefixes" pg:",array"`
+	IPs       []string  `json:"ips"`
+}
+
+// IPsCompanyInfo is a company IP range with request IPs that belong to it.
+type IPsCompanyInfo struct {
+	IPFrom    utils.NetAddrPG `json:"ipFrom"`
+	IPTo      utils.NetAddrPG `json:"ipTo"`
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Domain    string          `json:"domain"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	IPs       []string        `json:"ips"`
 }
 
-func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+type IPsInfo struct {
+	AS        []*IPsASInfo      `json:"as"`
+	Companies []*IPsCompanyInfo `json:"companies"`
+}
+
+func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (IPsInfo, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 	params := &struct {
 		IPs []string
 	}{}
 	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
-		return *jsonErr, nil
+		return IPsInfo{}, apiJSONError{*jsonErr}
 	}
 
 	parsedIPs := make([]netip.Addr, len(params.IPs))
@@ -268,20 +351,11 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		if ip, err := netip.ParseAddr(ipStr); err == nil {
 			parsedIPs[i] = ip
 		} else {
-			return httputils.JsonError{Code: 400, Error: "WRONG_IP_FORMAT", Description: err.Error()}, nil
+			return IPsInfo{}, apiJSONError{httputils.JsonError{Code: 400, Error: "WRONG_IP_FORMAT", Description: err.Error()}}
 		}
 	}
 
-	asInfos := make([]*struct {
-		ASN       int64     `json:"asn"`
-		Org       string    `json:"org"`
-		Type      string    `json:"type"`
-		Domain    string    `json:"domain"`
-		Descr     string    `json:"descr"`
-		UpdatedAt time.Time `json:"updatedAt"`
-		Prefixes  []string  `json:"prefixes" pg:",array"`
-		IPs       []string  `json:"ips"`
-	}, 0)
+	asInfos := make([]*IPsASInfo, 0)
 	_, err := db.Query(&asInfos, `
 		SELECT
 			autonomous_systems.number AS asn,
@@ -301,7 +375,7 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		) AS pref ON autonomous_systems.number = pref.number`,
 		pg.Array(params.IPs))
 	if err != nil {
-		return nil, merry.Wrap(err)
+		return IPsInfo{}, merry.Wrap(err)
 	}
 
 	// writing request IPs to corresponding AS infos
@@ -310,7 +384,7 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		for i, prefixStr := range info.Prefixes {
 			prefixes[i], err = netip.ParsePrefix(prefixStr)
 			if err != nil {
-				return nil, merry.Wrap(err)
+				return IPsInfo{}, merry.Wrap(err)
 			}
 		}
 		for i, ipStr := range params.IPs {
@@ -327,15 +401,7 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		}
 	}
 
-	compInfos := make([]*struct {
-		IPFrom    utils.NetAddrPG `json:"ipFrom"`
-		IPTo      utils.NetAddrPG `json:"ipTo"`
-		Name      string          `json:"name"`
-		Type      string          `json:"type"`
-		Domain    string          `json:"domain"`
-		UpdatedAt time.Time       `json:"updatedAt"`
-		IPs       []string        `json:"ips"`
-	}, 0)
+	compInfos := make([]*IPsCompanyInfo, 0)
 	_, err = db.Query(&compInfos, `
 		SELECT
 			ip_from,
@@ -348,7 +414,7 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		WHERE exists(SELECT 1 FROM unnest(?::inet[]) AS ip WHERE ip BETWEEN ip_from AND ip_to)`,
 		pg.Array(params.IPs))
 	if err != nil {
-		return nil, merry.Wrap(err)
+		return IPsInfo{}, merry.Wrap(err)
 	}
 
 	// writing request IPs to corresponding company infos
@@ -363,7 +429,7 @@ func HandleAPIIPsInfo(wr http.ResponseWriter, r *http.Request, ps httprouter.Par
 		}
 	}
 
-	return map[string]interface{}{"as": asInfos, "companies": compInfos}, nil
+	return IPsInfo{AS: asInfos, Companies: compInfos}, nil
 }
 
 func HandleAPIIPsSanctions(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
@@ -477,180 +543,1168 @@ func HandleAPIIPsSanctions(wr http.ResponseWriter, r *http.Request, ps httproute
 			infos[ipStr] = info
 		}
 	}
-	return map[string]interface{}{"ips": infos}, nil
+	return map[string]interface{}{"ips": infos}, nil
+}
+
+func HandleAPIRegister(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	params := &struct {
+		Username, Password string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if len(params.Username) < 3 {
+		return httputils.JsonError{Code: 400, Error: "USERNAME_TO_SHORT"}, nil
+	}
+	_, err := core.RegisterUser(db, wr, r, params.Username, params.Password)
+	if merry.Is(err, core.ErrUsernameExsists) {
+		// may be used for usernames enumeration
+		markIPAttempt(r)
+		return httputils.JsonError{Code: 400, Error: "USERNAME_EXISTS"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPILogin(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	params := &struct {
+		Username, Password string
+		TOTPCode           string `json:"totpCode"`
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	_, err := core.LoginUser(db, wr, r, params.Username, params.Password, params.TOTPCode)
+	if merry.Is(err, core.ErrUserNotFound) {
+		markAuthFailed(r)
+		return httputils.JsonError{Code: 403, Error: "WRONG_USERNAME_OR_PASSWORD"}, nil
+	}
+	if merry.Is(err, core.ErrTOTPRequired) {
+		return httputils.JsonError{Code: 401, Error: "TOTP_REQUIRED"}, nil
+	}
+	if merry.Is(err, core.ErrWrongTOTPCode) {
+		markAuthFailed(r)
+		return httputils.JsonError{Code: 403, Error: "WRONG_TOTP_CODE"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIChangePassword(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		OldPassword, NewPassword string
+		TOTPCode                 string `json:"totpCode"`
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.NewPassword == "" {
+		return httputils.JsonError{Code: 400, Error: "WRONG_NEW_PASSWORD"}, nil
+	}
+	err := core.ChangeUserPassword(db, wr, r, user, params.OldPassword, params.TOTPCode, params.NewPassword)
+	if jsonErr := credentialsJsonError(r, err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+// credentialsJsonError converts core.CheckUserCredentials errors, wrong password or code
+// is counted as a failed login attempt.
+func credentialsJsonError(r *http.Request, err error) *httputils.JsonError {
+	switch {
+	case merry.Is(err, core.ErrUserNotFound):
+		markAuthFailed(r)
+		return &httputils.JsonError{Code: 403, Error: "WRONG_PASSWORD"}
+	case merry.Is(err, core.ErrTOTPRequired):
+		return &httputils.JsonError{Code: 401, Error: "TOTP_REQUIRED"}
+	case merry.Is(err, core.ErrWrongTOTPCode):
+		markAuthFailed(r)
+		return &httputils.JsonError{Code: 403, Error: "WRONG_TOTP_CODE"}
+	}
+	return nil
+}
+
+// HandleAPIStartPasswordReset sends reset link to user email. Always responds with "ok"
+// (even if there is no such user) to not reveal registered usernames and emails.
+// Each request is counted by the auth limiter, so one client can not send many emails.
+func HandleAPIStartPasswordReset(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	markIPAttempt(r)
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	mailer := r.Context().Value(CtxKeyMailer).(utils.Mailer)
+	siteURL := r.Context().Value(CtxKeySiteURL).(string)
+	params := &struct {
+		Login string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	err := core.StartPasswordReset(db, mailer, siteURL, strings.TrimSpace(params.Login), langFromRequest(r))
+	if err != nil && !merry.Is(err, core.ErrUserNotFound) && !merry.Is(err, core.ErrPasswordResetTooFrequent) {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIFinishPasswordReset(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	params := &struct {
+		Token, Password string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.Password == "" {
+		return httputils.JsonError{Code: 400, Error: "WRONG_NEW_PASSWORD"}, nil
+	}
+	_, err := core.FinishPasswordReset(db, wr, r, params.Token, params.Password)
+	if merry.Is(err, core.ErrPasswordResetNotFound) {
+		markAuthFailed(r)
+		return httputils.JsonError{Code: 400, Error: "WRONG_TOKEN"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+// HandleAPIDeleteUser deletes current user with all data. Password and username
+// (typed once more as a confirmation) are required.
+func HandleAPIDeleteUser(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		Password        string
+		TOTPCode        string `json:"totpCode"`
+		ConfirmUsername string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.ConfirmUsername != user.Username {
+		return httputils.JsonError{Code: 400, Error: "WRONG_CONFIRMATION"}, nil
+	}
+	err := core.CheckUserCredentials(db, user, params.Password, params.TOTPCode)
+	if jsonErr := credentialsJsonError(r, err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	err = core.DeleteUser(db, user)
+	if merry.Is(err, core.ErrLastOrgOwner) {
+		return httputils.JsonError{Code: 400, Error: "LAST_ORG_OWNER"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	core.ClearSessionCookie(wr)
+	return "ok", nil
+}
+
+func HandlePasswordReset(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (httputils.TemplateCtx, error) {
+	return map[string]interface{}{"FPath": "password_reset.html"}, nil
+}
+
+// HandleAPILogout ends current session (other sessions of the user stay active).
+func HandleAPILogout(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyAuthUser).(*core.User)
+	session := r.Context().Value(CtxKeySession).(*core.UserSession)
+	if user != nil && session != nil {
+		if err := core.DelUserSession(db, user, session.ID); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+	core.ClearSessionCookie(wr)
+	return "ok", nil
+}
+
+func HandleAPIGetUserSessions(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	session := r.Context().Value(CtxKeySession).(*core.UserSession)
+	return core.LoadUserSessions(db, user, session)
+}
+
+// HandleAPIDelUserSessions ends session with the given ID or all sessions except the current one (if allOthers is set).
+func HandleAPIDelUserSessions(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	session := r.Context().Value(CtxKeySession).(*core.UserSession)
+	params := &struct {
+		ID        int64
+		AllOthers bool
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	var err error
+	if params.AllOthers {
+		err = core.DelOtherUserSessions(db, user, session)
+	} else {
+		err = core.DelUserSession(db, user, params.ID)
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return core.LoadUserSessions(db, user, session)
+}
+
+func HandleAPIGetUserTOTP(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserTOTPStatus(db, user)
+}
+
+// totpJsonError converts code check errors to API responses, returns nil for other errors.
+func totpJsonError(err error) *httputils.JsonError {
+	switch {
+	case merry.Is(err, core.ErrWrongTOTPCode):
+		return &httputils.JsonError{Code: 400, Error: "WRONG_TOTP_CODE"}
+	case merry.Is(err, core.ErrTOTPAlreadyEnabled):
+		return &httputils.JsonError{Code: 400, Error: "TOTP_ALREADY_ENABLED"}
+	case merry.Is(err, core.ErrTOTPNotEnabled):
+		return &httputils.JsonError{Code: 400, Error: "TOTP_NOT_ENABLED"}
+	case merry.Is(err, core.ErrTOTPSetupNotStarted):
+		return &httputils.JsonError{Code: 400, Error: "TOTP_SETUP_NOT_STARTED"}
+	}
+	return nil
+}
+
+// HandleAPIStartTOTPSetup generates a new secret (with QR code) which should be confirmed with HandleAPIEnableTOTP.
+func HandleAPIStartTOTPSetup(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	setup, err := core.StartTOTPSetup(db, user)
+	if jsonErr := totpJsonError(err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return setup, nil
+}
+
+func HandleAPIEnableTOTP(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct{ Code string }{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	codes, err := core.EnableTOTP(db, user, params.Code)
+	if jsonErr := totpJsonError(err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return map[string]interface{}{"recoveryCodes": codes}, nil
+}
+
+func HandleAPIRegenerateTOTPRecoveryCodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct{ Code string }{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	codes, err := core.RegenerateTOTPRecoveryCodes(db, user, params.Code)
+	if jsonErr := totpJsonError(err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return map[string]interface{}{"recoveryCodes": codes}, nil
+}
+
+func HandleAPIDisableTOTP(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct{ Code string }{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	err := core.DisableTOTP(db, user, params.Code)
+	if jsonErr := totpJsonError(err); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIGetUserNodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserNodes(db, user, r.URL.Query().Get("group"))
+}
+
+func HandleAPISetUserNode(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	node := &core.Node{}
+	if jsonErr := unmarshalNodeFromBody(r, node); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if node.PingProto == "" {
+		node.PingProto = core.PingProtoTCP
+	}
+	if !core.IsValidPingProto(node.PingProto) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_PING_PROTO"}, nil
+	}
+	if node.PingInterval == 0 {
+		node.PingInterval = core.DefaultPingInterval
+	}
+	if !core.IsValidPingInterval(node.PingInterval) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_PING_INTERVAL"}, nil
+	}
+	err := core.SetUserNode(db, user, node)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return node, nil
+}
+
+func HandleAPIDelUserNode(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		ID storj.NodeID
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	err := core.DelUserNode(db, user, params.ID)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+// HandleAPIImportUserNodes adds nodes from a list of "id@address" lines.
+// List is sent either as JSON ({"nodes": [...], "pingMode": "dial"}) or
+// as plain text (one node per line, ping mode in "ping_mode" query param).
+// Valid lines are imported even if some other lines have errors.
+func HandleAPIImportUserNodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		Nodes    []string
+		PingMode string
+	}{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/plain") {
+		buf, err := io.ReadAll(io.LimitReader(r.Body, 1024*1024))
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		params.Nodes = strings.Split(string(buf), "\n")
+		params.PingMode = r.URL.Query().Get("ping_mode")
+	} else if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.PingMode == "" {
+		params.PingMode = "dial"
+	}
+	if !core.IsValidPingMode(params.PingMode) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_PING_MODE"}, nil
+	}
+
+	briefNodes, lineErrs := core.ParseNodeURLs(params.Nodes)
+	nodes, err := core.ImportUserNodes(db, user, briefNodes, params.PingMode)
+	if merry.Is(err, core.ErrTooManyImportedNodes) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_NODES"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return map[string]interface{}{"nodes": nodes, "errors": lineErrs}, nil
+}
+
+// HandleAPIExportUserNodes returns user nodes as "id@address" lines (or as JSON
+// suitable for /api/user_nodes/import with format=json), optionally only from one group.
+func HandleAPIExportUserNodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	query := r.URL.Query()
+
+	nodes, err := core.LoadUserNodes(db, user, query.Get("group"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	urls := make([]string, len(nodes))
+	for i, node := range nodes {
+		urls[i] = core.FormatNodeURL(&node.BriefNode)
+	}
+
+	switch query.Get("format") {
+	case "json":
+		return map[string]interface{}{"nodes": urls}, nil
+	case "", "text":
+		wr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		setAttachmentFilename(wr, "storjnet_nodes.txt")
+		for _, nodeURL := range urls {
+			if _, err := io.WriteString(wr, nodeURL+"\n"); err != nil {
+				return nil, merry.Wrap(err)
+			}
+		}
+		return nil, nil
+	default:
+		return httputils.JsonError{Code: 400, Error: "WRONG_FORMAT"}, nil
+	}
+}
+
+func HandleAPIGetSatNodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	startDate, endDate := extractStartEndDatesFromQuery(r.URL.Query(), false)
+	return core.LoadSatNodes(db, startDate, endDate)
+}
+
+func HandleAPIUserNodePings(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	nodeID, err := storj.NodeIDFromString(ps.ByName("node_id"))
+	if err != nil {
+		return httputils.JsonError{Code: 400, Error: "NODE_ID_DECODE_ERROR", Description: err.Error()}, nil
+	}
+	if strings.Contains(r.URL.Path, "/sat/") {
+		return respondUserNodePings(wr, r, nodeID, "user_id = (SELECT id FROM users WHERE username = 'satellites')")
+	}
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return respondUserNodePings(wr, r, nodeID, "user_id = ?", user.ID)
+}
+
+// HandleAPISharedNodePings returns pings of a shared group node (in binary format only).
+// Node is referenced by its position in the share (see core.SharedNode.Ref) since its ID may be masked.
+func HandleAPISharedNodePings(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	query := r.URL.Query()
+	if query.Get("format") != "" || query.Get("sat") != "" {
+		return httputils.JsonError{Code: 400, Error: "WRONG_FORMAT"}, nil
+	}
+	share, err := core.LoadNodeGroupShare(db, ps.ByName("key"))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if share == nil {
+		return httputils.JsonError{Code: 404, Error: "SHARE_NOT_FOUND"}, nil
+	}
+	_, nodeIDs, err := core.LoadSharedNodes(db, share)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	ref, err := strconv.Atoi(ps.ByName("ref"))
+	if err != nil || ref < 0 || ref >= len(nodeIDs) {
+		return httputils.JsonError{Code: 404, Error: "NODE_NOT_FOUND"}, nil
+	}
+	return respondUserNodePings(wr, r, nodeIDs[ref], "user_id = ?", share.UserID)
+}
+
+// respondUserNodePings writes node history (in format from query params) of the user specified by ownerCond.
+func respondUserNodePings(wr http.ResponseWriter, r *http.Request, nodeID storj.NodeID, ownerCond string, ownerParams ...interface{}) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	query := r.URL.Query()
+	startDateStr, endDateStr := extractStartEndDatesStrFromQuery(query, false)
+	fullPingsData := query.Get("full") == "1"
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return httputils.JsonError{Code: 400, Error: "WRONG_FORMAT"}, nil
+	}
+
+	// main history is made by node primary protocol, separate QUIC history is available with proto=quic
+	proto := query.Get("proto")
+	if proto != "" && proto != core.PingProtoQUIC {
+		return httputils.JsonError{Code: 400, Error: "WRONG_PING_PROTO"}, nil
+	}
+
+	var histories []*core.UserNodeHistory
+	var histsQuery *orm.Query
+	if satLabel := query.Get("sat"); satLabel != "" {
+		if proto == core.PingProtoQUIC {
+			return httputils.JsonError{Code: 400, Error: "WRONG_PING_PROTO", Description: "no QUIC history for sats"}, nil
+		}
+		histsQuery = db.Model((*core.UserNodeSatHistory)(nil)).Column("pings").Where("sat_label = ?", satLabel)
+	} else if proto == core.PingProtoQUIC {
+		histsQuery = db.Model((*core.UserNodeHistory)(nil)).ColumnExpr("quic_pings AS pings").Where("quic_pings IS NOT NULL")
+	} else {
+		histsQuery = db.Model((*core.UserNodeHistory)(nil)).Column("pings")
+	}
+	histsQuery = histsQuery.Column("date", "resolution").
+		Where("node_id = ? AND date BETWEEN ? AND ?", nodeID, startDateStr, endDateStr).
+		Where(ownerCond, ownerParams...).
+		Order("date")
+
+	if err := histsQuery.Select(&histories); err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	if format != "" {
+		return writeUserNodePingRecords(wr, nodeID, startDateStr, endDateStr, format, histories)
+	}
+
+	// each day is written as: uint32 date stamp, uint16 resolution (minutes per item), 1440/resolution items;
+	// full items are raw int16 values, short ones are bytes: 0 - no data, 1 - fail, 2-254 - scaled ping, 255 - maintenance
+	wr.Header().Set("Content-Type", "application/octet-stream")
+	itemSize := 1
+	if fullPingsData {
+		itemSize = 2
+	}
+	for _, hist := range histories {
+		buf := make([]byte, 6+len(hist.Pings)*itemSize)
+		binary.LittleEndian.PutUint32(buf, uint32(hist.Date.Unix()))
+		binary.LittleEndian.PutUint16(buf[4:], uint16(hist.Resolution))
+		for i, ping := range hist.Pings {
+			if fullPingsData {
+				binary.LittleEndian.PutUint16(buf[6+i*2:], uint16(ping))
+			} else if ping < 0 {
+				buf[6+i] = 255
+			} else {
+				val := int(ping) % 2000
+				if val > 1 {
+					val = val * 256 / 2000
+					if val <= 1 {
+						val = 2
+					}
+					if val >= 255 {
+						val = 254
+					}
+				}
+				buf[6+i] = byte(val)
+			}
+		}
+		if _, err := wr.Write(buf); err != nil {
+			return nil, merry.Wrap(err)
+		}
+	}
+	return nil, nil
+}
+
+func setAttachmentFilename(wr http.ResponseWriter, fname string) {
+	wr.Header().Set("Content-Disposition", `attachment; filename="`+fname+`"`)
+}
+
+// writeUserNodePingRecords writes decoded history (one record per check) as CSV or JSON file
+func writeUserNodePingRecords(wr http.ResponseWriter, nodeID storj.NodeID, startDateStr, endDateStr, format string, histories []*core.UserNodeHistory) (interface{}, error) {
+	records := make([]core.HistoryPingRecord, 0)
+	for _, hist := range histories {
+		records = append(records, core.DecodeHistoryPings(hist.Date, hist.Resolution, hist.Pings)...)
+	}
+
+	setAttachmentFilename(wr, "storjnet_pings_"+nodeID.String()[:8]+"_"+startDateStr+"_"+endDateStr+"."+format)
+	if format == "json" {
+		wr.Header().Set("Content-Type", "application/json")
+		return nil, merry.Wrap(json.NewEncoder(wr).Encode(records))
+	}
+
+	wr.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(wr)
+	w.Write([]string{"time", "ok", "ping_ms", "maintenance"})
+	for _, rec := range records {
+		ping := ""
+		if rec.Ok {
+			ping = strconv.FormatInt(rec.Ping, 10)
+		}
+		w.Write([]string{rec.Time.UTC().Format(time.RFC3339), strconv.FormatBool(rec.Ok), ping, strconv.FormatBool(rec.Maintenance)})
+	}
+	w.Flush()
+	return nil, merry.Wrap(w.Error())
+}
+
+func HandleAPIUserNodesUptimeReport(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	query := r.URL.Query()
+
+	month := time.Now().In(time.UTC)
+	if monthStr := query.Get("month"); monthStr != "" {
+		var err error
+		month, err = time.Parse("2006-01", monthStr)
+		if err != nil {
+			return httputils.JsonError{Code: 400, Error: "WRONG_MONTH"}, nil
+		}
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return httputils.JsonError{Code: 400, Error: "WRONG_FORMAT"}, nil
+	}
+
+	reports, err := core.LoadUserNodesUptimeReport(db, user, month)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if format == "" {
+		return reports, nil
+	}
+
+	// explicit format means file download
+	setAttachmentFilename(wr, "storjnet_uptime_"+month.Format("2006-01")+"."+format)
+	if format == "json" {
+		wr.Header().Set("Content-Type", "application/json")
+		return nil, merry.Wrap(json.NewEncoder(wr).Encode(reports))
+	}
+
+	wr.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(wr)
+	w.Write([]string{"node_id", "address", "month", "checked_minutes", "down_minutes", "maintenance_minutes", "uptime_percent",
+		"outages_count", "longest_outage_minutes", "median_ping_ms", "p95_ping_ms"})
+	for _, rep := range reports {
+		w.Write([]string{
+			rep.NodeID.String(), rep.Address, rep.Month,
+			strconv.FormatInt(rep.CheckedMinutes, 10),
+			strconv.FormatInt(rep.DownMinutes, 10),
+			strconv.FormatInt(rep.MaintenanceMinutes, 10),
+			strconv.FormatFloat(rep.UptimePercent, 'f', 3, 64),
+			strconv.FormatInt(rep.OutagesCount, 10),
+			strconv.FormatInt(rep.LongestOutageMinutes, 10),
+			strconv.FormatInt(rep.MedianPing, 10),
+			strconv.FormatInt(rep.P95Ping, 10),
+		})
+	}
+	w.Flush()
+	return nil, merry.Wrap(w.Error())
+}
+
+func HandleAPIUserTexts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+
+	buf, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO user_texts (user_id, date, text, updated_at) VALUES (?, (NOW() at time zone 'utc')::date, ?, NOW())
+		ON CONFLICT (user_id, date) DO UPDATE SET text = EXCLUDED.text, updated_at = NOW()`,
+		user.ID, string(buf))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIGetUserAlerts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserAlertSettings(db, user)
+}
+
+func HandleAPISetUserAlerts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		FailsCount      int64
+		DownMinutes     int64
+		EmailNodeEvents bool
+		EmailVersions   bool
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.FailsCount < 1 || params.FailsCount > 24*60 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_FAILS_COUNT"}, nil
+	}
+	if params.DownMinutes < 0 || params.DownMinutes > 24*60 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_DOWN_MINUTES"}, nil
+	}
+	return core.SetUserAlertSettings(db, user, params.FailsCount, params.DownMinutes,
+		params.EmailNodeEvents, params.EmailVersions, langFromRequest(r))
+}
+
+func HandleAPISetUserEmail(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	mailer := r.Context().Value(CtxKeyMailer).(utils.Mailer)
+	params := &struct {
+		Email string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(params.Email))
+	if err != nil || addr.Name != "" || len(addr.Address) > 256 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_EMAIL"}, nil
+	}
+	err = core.StartUserEmailVerification(db, mailer, user, addr.Address, langFromRequest(r))
+	if merry.Is(err, core.ErrEmailVerificationTooFrequent) {
+		return httputils.JsonError{Code: 400, Error: "TOO_FREQUENT"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return core.LoadUserAlertSettings(db, user)
+}
+
+func HandleAPIVerifyUserEmail(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		Code string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	_, err := core.FinishUserEmailVerification(db, user, strings.TrimSpace(params.Code))
+	if merry.Is(err, core.ErrEmailVerificationNotFound) {
+		return httputils.JsonError{Code: 400, Error: "VERIFICATION_NOT_FOUND"}, nil
+	}
+	if merry.Is(err, core.ErrEmailVerificationWrongCode) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_CODE"}, nil
+	}
+	if merry.Is(err, core.ErrEmailExsists) {
+		return httputils.JsonError{Code: 400, Error: "EMAIL_EXISTS"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return core.LoadUserAlertSettings(db, user)
+}
+
+func HandleAPIDelUserEmail(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	if err := core.DelUserEmail(db, user); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return core.LoadUserAlertSettings(db, user)
+}
+
+func HandleAPIGetUserAPITokens(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserAPITokens(db, user)
+}
+
+func HandleAPICreateUserAPIToken(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		Name     string
+		ReadOnly bool
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > 64 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_NAME"}, nil
+	}
+	apiToken, token, err := core.CreateUserAPIToken(db, user, params.Name, params.ReadOnly)
+	if merry.Is(err, core.ErrTooManyAPITokens) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_TOKENS"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return map[string]interface{}{"token": token, "info": apiToken}, nil
+}
+
+func HandleAPIDelUserAPIToken(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		ID int64
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err := core.DelUserAPIToken(db, user, params.ID); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIGetUserMaintenanceWindows(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserMaintenanceWindows(db, user)
+}
+
+func HandleAPIAddUserMaintenanceWindow(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		NodeID          string
+		StartsAt        time.Time
+		DurationMinutes int64
+		Recurrence      string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.Recurrence == "" {
+		params.Recurrence = core.MaintenanceOnce
+	}
+	if !core.IsValidMaintenanceWindow(params.StartsAt, params.DurationMinutes, params.Recurrence) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_MAINTENANCE_WINDOW"}, nil
+	}
+	window := &core.MaintenanceWindow{
+		StartsAt:        params.StartsAt,
+		DurationMinutes: params.DurationMinutes,
+		Recurrence:      params.Recurrence,
+	}
+	if params.NodeID != "" {
+		nodeID, err := storj.NodeIDFromString(params.NodeID)
+		if err != nil {
+			return httputils.JsonError{Code: 400, Error: "NODE_ID_DECODE_ERROR", Description: err.Error()}, nil
+		}
+		window.NodeID = &nodeID
+	}
+	err := core.AddUserMaintenanceWindow(db, user, window)
+	if merry.Is(err, core.ErrTooManyMaintenanceWindows) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_MAINTENANCE_WINDOWS"}, nil
+	}
+	if merry.Is(err, core.ErrMaintenanceNodeNotFound) {
+		return httputils.JsonError{Code: 400, Error: "NODE_NOT_FOUND"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return window, nil
+}
+
+func HandleAPIDelUserMaintenanceWindow(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		ID int64
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err := core.DelUserMaintenanceWindow(db, user, params.ID); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIGetUserNodeGroups(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserNodeGroups(db, user)
+}
+
+func HandleAPIAddUserNodeGroup(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		Name string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 64 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_GROUP_NAME"}, nil
+	}
+	group, err := core.AddUserNodeGroup(db, user, name)
+	if merry.Is(err, core.ErrTooManyNodeGroups) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_GROUPS"}, nil
+	}
+	if merry.Is(err, core.ErrNodeGroupExists) {
+		return httputils.JsonError{Code: 400, Error: "GROUP_EXISTS"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return group, nil
+}
+
+func HandleAPIDelUserNodeGroup(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		ID int64
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err := core.DelUserNodeGroup(db, user, params.ID); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPISetUserNodeGroupMembers(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		GroupID int64
+		NodeIDs []storj.NodeID
+		Remove  bool
+	}{}
+	if jsonErr := unmarshalNodeFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	err := core.SetUserNodeGroupMembers(db, user, params.GroupID, params.NodeIDs, params.Remove)
+	if merry.Is(err, core.ErrNodeGroupNotFound) {
+		return httputils.JsonError{Code: 400, Error: "GROUP_NOT_FOUND"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
+}
+
+func HandleAPIGetUserNodeGroupShares(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserNodeGroupShares(db, user)
+}
+
+func HandleAPIAddUserNodeGroupShare(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		GroupID  int64
+		IsPublic bool
+		Key      string
+		MaskIDs  bool
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if params.IsPublic && !core.IsValidPublicShareKey(params.Key) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_SHARE_KEY"}, nil
+	}
+	share, err := core.AddUserNodeGroupShare(db, user, params.GroupID, params.IsPublic, params.Key, params.MaskIDs)
+	if merry.Is(err, core.ErrTooManyNodeGroupShares) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_SHARES"}, nil
+	}
+	if merry.Is(err, core.ErrNodeGroupNotFound) {
+		return httputils.JsonError{Code: 400, Error: "GROUP_NOT_FOUND"}, nil
+	}
+	if merry.Is(err, core.ErrNodeGroupShareKeyExists) {
+		return httputils.JsonError{Code: 400, Error: "SHARE_KEY_EXISTS"}, nil
+	}
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return share, nil
+}
+
+func HandleAPIDelUserNodeGroupShare(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		ID int64
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err := core.DelUserNodeGroupShare(db, user, params.ID); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return "ok", nil
 }
 
-func HandleAPIRegister(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPIGetUserOrgs(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyAuthUser).(*core.User)
+	return core.LoadUserOrgs(db, user)
+}
+
+func HandleAPICreateOrg(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyAuthUser).(*core.User)
 	params := &struct {
-		Username, Password string
+		Name string
 	}{}
 	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
 		return *jsonErr, nil
 	}
-	if len(params.Username) < 3 {
-		return httputils.JsonError{Code: 400, Error: "USERNAME_TO_SHORT"}, nil
+	name := strings.TrimSpace(params.Name)
+	if len(name) < 3 || len(name) > 64 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_ORG_NAME"}, nil
+	}
+	org, err := core.CreateOrg(db, user, name)
+	if merry.Is(err, core.ErrTooManyOrgs) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_ORGS"}, nil
 	}
-	_, err := core.RegisterUser(db, wr, params.Username, params.Password)
 	if merry.Is(err, core.ErrUsernameExsists) {
-		return httputils.JsonError{Code: 400, Error: "USERNAME_EXISTS"}, nil
+		return httputils.JsonError{Code: 400, Error: "ORG_NAME_EXISTS"}, nil
 	}
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	return "ok", nil
+	return org, nil
 }
 
-func HandleAPILogin(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+// findOrgFromParams returns org from "org_id" URL param if current (logged in) user is its member.
+func findOrgFromParams(r *http.Request, ps httprouter.Params) (*core.User, string, *httputils.JsonError, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
-	params := &struct {
-		Username, Password string
-	}{}
-	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
-		return *jsonErr, nil
+	user := r.Context().Value(CtxKeyAuthUser).(*core.User)
+	orgID, err := strconv.ParseInt(ps.ByName("org_id"), 10, 64)
+	if err != nil {
+		return nil, "", &httputils.JsonError{Code: 400, Error: "WRONG_ORG_ID"}, nil
 	}
-	_, err := core.LoginUser(db, wr, params.Username, params.Password)
-	if merry.Is(err, core.ErrUserNotFound) {
-		return httputils.JsonError{Code: 403, Error: "WRONG_USERNAME_OR_PASSWORD"}, nil
+	org, role, err := core.FindOrgForMember(db, user, orgID)
+	if merry.Is(err, core.ErrOrgNotFound) {
+		return nil, "", &httputils.JsonError{Code: 404, Error: "ORG_NOT_FOUND"}, nil
 	}
+	if err != nil {
+		return nil, "", nil, merry.Wrap(err)
+	}
+	return org, role, nil, nil
+}
+
+func HandleAPIGetOrgMembers(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	org, _, jsonErr, err := findOrgFromParams(r, ps)
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	return "ok", nil
+	if jsonErr != nil {
+		return *jsonErr, nil
+	}
+	return core.LoadOrgMembers(db, org.ID)
 }
 
-func HandleAPISetUserNode(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPISetOrgMember(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
-	user := r.Context().Value(CtxKeyUser).(*core.User)
-	node := &core.Node{}
-	if jsonErr := unmarshalNodeFromBody(r, node); jsonErr != nil {
+	org, role, jsonErr, err := findOrgFromParams(r, ps)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if jsonErr != nil {
 		return *jsonErr, nil
 	}
-	err := core.SetUserNode(db, user, node)
+	if role != core.OrgRoleOwner {
+		return httputils.JsonError{Code: 403, Error: "NOT_ORG_OWNER"}, nil
+	}
+	params := &struct {
+		Username string
+		Role     string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if !core.IsValidOrgRole(params.Role) {
+		return httputils.JsonError{Code: 400, Error: "WRONG_ROLE"}, nil
+	}
+	member, err := core.SetOrgMember(db, org.ID, strings.TrimSpace(params.Username), params.Role)
+	if merry.Is(err, core.ErrUserNotFound) {
+		return httputils.JsonError{Code: 400, Error: "USER_NOT_FOUND"}, nil
+	}
+	if merry.Is(err, core.ErrTooManyOrgMembers) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_MEMBERS"}, nil
+	}
+	if merry.Is(err, core.ErrLastOrgOwner) {
+		return httputils.JsonError{Code: 400, Error: "LAST_OWNER"}, nil
+	}
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	return node, nil
+	return member, nil
 }
 
-func HandleAPIDelUserNode(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+// HandleAPIDelOrgMember removes a member (only owners can do it) or current user (leaving the org).
+func HandleAPIDelOrgMember(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
-	user := r.Context().Value(CtxKeyUser).(*core.User)
+	user := r.Context().Value(CtxKeyAuthUser).(*core.User)
+	org, role, jsonErr, err := findOrgFromParams(r, ps)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if jsonErr != nil {
+		return *jsonErr, nil
+	}
 	params := &struct {
-		ID storj.NodeID
+		UserID int64
 	}{}
 	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
 		return *jsonErr, nil
 	}
-	err := core.DelUserNode(db, user, params.ID)
+	if role != core.OrgRoleOwner && params.UserID != user.ID {
+		return httputils.JsonError{Code: 403, Error: "NOT_ORG_OWNER"}, nil
+	}
+	err = core.DelOrgMember(db, org.ID, params.UserID)
+	if merry.Is(err, core.ErrLastOrgOwner) {
+		return httputils.JsonError{Code: 400, Error: "LAST_OWNER"}, nil
+	}
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
 	return "ok", nil
 }
 
-func HandleAPIGetSatNodes(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPIGetUserWebhooks(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
-	startDate, endDate := extractStartEndDatesFromQuery(r.URL.Query(), false)
-	return core.LoadSatNodes(db, startDate, endDate)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	return core.LoadUserWebhooks(db, user, 10)
 }
 
-func HandleAPIUserNodePings(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPIAddUserWebhook(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
-	nodeID, err := storj.NodeIDFromString(ps.ByName("node_id"))
-	if err != nil {
-		return httputils.JsonError{Code: 400, Error: "NODE_ID_DECODE_ERROR", Description: err.Error()}, nil
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+	params := &struct {
+		URL string
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
 	}
-
-	query := r.URL.Query()
-	startDateStr, endDateStr := extractStartEndDatesStrFromQuery(query, false)
-	fullPingsData := query.Get("full") == "1"
-
-	var histories []*core.UserNodeHistory
-	histsQuery := db.Model(&histories).Column("pings", "date").
-		Where("node_id = ? AND date BETWEEN ? AND ?", nodeID, startDateStr, endDateStr).
-		Order("date")
-
-	if strings.Contains(r.URL.Path, "/sat/") {
-		histsQuery = histsQuery.
-			Where("user_id = (SELECT id FROM users WHERE username = 'satellites')")
-	} else {
-		user := r.Context().Value(CtxKeyUser).(*core.User)
-		histsQuery = histsQuery.Where("user_id = ?", user.ID)
+	u, err := url.Parse(strings.TrimSpace(params.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || len(params.URL) > 1024 {
+		return httputils.JsonError{Code: 400, Error: "WRONG_URL"}, nil
 	}
-
-	if err = histsQuery.Select(); err != nil {
-		return nil, merry.Wrap(err)
+	webhook, err := core.AddUserWebhook(db, user, u.String())
+	if merry.Is(err, core.ErrTooManyWebhooks) {
+		return httputils.JsonError{Code: 400, Error: "TOO_MANY_WEBHOOKS"}, nil
 	}
-
-	wr.Header().Set("Content-Type", "application/octet-stream")
-	if fullPingsData {
-		buf := make([]byte, 4+1440*2)
-		for _, hist := range histories {
-			binary.LittleEndian.PutUint32(buf, uint32(hist.Date.Unix()))
-			for i, ping := range hist.Pings {
-				buf[4+i*2+0] = byte(ping & 0xFF)
-				buf[4+i*2+1] = byte(ping >> 8)
-			}
-			_, err := wr.Write(buf)
-			if err != nil {
-				return nil, merry.Wrap(err)
-			}
-		}
-	} else {
-		buf := make([]byte, 4+1440)
-		for _, hist := range histories {
-			binary.LittleEndian.PutUint32(buf, uint32(hist.Date.Unix()))
-			for i, ping := range hist.Pings {
-				val := int(ping) % 2000
-				if val > 1 {
-					val = val * 256 / 2000
-					if val <= 1 {
-						val = 2
-					}
-				}
-				buf[4+i] = byte(val)
-			}
-			_, err := wr.Write(buf)
-			if err != nil {
-				return nil, merry.Wrap(err)
-			}
-		}
+	if err != nil {
+		return nil, merry.Wrap(err)
 	}
-	return nil, nil
+	return webhook, nil
 }
 
-func HandleAPIUserTexts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+func HandleAPIDelUserWebhook(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 	user := r.Context().Value(CtxKeyUser).(*core.User)
-
-	buf, err := io.ReadAll(r.Body)
-	if err != nil {
+	params := &struct {
+		ID int64
+	}{}
+	if jsonErr := unmarshalFromBody(r, params); jsonErr != nil {
+		return *jsonErr, nil
+	}
+	if err := core.DelUserWebhook(db, user, params.ID); err != nil {
 		return nil, merry.Wrap(err)
 	}
+	return "ok", nil
+}
 
-	_, err = db.Exec(`
-		INSERT INTO user_texts (user_id, date, text, updated_at) VALUES (?, (NOW() at time zone 'utc')::date, ?, NOW())
-		ON CONFLICT (user_id, date) DO UPDATE SET text = EXCLUDED.text, updated_at = NOW()`,
-		user.ID, string(buf))
+func loadStorjTokenTxSummary(db *pg.DB, startDateStr, endDateStr string) ([]*core.StorjTokenTxSummary, error) {
+	daySums := make([]*core.StorjTokenTxSummary, 0)
+	err := db.Model(&daySums).
+		Where("date BETWEEN ? AND ?", startDateStr, endDateStr).
+		Order("date").Select()
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
-	return "ok", nil
+	return daySums, nil
 }
 
 func HandleAPIStorjTokenTxSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 
 	startDateStr, endDateStr := extractStartEndDatesStrFromQuery(r.URL.Query(), false)
-
-	var daySums []*core.StorjTokenTxSummary
-	err := db.Model(&daySums).
-		Where("date BETWEEN ? AND ?", startDateStr, endDateStr).
-		Order("date").Select()
+	daySums, err := loadStorjTokenTxSummary(db, startDateStr, endDateStr)
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
+	if wantsJSON(wr, r) {
+		return daySums, nil
+	}
 
 	wr.Header().Set("Content-Type", "application/octet-stream")
 	buf := make([]byte, 4+24*(4+4+4+4))
@@ -668,10 +1722,13 @@ func HandleAPIStorjTokenTxSummary(wr http.ResponseWriter, r *http.Request, ps ht
 	return nil, nil
 }
 
-func HandleAPINodesLocations(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
-	db := r.Context().Value(ctxKey("db")).(*pg.DB)
+type NodeLocation struct {
+	Lon float32 `json:"lon"`
+	Lat float32 `json:"lat"`
+}
 
-	var nodeLocations []struct{ Lon, Lat float32 }
+func loadNodesLocations(db *pg.DB) ([]NodeLocation, error) {
+	nodeLocations := make([]NodeLocation, 0)
 	// sorting improves compression ratio: 55kb -> 24kb (85kb uncompressed original)
 	// sorting by (jsonb)::float8 is faster than just by jsonb
 	_, err := db.Query(&nodeLocations, `
@@ -681,6 +1738,19 @@ func HandleAPINodesLocations(wr http.ResponseWriter, r *http.Request, ps httprou
 	if err != nil {
 		return nil, merry.Wrap(err)
 	}
+	return nodeLocations, nil
+}
+
+func HandleAPINodesLocations(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+
+	nodeLocations, err := loadNodesLocations(db)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if wantsJSON(wr, r) {
+		return nodeLocations, nil
+	}
 
 	buf := make([]byte, len(nodeLocations)*4)
 	for i, loc := range nodeLocations {
@@ -697,23 +1767,26 @@ func HandleAPINodesLocations(wr http.ResponseWriter, r *http.Request, ps httprou
 	return nil, merry.Wrap(err)
 }
 
-func HandleAPINodesLocationSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+type NodesLocationSummaryItem struct {
+	Country    string `json:"country"`
+	Nodes      int64  `json:"nodes"`
+	ISPNodes   int64  `json:"ispNodes"`
+	Subnets    int64  `json:"subnets"`
+	ISPSubnets int64  `json:"ispSubnets"`
+}
+
+type NodesLocationSummary struct {
+	CountriesCount int64                      `json:"countriesCount"`
+	CountriesTop   []NodesLocationSummaryItem `json:"countriesTop"`
+}
+
+func HandleAPINodesLocationSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (NodesLocationSummary, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 
 	endDate := extractEndDateFromQuery(r.URL.Query())
 	lang := strings.ToLower(r.URL.Query().Get("lang"))
 
-	type TopItem struct {
-		Country    string `json:"country"`
-		Nodes      int64  `json:"nodes"`
-		ISPNodes   int64  `json:"ispNodes"`
-		Subnets    int64  `json:"subnets"`
-		ISPSubnets int64  `json:"ispSubnets"`
-	}
-	var stats struct {
-		CountriesCount int64     `json:"countriesCount"`
-		CountriesTop   []TopItem `json:"countriesTop"`
-	}
+	var stats NodesLocationSummary
 	// do not QueryOne: there may be no data and empty (unchanged) stats should be returned
 	_, err := db.Query(&stats, `
 		SELECT
@@ -742,10 +1815,10 @@ func HandleAPINodesLocationSummary(wr http.ResponseWriter, r *http.Request, ps h
 		ORDER BY id DESC LIMIT 1
 		`, endDate.AddDate(0, 0, 1))
 	if err != nil {
-		return nil, merry.Wrap(err)
+		return NodesLocationSummary{}, merry.Wrap(err)
 	}
 	if stats.CountriesTop == nil {
-		stats.CountriesTop = []TopItem{}
+		stats.CountriesTop = []NodesLocationSummaryItem{}
 	}
 	// "rus" -> "Russia"
 	for i, item := range stats.CountriesTop {
@@ -758,34 +1831,40 @@ func HandleAPINodesLocationSummary(wr http.ResponseWriter, r *http.Request, ps h
 	return stats, nil
 }
 
-func HandleAPINodesSubnetSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+type NodesSubnetTopItem struct {
+	Subnet string `json:"subnet"`
+	Size   int64  `json:"size"`
+}
+
+type NodesSubnetSizeItem struct {
+	Size  int64 `json:"size"`
+	Count int64 `json:"count"`
+}
+
+type NodesASNTopItem struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type NodesIPTypeItem struct {
+	Type   string            `json:"type"`
+	Count  int64             `json:"count"`
+	ASNTop []NodesASNTopItem `json:"asnTop"`
+}
+
+type NodesSubnetSummary struct {
+	SubnetsCount int64                 `json:"subnetsCount"`
+	SubnetsTop   []NodesSubnetTopItem  `json:"subnetsTop"`
+	SubnetSizes  []NodesSubnetSizeItem `json:"subnetSizes"`
+	IPTypes      []NodesIPTypeItem     `json:"ipTypes"`
+}
+
+func HandleAPINodesSubnetSummary(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (NodesSubnetSummary, error) {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 
 	endDate := extractEndDateFromQuery(r.URL.Query())
 
-	type TopItem struct {
-		Subnet string `json:"subnet"`
-		Size   int64  `json:"size"`
-	}
-	type SizeItem struct {
-		Size  int64 `json:"size"`
-		Count int64 `json:"count"`
-	}
-	type ASNTopItem struct {
-		Name  string `json:"name"`
-		Count int64  `json:"count"`
-	}
-	type IPTypeItem struct {
-		Type   string       `json:"type"`
-		Count  int64        `json:"count"`
-		ASNTop []ASNTopItem `json:"asnTop"`
-	}
-	var stats struct {
-		SubnetsCount int64        `json:"subnetsCount"`
-		SubnetsTop   []TopItem    `json:"subnetsTop"`
-		SubnetSizes  []SizeItem   `json:"subnetSizes"`
-		IPTypes      []IPTypeItem `json:"ipTypes"`
-	}
+	var stats NodesSubnetSummary
 	// do not QueryOne: there may be no data and empty (unchanged) stats should be returned
 	_, err := db.Query(&stats, `
 		SELECT
@@ -837,23 +1916,23 @@ func HandleAPINodesSubnetSummary(wr http.ResponseWriter, r *http.Request, ps htt
 		ORDER BY id DESC LIMIT 1
 		`, endDate.AddDate(0, 0, 1))
 	if err != nil {
-		return nil, merry.Wrap(err)
+		return NodesSubnetSummary{}, merry.Wrap(err)
 	}
 	for _, subnetSize := range stats.SubnetSizes {
 		stats.SubnetsCount += subnetSize.Count
 	}
 	if stats.SubnetsTop == nil {
-		stats.SubnetsTop = []TopItem{}
+		stats.SubnetsTop = []NodesSubnetTopItem{}
 	}
 	if stats.SubnetSizes == nil {
-		stats.SubnetSizes = []SizeItem{}
+		stats.SubnetSizes = []NodesSubnetSizeItem{}
 	}
 	if stats.IPTypes == nil {
-		stats.IPTypes = []IPTypeItem{}
+		stats.IPTypes = []NodesIPTypeItem{}
 	}
 	for i, item := range stats.IPTypes {
 		if item.ASNTop == nil {
-			stats.IPTypes[i].ASNTop = []ASNTopItem{}
+			stats.IPTypes[i].ASNTop = []NodesASNTopItem{}
 		}
 	}
 	return stats, nil
@@ -987,14 +2066,21 @@ func (cs *CountriesStat) Scan(src interface{}) error {
 	return nil
 }
 
-func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
-	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+type NodesCountryCounts struct {
+	A3Code string  `json:"a3Code"`
+	Name   string  `json:"name"`
+	Counts []int64 `json:"counts"`
+}
 
-	query := r.URL.Query()
-	startDate, endDate := extractStartEndDatesFromQuery(query, false)
-	needAllCountries := query.Get("all") == "1"
-	lang := strings.ToLower(r.URL.Query().Get("lang"))
+// NodesCountries contains hourly nodes counts by country (Counts[i] is for StartStamp + i hours).
+type NodesCountries struct {
+	StartStamp int64                 `json:"startStamp"`
+	Countries  []*NodesCountryCounts `json:"countries"`
+}
 
+// loadNodesCountries returns counts for all countries or only for the ones
+// that were in top 15 at least once (sampling every 3 hours).
+func loadNodesCountries(db *pg.DB, startDate, endDate time.Time, needAllCountries bool, lang string) (*NodesCountries, error) {
 	var items []struct {
 		Stamp     int64
 		Countries *CountriesStat
@@ -1041,15 +2127,6 @@ func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprou
 		}
 	}
 
-	maxNameLen := 0
-	for _, a3Code := range filterA3Codes {
-		nameOrCode, _ := utils.CountryA3ToName(a3Code, lang)
-		if len(nameOrCode) > maxNameLen {
-			maxNameLen = len(nameOrCode)
-		}
-	}
-	maxNameLen += 3 + 1 //A3 name prefix + separator
-
 	startStamp := startDate.Unix()
 	maxStamp := startStamp
 	for _, item := range items {
@@ -1059,25 +2136,70 @@ func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprou
 	}
 	countsArrLen := int((maxStamp-startStamp)/3600 + 1)
 
+	res := &NodesCountries{StartStamp: startStamp, Countries: make([]*NodesCountryCounts, len(filterA3Codes))}
+	for i, a3Code := range filterA3Codes {
+		name, _ := utils.CountryA3ToName(a3Code, lang)
+		country := &NodesCountryCounts{A3Code: a3Code, Name: name, Counts: make([]int64, countsArrLen)}
+		prevIndex := -1
+		for _, item := range items {
+			var count int64
+			count, prevIndex = item.Countries.items.FindCountFor(a3Code, prevIndex)
+			country.Counts[(item.Stamp-startStamp)/3600] = count
+		}
+		res.Countries[i] = country
+	}
+	return res, nil
+}
+
+func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+
+	query := r.URL.Query()
+	startDate, endDate := extractStartEndDatesFromQuery(query, false)
+	needAllCountries := query.Get("all") == "1"
+	lang := strings.ToLower(r.URL.Query().Get("lang"))
+
+	countries, err := loadNodesCountries(db, startDate, endDate, needAllCountries, lang)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if wantsJSON(wr, r) {
+		return countries, nil
+	}
+
+	maxNameLen := 0
+	for _, country := range countries.Countries {
+		if len(country.Name) > maxNameLen {
+			maxNameLen = len(country.Name)
+		}
+	}
+	maxNameLen += 3 + 1 //A3 name prefix + separator
+
+	countsArrLen := 0
+	if len(countries.Countries) > 0 {
+		countsArrLen = len(countries.Countries[0].Counts)
+	} else {
+		countsArrLen = 1 //no data
+	}
+
 	wr.Header().Set("Content-Type", "application/octet-stream")
 
 	buf := make([]byte, 8)
-	binary.LittleEndian.PutUint32(buf, uint32(startStamp))
+	binary.LittleEndian.PutUint32(buf, uint32(countries.StartStamp))
 	binary.LittleEndian.PutUint32(buf[4:], uint32(countsArrLen))
 	if _, err := wr.Write(buf); err != nil {
 		return nil, merry.Wrap(err)
 	}
 
 	buf = make([]byte, 1+(maxNameLen+1)+2*countsArrLen)
-	for _, a3Code := range filterA3Codes {
+	for _, country := range countries.Countries {
 		// zeroing
 		for i := range buf {
 			buf[i] = 0
 		}
 
 		// country name
-		name, _ := utils.CountryA3ToName(a3Code, lang)
-		name = a3Code + "|" + name
+		name := country.A3Code + "|" + country.Name
 		buf[0] = byte(len(name))
 		copy(buf[1:], []byte(name))
 
@@ -1086,11 +2208,7 @@ func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprou
 			valOffset += 1
 		}
 		// country counts
-		prevIndex := -1
-		for _, item := range items {
-			i := int((item.Stamp - startStamp) / 3600)
-			var count int64
-			count, prevIndex = item.Countries.items.FindCountFor(a3Code, prevIndex)
+		for i, count := range country.Counts {
 			buf[valOffset+2*i+0] = byte(count)
 			buf[valOffset+2*i+1] = byte(count >> 8)
 		}
@@ -1101,11 +2219,27 @@ func HandleAPINodesCountries(wr http.ResponseWriter, r *http.Request, ps httprou
 	return nil, nil
 }
 
-func HandleAPINodesCounts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
-	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+type NodesCountsHour struct {
+	Active05h int64 `json:"active05h"`
+	Active8h  int64 `json:"active8h"`
+	Active24h int64 `json:"active24h"`
+	OffActive int64 `json:"offActive"` //max active nodes count among official satellite stats
+}
 
-	startDate, endDate := extractStartEndDatesFromQuery(r.URL.Query(), false)
+type NodesCountsDay struct {
+	Come int64 `json:"come"`
+	Left int64 `json:"left"`
+}
+
+// NodesCounts contains hourly active nodes counts (Counts[i] is for StartStamp + i hours)
+// and daily come/left nodes counts (Changes[i] is for StartStamp + i days).
+type NodesCounts struct {
+	StartStamp int64             `json:"startStamp"`
+	Counts     []NodesCountsHour `json:"counts"`
+	Changes    []NodesCountsDay  `json:"changes"`
+}
 
+func loadNodesCounts(db *pg.DB, startDate, endDate time.Time) (*NodesCounts, error) {
 	var counts []struct{ H05, H8, H24, Stamp int64 }
 	_, err := db.Query(&counts, `
 		SELECT
@@ -1157,7 +2291,10 @@ func HandleAPINodesCounts(wr http.ResponseWriter, r *http.Request, ps httprouter
 			maxStamp = count.Stamp
 		}
 	}
-	countsArrLen := (maxStamp-startStamp)/3600 + 1
+	countsArrLen := int64(0)
+	if len(counts) > 0 || len(offCounts) > 0 {
+		countsArrLen = (maxStamp-startStamp)/3600 + 1
+	}
 
 	changesArrLen := int64(0)
 	for i, change := range changes {
@@ -1172,32 +2309,64 @@ func HandleAPINodesCounts(wr http.ResponseWriter, r *http.Request, ps httprouter
 		changes[i].Delta = delta
 	}
 
-	const COUNTS_ITEM_SIZE = 8
-	const CHANGES_ITEM_SIZE = 4
-	buf := make([]byte, 4+4+int(countsArrLen)*COUNTS_ITEM_SIZE+4+int(changesArrLen)*CHANGES_ITEM_SIZE)
-	fullBuf := buf
-	binary.LittleEndian.PutUint32(buf, uint32(startStamp))
-	binary.LittleEndian.PutUint32(buf[4:], uint32(countsArrLen))
-	buf = buf[4+4:]
+	res := &NodesCounts{
+		StartStamp: startStamp,
+		Counts:     make([]NodesCountsHour, countsArrLen),
+		Changes:    make([]NodesCountsDay, changesArrLen),
+	}
 	for _, count := range counts {
-		i := (count.Stamp - startStamp) / 3600
-		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+0:], uint16(count.H05))
-		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+2:], uint16(count.H8))
-		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+4:], uint16(count.H24))
+		item := &res.Counts[(count.Stamp-startStamp)/3600]
+		item.Active05h = count.H05
+		item.Active8h = count.H8
+		item.Active24h = count.H24
 	}
 	for _, count := range offCounts {
-		i := (count.Stamp - startStamp) / 3600
-		s := buf[i*COUNTS_ITEM_SIZE+6:]
+		item := &res.Counts[(count.Stamp-startStamp)/3600]
 		// finding max hour count among all satellites
-		if uint16(count.Active) > binary.LittleEndian.Uint16(s) {
-			binary.LittleEndian.PutUint16(s, uint16(count.Active))
+		if count.Active > item.OffActive {
+			item.OffActive = count.Active
 		}
 	}
+	for _, change := range changes {
+		res.Changes[change.Delta] = NodesCountsDay{Come: change.Come, Left: change.Left}
+	}
+	return res, nil
+}
+
+func HandleAPINodesCounts(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+
+	startDate, endDate := extractStartEndDatesFromQuery(r.URL.Query(), false)
+	counts, err := loadNodesCounts(db, startDate, endDate)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if wantsJSON(wr, r) {
+		return counts, nil
+	}
+
+	const COUNTS_ITEM_SIZE = 8
+	const CHANGES_ITEM_SIZE = 4
+	countsArrLen := len(counts.Counts)
+	if countsArrLen == 0 {
+		countsArrLen = 1 //no data, chart expects at least one item
+	}
+	changesArrLen := len(counts.Changes)
+	buf := make([]byte, 4+4+countsArrLen*COUNTS_ITEM_SIZE+4+changesArrLen*CHANGES_ITEM_SIZE)
+	fullBuf := buf
+	binary.LittleEndian.PutUint32(buf, uint32(counts.StartStamp))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(countsArrLen))
+	buf = buf[4+4:]
+	for i, count := range counts.Counts {
+		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+0:], uint16(count.Active05h))
+		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+2:], uint16(count.Active8h))
+		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+4:], uint16(count.Active24h))
+		binary.LittleEndian.PutUint16(buf[i*COUNTS_ITEM_SIZE+6:], uint16(count.OffActive))
+	}
 	buf = buf[countsArrLen*COUNTS_ITEM_SIZE:]
 	binary.LittleEndian.PutUint32(buf, uint32(changesArrLen))
 	buf = buf[4:]
-	for _, change := range changes {
-		i := change.Delta
+	for i, change := range counts.Changes {
 		binary.LittleEndian.PutUint16(buf[i*CHANGES_ITEM_SIZE+0:], uint16(change.Come))
 		binary.LittleEndian.PutUint16(buf[i*CHANGES_ITEM_SIZE+2:], uint16(change.Left))
 	}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+// testDB connects to a migrated test DB, see core/account_test.go
+func testDB(t *testing.T) *pg.DB {
+	url := os.Getenv("STORJNET_TEST_DB")
+	if url == "" {
+		t.Skip("STORJNET_TEST_DB is not set")
+	}
+	opts, err := pg.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := pg.Connect(opts)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestChartDataJSONEmptyRange(t *testing.T) {
+	db := testDB(t)
+	//no stats for this interval
+	const query = "?format=json&start_date=2000-01-01&end_date=2000-01-07"
+
+	for _, c := range []struct {
+		path     string
+		handle   func(http.ResponseWriter, *http.Request, httprouter.Params) (interface{}, error)
+		expected string
+	}{
+		{"/api/nodes/counts", HandleAPINodesCounts, `{"startStamp":946684800,"counts":[],"changes":[]}`},
+		{"/api/nodes/countries", HandleAPINodesCountries, `{"startStamp":946684800,"countries":[]}`},
+		{"/api/storj_token/summary", HandleAPIStorjTokenTxSummary, `[]`},
+	} {
+		r := httptest.NewRequest("GET", c.path+query, nil)
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyDB, db))
+		res, err := c.handle(httptest.NewRecorder(), r, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(buf)) != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.path, c.expected, buf)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"storjnet/core"
+	"storjnet/utils/metrics"
+	"strconv"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+var (
+	httpRequestsCount = metrics.Default.NewCounter("storjnet_http_requests_total",
+		"HTTP requests by route and response status code.", "route", "code")
+	httpRequestDuration = metrics.Default.NewHistogram("storjnet_http_request_duration_seconds",
+		"HTTP requests duration by route.", metrics.DurationBuckets, "route")
+	httpErrorsCount = metrics.Default.NewCounter("storjnet_http_errors_total",
+		"HTTP handlers errors (responded with 500).")
+)
+
+// withRequestMetrics counts route requests and their durations
+// (route is a pattern like "GET /api/user_nodes/:node_id", not an actual path).
+func withRequestMetrics(route string, handle httprouter.Handle) httprouter.Handle {
+	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		stt := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: wr, status: http.StatusOK}
+		handle(sw, r, ps)
+		httpRequestDuration.Observe(time.Since(stt).Seconds(), route)
+		httpRequestsCount.Inc(route, strconv.Itoa(sw.status))
+	}
+}
+
+type networkNodeStats struct {
+	CreatedAt        time.Time
+	CountTotal       int64
+	ActiveCountHours map[string]int64
+	ActiveCountProto map[string]int64
+	Countries        map[string]int64
+	SubnetsCount     int64
+	SubnetSizes      map[string]int64
+}
+
+type satelliteNodeStats struct {
+	SatelliteHost     string
+	CreatedAt         time.Time
+	ActiveNodes       *int64
+	DisqualifiedNodes *int64
+	ExitedNodes       *int64
+	OfflineNodes      *int64
+	SuspendedNodes    *int64
+	TotalNodes        *int64
+	VettedNodes       *int64
+	FullNodes         *int64
+}
+
+type satelliteDataStats struct {
+	SatelliteHost                    string
+	CreatedAt                        time.Time
+	BandwidthBytesDownloaded         *int64
+	BandwidthBytesUploaded           *int64
+	StorageInlineBytes               *int64
+	StorageInlineSegments            *int64
+	StorageMedianHealthyPiecesCount  *int64
+	StorageMinHealthyPiecesCount     *int64
+	StorageRemoteBytes               *int64
+	StorageRemoteSegments            *int64
+	StorageRemoteSegmentsLost        *int64
+	StorageTotalBytes                *int64
+	StorageTotalObjects              *int64
+	StorageTotalPieces               *int64
+	StorageTotalSegments             *int64
+	StorageFreeCapacityEstimateBytes *int64
+}
+
+func loadNetworkMetrics(db *pg.DB) (*networkNodeStats, []*satelliteNodeStats, []*satelliteDataStats, error) {
+	var nodeStats []*networkNodeStats
+	_, err := db.Query(&nodeStats, `
+		SELECT created_at, count_total, active_count_hours, active_count_proto, countries, subnets_count, subnet_sizes
+		FROM node_stats ORDER BY created_at DESC LIMIT 1`)
+	if err != nil {
+		return nil, nil, nil, merry.Wrap(err)
+	}
+
+	var satNodeStats []*satelliteNodeStats
+	_, err = db.Query(&satNodeStats, `
+		SELECT DISTINCT ON (satellite_host)
+			satellite_host, created_at, active_nodes, disqualified_nodes, exited_nodes,
+			offline_nodes, suspended_nodes, total_nodes, vetted_nodes, full_nodes
+		FROM off_node_stats
+		WHERE created_at > now() - INTERVAL '7 days'
+		ORDER BY satellite_host, created_at DESC`)
+	if err != nil {
+		return nil, nil, nil, merry.Wrap(err)
+	}
+
+	var satDataStats []*satelliteDataStats
+	_, err = db.Query(&satDataStats, `
+		SELECT DISTINCT ON (satellite_host)
+			satellite_host, created_at, bandwidth_bytes_downloaded, bandwidth_bytes_uploaded,
+			storage_inline_bytes, storage_inline_segments,
+			storage_median_healthy_pieces_count, storage_min_healthy_pieces_count,
+			storage_remote_bytes, storage_remote_segments, storage_remote_segments_lost,
+			storage_total_bytes, storage_total_objects, storage_total_pieces, storage_total_segments,
+			storage_free_capacity_estimate_bytes
+		FROM off_data_stats
+		WHERE created_at > now() - INTERVAL '7 days'
+		ORDER BY satellite_host, created_at DESC`)
+	if err != nil {
+		return nil, nil, nil, merry.Wrap(err)
+	}
+
+	if len(nodeStats) == 0 {
+		return nil, satNodeStats, satDataStats, nil
+	}
+	return nodeStats[0], satNodeStats, satDataStats, nil
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeNetworkNodeMetrics(mw *metrics.Writer, stats *networkNodeStats) {
+	mw.Header("storjnet_node_stats_timestamp_seconds", metrics.TypeGauge, "Time of the latest network nodes stats update.")
+	mw.Sample("storjnet_node_stats_timestamp_seconds", float64(stats.CreatedAt.Unix()))
+
+	mw.Header("storjnet_nodes_total", metrics.TypeGauge, "Nodes ever seen in the network.")
+	mw.Sample("storjnet_nodes_total", float64(stats.CountTotal))
+
+	mw.Header("storjnet_nodes_active", metrics.TypeGauge, "Nodes seen online during the period.")
+	for _, period := range []string{"0.5", "8", "24"} {
+		if count, ok := stats.ActiveCountHours[period]; ok {
+			mw.Sample("storjnet_nodes_active", float64(count), "period", period+"h")
+		}
+	}
+
+	mw.Header("storjnet_nodes_reachable", metrics.TypeGauge, "Nodes reachable via protocol during the last 24h.")
+	for _, proto := range sortedKeys(stats.ActiveCountProto) {
+		mw.Sample("storjnet_nodes_reachable", float64(stats.ActiveCountProto[proto]), "proto", proto)
+	}
+
+	mw.Header("storjnet_nodes_country", metrics.TypeGauge, "Nodes active during the last 24h by country.")
+	for _, country := range sortedKeys(stats.Countries) {
+		mw.Sample("storjnet_nodes_country", float64(stats.Countries[country]), "country", country)
+	}
+
+	mw.Header("storjnet_subnets", metrics.TypeGauge, "/24 subnets with nodes active during the last 24h.")
+	mw.Sample("storjnet_subnets", float64(stats.SubnetsCount))
+
+	mw.Header("storjnet_subnets_by_size", metrics.TypeGauge, "/24 subnets by count of nodes in them.")
+	for _, size := range sortedKeys(stats.SubnetSizes) {
+		mw.Sample("storjnet_subnets_by_size", float64(stats.SubnetSizes[size]), "nodes", size)
+	}
+}
+
+func writeOptSample(mw *metrics.Writer, name string, value *int64, labels ...string) {
+	if value != nil {
+		mw.Sample(name, float64(*value), labels...)
+	}
+}
+
+func writeSatelliteNodeMetrics(mw *metrics.Writer, satStats []*satelliteNodeStats) {
+	mw.Header("storjnet_satellite_nodes", metrics.TypeGauge, "Nodes by status according to the satellite official stats.")
+	for _, s := range satStats {
+		for _, item := range []struct {
+			status string
+			value  *int64
+		}{
+			{"active", s.ActiveNodes},
+			{"disqualified", s.DisqualifiedNodes},
+			{"exited", s.ExitedNodes},
+			{"offline", s.OfflineNodes},
+			{"suspended", s.SuspendedNodes},
+			{"total", s.TotalNodes},
+			{"vetted", s.VettedNodes},
+			{"full", s.FullNodes},
+		} {
+			writeOptSample(mw, "storjnet_satellite_nodes", item.value, "satellite", s.SatelliteHost, "status", item.status)
+		}
+	}
+}
+
+func writeSatelliteDataMetrics(mw *metrics.Writer, satStats []*satelliteDataStats) {
+	mw.Header("storjnet_satellite_bandwidth_bytes", metrics.TypeGauge, "Bandwidth according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_bandwidth_bytes", s.BandwidthBytesDownloaded, "satellite", s.SatelliteHost, "direction", "downloaded")
+		writeOptSample(mw, "storjnet_satellite_bandwidth_bytes", s.BandwidthBytesUploaded, "satellite", s.SatelliteHost, "direction", "uploaded")
+	}
+
+	mw.Header("storjnet_satellite_storage_bytes", metrics.TypeGauge, "Stored data according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_storage_bytes", s.StorageTotalBytes, "satellite", s.SatelliteHost, "kind", "total")
+		writeOptSample(mw, "storjnet_satellite_storage_bytes", s.StorageRemoteBytes, "satellite", s.SatelliteHost, "kind", "remote")
+		writeOptSample(mw, "storjnet_satellite_storage_bytes", s.StorageInlineBytes, "satellite", s.SatelliteHost, "kind", "inline")
+		writeOptSample(mw, "storjnet_satellite_storage_bytes", s.StorageFreeCapacityEstimateBytes, "satellite", s.SatelliteHost, "kind", "free_capacity_estimate")
+	}
+
+	mw.Header("storjnet_satellite_segments", metrics.TypeGauge, "Stored segments according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_segments", s.StorageTotalSegments, "satellite", s.SatelliteHost, "kind", "total")
+		writeOptSample(mw, "storjnet_satellite_segments", s.StorageRemoteSegments, "satellite", s.SatelliteHost, "kind", "remote")
+		writeOptSample(mw, "storjnet_satellite_segments", s.StorageInlineSegments, "satellite", s.SatelliteHost, "kind", "inline")
+		writeOptSample(mw, "storjnet_satellite_segments", s.StorageRemoteSegmentsLost, "satellite", s.SatelliteHost, "kind", "remote_lost")
+	}
+
+	mw.Header("storjnet_satellite_objects", metrics.TypeGauge, "Stored objects according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_objects", s.StorageTotalObjects, "satellite", s.SatelliteHost)
+	}
+
+	mw.Header("storjnet_satellite_pieces", metrics.TypeGauge, "Stored pieces according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_pieces", s.StorageTotalPieces, "satellite", s.SatelliteHost)
+	}
+
+	mw.Header("storjnet_satellite_healthy_pieces", metrics.TypeGauge, "Healthy pieces per segment according to the satellite official stats.")
+	for _, s := range satStats {
+		writeOptSample(mw, "storjnet_satellite_healthy_pieces", s.StorageMedianHealthyPiecesCount, "satellite", s.SatelliteHost, "stat", "median")
+		writeOptSample(mw, "storjnet_satellite_healthy_pieces", s.StorageMinHealthyPiecesCount, "satellite", s.SatelliteHost, "stat", "min")
+	}
+}
+
+// HandleMetrics exposes latest network stats in Prometheus text format.
+func HandleMetrics(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+
+	nodeStats, satNodeStats, satDataStats, err := loadNetworkMetrics(db)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	wr.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(wr)
+	if nodeStats != nil {
+		writeNetworkNodeMetrics(mw, nodeStats)
+	}
+	writeSatelliteNodeMetrics(mw, satNodeStats)
+	writeSatelliteDataMetrics(mw, satDataStats)
+	return nil, merry.Wrap(mw.Flush())
+}
+
+func uptimeWindowLabel(window time.Duration) string {
+	hours := int(window.Hours())
+	if hours > 24 && hours%24 == 0 {
+		return strconv.Itoa(hours/24) + "d"
+	}
+	return strconv.Itoa(hours) + "h"
+}
+
+func boolToFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// HandleAPIUserNodesMetrics exposes user nodes status in Prometheus text format
+// (for scraping with API token: Authorization: Bearer snt_...).
+func HandleAPIUserNodesMetrics(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
+	db := r.Context().Value(CtxKeyDB).(*pg.DB)
+	user := r.Context().Value(CtxKeyUser).(*core.User)
+
+	nodes, err := core.LoadUserNodes(db, user, "")
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	uptimes, err := core.LoadUserNodesRollingUptime(db, user, time.Now())
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	labels := make([][]string, len(nodes))
+	for i, node := range nodes {
+		labels[i] = []string{"node_id", node.ID.String(), "address", node.Address}
+	}
+
+	wr.Header().Set("Content-Type", metrics.ContentType)
+	mw := metrics.NewWriter(wr)
+
+	mw.Header("storjnet_node_up", metrics.TypeGauge, "Whether the last node check was successful.")
+	for i, node := range nodes {
+		if !node.LastPingedAt.IsZero() {
+			mw.Sample("storjnet_node_up", boolToFloat(node.LastPingWasOk), labels[i]...)
+		}
+	}
+
+	mw.Header("storjnet_node_quic_up", metrics.TypeGauge, "Whether the last node QUIC check was successful (for nodes with QUIC checks).")
+	for i, node := range nodes {
+		if node.NeedsQUICPing() && !node.LastPingedAt.IsZero() {
+			mw.Sample("storjnet_node_quic_up", boolToFloat(node.LastQUICPingWasOk), labels[i]...)
+		}
+	}
+
+	mw.Header("storjnet_node_last_ping_seconds", metrics.TypeGauge, "Latency of the last successful node check.")
+	for i, node := range nodes {
+		if !node.LastUpAt.IsZero() {
+			mw.Sample("storjnet_node_last_ping_seconds", float64(node.LastPing)/1000, labels[i]...)
+		}
+	}
+
+	mw.Header("storjnet_node_last_up_timestamp_seconds", metrics.TypeGauge, "Time of the last successful node check.")
+	for i, node := range nodes {
+		if !node.LastUpAt.IsZero() {
+			mw.Sample("storjnet_node_last_up_timestamp_seconds", float64(node.LastUpAt.Unix()), labels[i]...)
+		}
+	}
+
+	mw.Header("storjnet_node_last_check_timestamp_seconds", metrics.TypeGauge, "Time of the last node check.")
+	for i, node := range nodes {
+		if !node.LastPingedAt.IsZero() {
+			mw.Sample("storjnet_node_last_check_timestamp_seconds", float64(node.LastPingedAt.Unix()), labels[i]...)
+		}
+	}
+
+	mw.Header("storjnet_node_in_maintenance", metrics.TypeGauge, "Whether the node is in a maintenance window now.")
+	for i, node := range nodes {
+		mw.Sample("storjnet_node_in_maintenance", boolToFloat(node.InMaintenance), labels[i]...)
+	}
+
+	mw.Header("storjnet_node_uptime_ratio", metrics.TypeGauge, "Share of successful node checks during the window (maintenance excluded).")
+	for i, node := range nodes {
+		for _, window := range core.RollingUptimeWindows {
+			if uptime, ok := uptimes[node.ID][window]; ok {
+				mw.Sample("storjnet_node_uptime_ratio", uptime, append(labels[i], "window", uptimeWindowLabel(window))...)
+			}
+		}
+	}
+
+	// groups are separate series (to be joined by node_id),
+	// so renaming a group or moving a node does not break series of other metrics
+	mw.Header("storjnet_node_group_info", metrics.TypeGauge, "Node group membership, always 1.")
+	for _, node := range nodes {
+		for _, group := range node.Groups {
+			mw.Sample("storjnet_node_group_info", 1, "node_id", node.ID.String(), "group", group)
+		}
+	}
+
+	return nil, merry.Wrap(mw.Flush())
+}
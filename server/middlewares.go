@@ -1,44 +1,70 @@
 package server
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"io"
+	"math"
 	"net/http"
 	"storjnet/core"
+	"storjnet/utils"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	httputils "github.com/3bl3gamer/go-http-utils"
 	"github.com/ansel1/merry"
 	"github.com/go-pg/pg/v10"
 	"github.com/julienschmidt/httprouter"
+	"github.com/rs/zerolog/log"
 )
 
 func withUserInner(handle httputils.HandlerExt, wr http.ResponseWriter, r *http.Request, ps httprouter.Params, mustBeLoggedIn bool) error {
 	db := r.Context().Value(CtxKeyDB).(*pg.DB)
 	var user *core.User
+	var session *core.UserSession
+	var apiToken *core.UserAPIToken
 	var err error
 
-	// trying basic auth
-	if username, password, ok := r.BasicAuth(); ok {
+	if token, ok := bearerToken(r); ok {
+		// trying API token
+		user, apiToken, err = findUserByBearerToken(r, db, token)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+	} else if username, password, ok := r.BasicAuth(); ok {
+		// trying basic auth (legacy, API tokens should be used instead)
+		limiter := r.Context().Value(CtxKeyAuthLimiter).(*AuthLimiter)
+		if lockedFor := limiter.LockedFor(r, username); lockedFor > 0 {
+			return merry.Wrap(writeTooManyRequests(wr, lockedFor))
+		}
 		user, err = core.FindUserByUsernameAndPassword(db, username, password)
 		if err != nil && !merry.Is(err, core.ErrUserNotFound) {
 			return merry.Wrap(err)
 		}
+		if user == nil {
+			limiter.Fail(r, username)
+		} else {
+			limiter.Reset(username)
+		}
+		// password alone is not enough for 2FA accounts
+		if user != nil && user.HasTOTP() {
+			return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "USE_API_TOKEN"}))
+		}
 	} else {
 		// trying regular cookie sessid
 		cookie, err := r.Cookie("sessid")
 		if err == nil {
 			sessid := cookie.Value
-			user, err = core.FindUserBySessid(db, sessid)
+			user, session, err = core.FindUserBySessid(db, sessid)
 			if err != nil && !merry.Is(err, core.ErrUserNotFound) {
 				return merry.Wrap(err)
 			}
-			if user != nil {
-				if err := core.UpdateSessionData(db, wr, user); err != nil {
-					return merry.Wrap(err)
-				}
+			if session != nil {
+				core.UpdateSessionData(db, wr, r, session)
 			}
 		}
 	}
@@ -48,14 +74,75 @@ func withUserInner(handle httputils.HandlerExt, wr http.ResponseWriter, r *http.
 	}
 
 	if mustBeLoggedIn && user == nil {
-		wr.Header().Set("Content-Type", "application/json")
-		return merry.Wrap(json.NewEncoder(wr).Encode(httputils.JsonError{Ok: false, Code: 403, Error: "FORBIDDEN"}))
+		return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "FORBIDDEN"}))
+	}
+	if apiToken != nil && apiToken.ReadOnly && r.Method != "GET" && r.Method != "HEAD" {
+		return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "READ_ONLY_TOKEN"}))
+	}
+
+	// switching to organization context: all user APIs will work with org nodes and settings
+	authUser := user
+	orgRole := ""
+	if orgIDStr := orgIDFromRequest(r); user != nil && orgIDStr != "" {
+		orgID, _ := strconv.ParseInt(orgIDStr, 10, 64)
+		org, role, err := core.FindOrgForMember(db, user, orgID)
+		if merry.Is(err, core.ErrOrgNotFound) {
+			return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "ORG_NOT_FOUND"}))
+		}
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		if role == core.OrgRoleViewer && r.Method != "GET" && r.Method != "HEAD" {
+			return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "READ_ONLY_ROLE"}))
+		}
+		user = org
+		orgRole = role
 	}
 
 	r = r.WithContext(context.WithValue(r.Context(), CtxKeyUser, user))
+	r = r.WithContext(context.WithValue(r.Context(), CtxKeyAuthUser, authUser))
+	r = r.WithContext(context.WithValue(r.Context(), CtxKeyOrgRole, orgRole))
+	r = r.WithContext(context.WithValue(r.Context(), CtxKeySession, session))
+	r = r.WithContext(context.WithValue(r.Context(), CtxKeyAPIToken, apiToken))
 	return handle(wr, r, ps)
 }
 
+// orgIDFromRequest returns organization ID from X-Org-Id header or "org" query param (for pages and downloads)
+func orgIDFromRequest(r *http.Request) string {
+	if id := r.Header.Get("X-Org-Id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("org")
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len(prefix):]), true
+}
+
+// bearerAuth is an already checked API token, so WithUser does not look it up after WithRateLimit
+type bearerAuth struct {
+	token    string
+	user     *core.User
+	apiToken *core.UserAPIToken
+}
+
+// findUserByBearerToken returns nils (without error) if token is not found
+func findUserByBearerToken(r *http.Request, db *pg.DB, token string) (*core.User, *core.UserAPIToken, error) {
+	if auth, ok := r.Context().Value(CtxKeyBearerAuth).(*bearerAuth); ok && auth.token == token {
+		return auth.user, auth.apiToken, nil
+	}
+	user, apiToken, err := core.FindUserByAPIToken(db, token)
+	if err != nil && !merry.Is(err, core.ErrAPITokenNotFound) {
+		return nil, nil, merry.Wrap(err)
+	}
+	return user, apiToken, nil
+}
+
 func WithOptUser(handle httputils.HandlerExt) httputils.HandlerExt {
 	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
 		return withUserInner(handle, wr, r, ps, false)
@@ -68,6 +155,187 @@ func WithUser(handle httputils.HandlerExt) httputils.HandlerExt {
 	}
 }
 
+// WithPersonalContext rejects requests made in organization context
+// (for account-level things like API tokens). Must be used after WithUser.
+func WithPersonalContext(handle httputils.HandlerExt) httputils.HandlerExt {
+	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		if r.Context().Value(CtxKeyOrgRole).(string) != "" {
+			return merry.Wrap(writeJSONError(wr, r, httputils.JsonError{Ok: false, Code: 403, Error: "NOT_AVAILABLE_IN_ORG"}))
+		}
+		return handle(wr, r, ps)
+	}
+}
+
+// AuthLimiter counts failed login attempts by client IP and by username.
+// Lockouts of IPs grow exponentially while username lockouts do not grow beyond the first one:
+// anyone may fail with any username, so it must not lock the real owner out for long.
+type AuthLimiter struct {
+	byIP       *utils.LockoutLimiter
+	byUsername *utils.LockoutLimiter
+}
+
+func NewAuthLimiter(cfg utils.LockoutLimiterConfig) *AuthLimiter {
+	usernameCfg := cfg
+	usernameCfg.MaxLockout = cfg.Lockout
+	return &AuthLimiter{byIP: utils.NewLockoutLimiter(cfg), byUsername: utils.NewLockoutLimiter(usernameCfg)}
+}
+
+func (l *AuthLimiter) LockedFor(r *http.Request, username string) time.Duration {
+	lockedFor := l.byIP.LockedFor(core.RequestIP(r))
+	if username != "" {
+		if d := l.byUsername.LockedFor(username); d > lockedFor {
+			lockedFor = d
+		}
+	}
+	return lockedFor
+}
+
+func (l *AuthLimiter) Fail(r *http.Request, username string) {
+	l.byIP.Fail(core.RequestIP(r))
+	if username != "" {
+		l.byUsername.Fail(username)
+	}
+}
+
+// Reset forgets failures of the username (IP is not reset: attacker may log in to own account between attempts).
+func (l *AuthLimiter) Reset(username string) {
+	l.byUsername.Reset(username)
+}
+
+// authAttempt is passed to handlers by WithAuthLimit, they mark it as failed on wrong credentials.
+type authAttempt struct {
+	failed   bool
+	failedIP bool //counted for client IP only
+}
+
+// markAuthFailed counts the request as a failed login attempt (if it is wrapped with WithAuthLimit).
+func markAuthFailed(r *http.Request) {
+	if attempt, ok := r.Context().Value(CtxKeyAuthAttempt).(*authAttempt); ok {
+		attempt.failed = true
+	}
+}
+
+// markIPAttempt counts the request as a failed attempt of the client IP only, for requests
+// that should be limited but must not lock the username out (like password reset emails).
+func markIPAttempt(r *http.Request) {
+	if attempt, ok := r.Context().Value(CtxKeyAuthAttempt).(*authAttempt); ok {
+		attempt.failedIP = true
+	}
+}
+
+func writeTooManyRequests(wr http.ResponseWriter, retryAfter time.Duration) error {
+	wr.Header().Set("Content-Type", "application/json")
+	wr.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	wr.WriteHeader(http.StatusTooManyRequests)
+	return merry.Wrap(json.NewEncoder(wr).Encode(httputils.JsonError{Ok: false, Code: 429, Error: "TOO_MANY_REQUESTS"}))
+}
+
+// writeJSONError responds with the error from a middleware. Status is 200 (the site and API clients
+// read errors from JSON) unless the route is wrapped with WithErrorStatus.
+func writeJSONError(wr http.ResponseWriter, r *http.Request, jsonErr httputils.JsonError) error {
+	wr.Header().Set("Content-Type", "application/json")
+	if withStatus, _ := r.Context().Value(CtxKeyErrorStatus).(bool); withStatus {
+		wr.WriteHeader(int(jsonErr.Code))
+	}
+	return merry.Wrap(json.NewEncoder(wr).Encode(jsonErr))
+}
+
+// WithErrorStatus makes following middlewares respond with matching HTTP status on errors
+// (like 403 for FORBIDDEN), for clients that check only the status (like Prometheus scrapers).
+func WithErrorStatus(handle httputils.HandlerExt) httputils.HandlerExt {
+	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyErrorStatus, true))
+		return handle(wr, r, ps)
+	}
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// WithAuthLimit protects login-like endpoints from password brute-forcing.
+// Requests marked by handlers with markAuthFailed are counted as failed attempts (by client IP
+// and by username from JSON body or of the logged in user), locked out clients get TOO_MANY_REQUESTS error.
+// Must be used after WithUser for endpoints of logged in users.
+func WithAuthLimit(handle httputils.HandlerExt) httputils.HandlerExt {
+	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		limiter := r.Context().Value(CtxKeyAuthLimiter).(*AuthLimiter)
+
+		body, err := io.ReadAll(http.MaxBytesReader(wr, r.Body, 64*1024))
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		params := struct{ Username string }{}
+		json.Unmarshal(body, &params) //errors will be handled by the handler itself
+		if user, ok := r.Context().Value(CtxKeyAuthUser).(*core.User); ok && user != nil && params.Username == "" {
+			// password confirmation of logged in user (password change, account deletion)
+			params.Username = user.Username
+		}
+
+		if lockedFor := limiter.LockedFor(r, params.Username); lockedFor > 0 {
+			return merry.Wrap(writeTooManyRequests(wr, lockedFor))
+		}
+
+		attempt := &authAttempt{}
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyAuthAttempt, attempt))
+		sw := &statusResponseWriter{ResponseWriter: wr, status: http.StatusOK}
+		if err := handle(sw, r, ps); err != nil {
+			return merry.Wrap(err)
+		}
+		if attempt.failed {
+			limiter.Fail(r, params.Username)
+		} else if attempt.failedIP {
+			limiter.Fail(r, "")
+		} else if sw.status < 300 {
+			limiter.Reset(params.Username)
+		}
+		return nil
+	}
+}
+
+// WithRateLimit limits requests count per API token (if a valid one is passed) or per client IP.
+func WithRateLimit(handle httputils.HandlerExt) httputils.HandlerExt {
+	return func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		db := r.Context().Value(CtxKeyDB).(*pg.DB)
+		limiter := r.Context().Value(CtxKeyRateLimiter).(*utils.RateLimiter)
+		cfg := r.Context().Value(CtxKeyRateLimitConfig).(utils.RateLimitConfig)
+
+		key, limit := "ip:"+core.RequestIP(r), cfg.IPLimit
+		if token, ok := bearerToken(r); ok {
+			user, apiToken, err := findUserByBearerToken(r, db, token)
+			if err != nil {
+				return merry.Wrap(err)
+			}
+			r = r.WithContext(context.WithValue(r.Context(), CtxKeyBearerAuth, &bearerAuth{token, user, apiToken}))
+			if apiToken != nil {
+				key, limit = "token:"+strconv.FormatInt(apiToken.ID, 10), cfg.TokenLimit
+			}
+		}
+
+		res, err := limiter.Take(key, limit, cfg.Period)
+		if err != nil {
+			// shared store is unavailable, it is better to serve requests than to fail all of them
+			log.Error().Err(err).Str("key", key).Msg("rate limiter failed")
+			return handle(wr, r, ps)
+		}
+
+		wr.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		wr.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		wr.Header().Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(res.Reset.Seconds())), 10))
+		if !res.Allowed {
+			return merry.Wrap(writeTooManyRequests(wr, res.RetryAfter))
+		}
+		return handle(wr, r, ps)
+	}
+}
+
 var gzippers = sync.Pool{New: func() interface{} {
 	// full pings array: 1 - 62.9KB, 2 - 45.2KB, 3 - 45.0KB, 9 - 44.7KB
 	// short pings array: 1 - 16091, 2 - 15677, 3 - 15362, 4 - 15036, 5 - 14674
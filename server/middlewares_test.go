@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"storjnet/core"
+	"storjnet/utils"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	httputils "github.com/3bl3gamer/go-http-utils"
+	"github.com/go-pg/pg/v10"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestWithRateLimitIgnoresSpoofedRealIP(t *testing.T) {
+	cfg := utils.RateLimitConfig{IPLimit: 3, TokenLimit: 10, Period: time.Minute, Store: "memory"}
+	limiter := utils.NewRateLimiter(utils.NewMemoryRateLimitStore())
+	handle := WithRateLimit(func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		wr.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "/api/neighbors/1.2.3.4", nil)
+		r.RemoteAddr = "1.2.3.4:5678"
+		r.Header.Set("X-Real-IP", "10.0.0."+strconv.Itoa(i))
+		ctx := context.WithValue(r.Context(), CtxKeyDB, (*pg.DB)(nil))
+		ctx = context.WithValue(ctx, CtxKeyRateLimiter, limiter)
+		ctx = context.WithValue(ctx, CtxKeyRateLimitConfig, cfg)
+		wr := httptest.NewRecorder()
+		if err := handle(wr, r.WithContext(ctx), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := http.StatusOK
+		if i >= cfg.IPLimit {
+			expected = http.StatusTooManyRequests
+		}
+		if wr.Code != expected {
+			t.Errorf("request #%d: expected status %d, got %d", i, expected, wr.Code)
+		}
+	}
+}
+
+func TestWithAuthLimit(t *testing.T) {
+	cfg := utils.LockoutLimiterConfig{MaxAttempts: 3, Lockout: time.Minute, MaxLockout: time.Hour}
+	limiter := NewAuthLimiter(cfg)
+	handle := WithAuthLimit(func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		if r.URL.Query().Get("wrong_password") == "1" {
+			markAuthFailed(r)
+			wr.WriteHeader(http.StatusForbidden)
+		} else {
+			wr.WriteHeader(http.StatusBadRequest) //validation error, not a credentials one
+		}
+		return nil
+	})
+	request := func(ip, query string) int {
+		r := httptest.NewRequest("POST", "/api/login?"+query, strings.NewReader(`{"username":"victim"}`))
+		r.RemoteAddr = ip + ":5678"
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyAuthLimiter, limiter))
+		wr := httptest.NewRecorder()
+		if err := handle(wr, r, nil); err != nil {
+			t.Fatal(err)
+		}
+		return wr.Code
+	}
+
+	for i := 0; i < 10; i++ {
+		if code := request("1.1.1.1", ""); code != http.StatusBadRequest {
+			t.Fatalf("validation error #%d: unexpected status %d", i, code)
+		}
+	}
+
+	for i := 0; i < cfg.MaxAttempts; i++ {
+		if code := request("2.2.2.2", "wrong_password=1"); code != http.StatusForbidden {
+			t.Fatalf("wrong password #%d: unexpected status %d", i, code)
+		}
+	}
+	if code := request("2.2.2.2", "wrong_password=1"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected lockout, got status %d", code)
+	}
+
+	// many IPs keep failing with the victim's username, its lockout must not grow
+	for i := 0; i < 20; i++ {
+		limiter.Fail(httptest.NewRequest("POST", "/", nil), "victim")
+	}
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = "3.3.3.3:5678"
+	if lockedFor := limiter.LockedFor(r, "victim"); lockedFor > cfg.Lockout {
+		t.Errorf("username locked for too long: %s", lockedFor)
+	}
+	if lockedFor := limiter.LockedFor(r, "other"); lockedFor != 0 {
+		t.Errorf("other username from other IP is locked for %s", lockedFor)
+	}
+
+	// password confirmation of logged in user (no username in body) is counted for the account
+	user := &core.User{Username: "victim2"}
+	for i := 0; i < cfg.MaxAttempts; i++ {
+		r := httptest.NewRequest("POST", "/api/user/password?wrong_password=1", strings.NewReader(`{}`))
+		r.RemoteAddr = "4.4.4." + strconv.Itoa(i) + ":5678"
+		ctx := context.WithValue(r.Context(), CtxKeyAuthLimiter, limiter)
+		ctx = context.WithValue(ctx, CtxKeyAuthUser, user)
+		if err := handle(httptest.NewRecorder(), r.WithContext(ctx), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lockedFor := limiter.LockedFor(r, user.Username); lockedFor == 0 {
+		t.Errorf("logged in user password attempts are not counted")
+	}
+}
+
+func TestWithUserForbiddenStatus(t *testing.T) {
+	handler := func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		t.Fatal("handler should not be called")
+		return nil
+	}
+	request := func(handle httputils.HandlerExt) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/user_nodes/metrics", nil)
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyDB, (*pg.DB)(nil)))
+		wr := httptest.NewRecorder()
+		if err := handle(wr, r, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(wr.Body.String(), `"FORBIDDEN"`) {
+			t.Errorf("expected FORBIDDEN, got %s", wr.Body.String())
+		}
+		return wr
+	}
+
+	if wr := request(WithUser(handler)); wr.Code != http.StatusOK {
+		t.Errorf("expected status 200 by default, got %d", wr.Code)
+	}
+	if wr := request(WithErrorStatus(WithUser(handler))); wr.Code != http.StatusForbidden {
+		t.Errorf("expected status 403 with WithErrorStatus, got %d", wr.Code)
+	}
+}
+
+func TestWithAuthLimitIPAttempts(t *testing.T) {
+	cfg := utils.LockoutLimiterConfig{MaxAttempts: 3, Lockout: time.Minute, MaxLockout: time.Hour}
+	limiter := NewAuthLimiter(cfg)
+	handle := WithAuthLimit(func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		markIPAttempt(r)
+		return nil
+	})
+	for i := 0; i < cfg.MaxAttempts; i++ {
+		r := httptest.NewRequest("POST", "/api/password_reset", strings.NewReader(`{"username":"victim"}`))
+		r.RemoteAddr = "5.5.5.5:5678"
+		r = r.WithContext(context.WithValue(r.Context(), CtxKeyAuthLimiter, limiter))
+		if err := handle(httptest.NewRecorder(), r, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/", nil)
+	r.RemoteAddr = "5.5.5.5:5678"
+	if limiter.LockedFor(r, "") == 0 {
+		t.Errorf("IP is not locked")
+	}
+	r.RemoteAddr = "6.6.6.6:5678"
+	if lockedFor := limiter.LockedFor(r, "victim"); lockedFor != 0 {
+		t.Errorf("username is locked for %s by IP-only attempts", lockedFor)
+	}
+}
+
+func TestWithUserReusesRateLimitTokenLookup(t *testing.T) {
+	token := core.APITokenPrefix + "0123456789abcdef"
+	user := &core.User{ID: 1, Username: "user", LastSeenAt: time.Now()}
+	apiToken := &core.UserAPIToken{ID: 2, UserID: 1}
+	handle := WithUser(func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) error {
+		if r.Context().Value(CtxKeyUser).(*core.User) != user || r.Context().Value(CtxKeyAPIToken).(*core.UserAPIToken) != apiToken {
+			t.Error("expected user and token from WithRateLimit lookup")
+		}
+		wr.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	r := httptest.NewRequest("GET", "/api/user_nodes", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	// nil DB: any additional lookup would panic
+	ctx := context.WithValue(r.Context(), CtxKeyDB, (*pg.DB)(nil))
+	ctx = context.WithValue(ctx, CtxKeyBearerAuth, &bearerAuth{token, user, apiToken})
+	wr := httptest.NewRecorder()
+	if err := handle(wr, r.WithContext(ctx), nil); err != nil {
+		t.Fatal(err)
+	}
+	if wr.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", wr.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	httputils "github.com/3bl3gamer/go-http-utils"
+)
+
+type openAPISchema struct {
+	Ref        string                    `json:"$ref"`
+	Type       string                    `json:"type"`
+	Format     string                    `json:"format"`
+	Items      *openAPISchema            `json:"items"`
+	Properties map[string]*openAPISchema `json:"properties"`
+	Required   []string                  `json:"required"`
+}
+
+type openAPIOperation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *openAPISchema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenAPIDoc(t *testing.T) *openAPIDoc {
+	doc := &openAPIDoc{}
+	if err := json.Unmarshal(openAPISpec, doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func (doc *openAPIDoc) resolve(t *testing.T, schema *openAPISchema) *openAPISchema {
+	if schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		res, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Fatalf("unknown schema ref %s", schema.Ref)
+		}
+		return res
+	}
+	return schema
+}
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// checkSchema compares JSON representation of the Go type with the schema (recursively)
+func (doc *openAPIDoc) checkSchema(t *testing.T, path string, typ reflect.Type, schema *openAPISchema) {
+	schema = doc.resolve(t, schema)
+	if schema == nil {
+		t.Errorf("%s: missing schema for %s", path, typ)
+		return
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	expectType := func(expected, format string) {
+		if schema.Type != expected || schema.Format != format {
+			t.Errorf("%s: %s should be described as %s(%s), got %s(%s)", path, typ, expected, format, schema.Type, schema.Format)
+		}
+	}
+	switch {
+	case typ == reflect.TypeOf(time.Time{}):
+		expectType("string", "date-time")
+	case typ.Implements(textMarshalerType) || reflect.PointerTo(typ).Implements(textMarshalerType):
+		expectType("string", "")
+	case typ.Kind() == reflect.String:
+		expectType("string", "")
+	case typ.Kind() == reflect.Bool:
+		expectType("boolean", "")
+	case typ.Kind() >= reflect.Int && typ.Kind() <= reflect.Uint64:
+		expectType("integer", "")
+	case typ.Kind() == reflect.Float32 || typ.Kind() == reflect.Float64:
+		expectType("number", "")
+	case typ.Kind() == reflect.Slice:
+		expectType("array", "")
+		if schema.Items == nil {
+			t.Errorf("%s: array items are not described", path)
+			return
+		}
+		doc.checkSchema(t, path+"[]", typ.Elem(), schema.Items)
+	case typ.Kind() == reflect.Struct:
+		expectType("object", "")
+		fieldNames := make([]string, 0, typ.NumField())
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			fieldNames = append(fieldNames, name)
+			doc.checkSchema(t, path+"."+name, field.Type, schema.Properties[name])
+		}
+		schemaNames := make([]string, 0, len(schema.Properties))
+		for name := range schema.Properties {
+			schemaNames = append(schemaNames, name)
+		}
+		sort.Strings(fieldNames)
+		sort.Strings(schemaNames)
+		if !reflect.DeepEqual(fieldNames, schemaNames) {
+			t.Errorf("%s: %s fields %v differ from described properties %v", path, typ, fieldNames, schemaNames)
+		}
+	default:
+		t.Errorf("%s: unsupported type %s", path, typ)
+	}
+}
+
+func TestOpenAPISpecMatchesHandlers(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+
+	described := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			described[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for _, route := range apiV1Routes {
+		// /neighbors/:subnet -> /neighbors/{subnet}
+		parts := strings.Split(route.Path, "/")
+		for i, part := range parts {
+			if strings.HasPrefix(part, ":") {
+				parts[i] = "{" + part[1:] + "}"
+			}
+		}
+		path := strings.Join(parts, "/")
+		key := route.Method + " " + path
+
+		if !described[key] {
+			t.Errorf("%s is not described", key)
+			continue
+		}
+		delete(described, key)
+
+		op := doc.Paths[path][strings.ToLower(route.Method)]
+		resp := doc.resolve(t, op.Responses["200"].Content["application/json"].Schema)
+		if resp == nil || resp.Properties["result"] == nil {
+			t.Errorf("%s: 200 response result is not described", key)
+			continue
+		}
+		doc.checkSchema(t, key, route.Handler.ResponseType(), resp.Properties["result"])
+	}
+
+	for key := range described {
+		t.Errorf("%s is described but not routed", key)
+	}
+
+	doc.checkSchema(t, "Error", reflect.TypeOf(httputils.JsonError{}), &openAPISchema{Ref: "#/components/schemas/Error"})
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"storjnet/core"
 	"storjnet/utils"
 	"storjnet/utils/storjutils"
 	"strings"
@@ -27,6 +26,18 @@ const CtxKeyEnv = ctxKey("env")
 const CtxKeyDB = ctxKey("db")
 const CtxKeyGeoIPDB = ctxKey("geoip-db")
 const CtxKeyUser = ctxKey("user")
+const CtxKeyMailer = ctxKey("mailer")
+const CtxKeySiteURL = ctxKey("site-url") //for links in emails
+const CtxKeyAPIToken = ctxKey("api-token")
+const CtxKeyAuthUser = ctxKey("auth-user") //logged in user, differs from CtxKeyUser in org context
+const CtxKeyOrgRole = ctxKey("org-role")   //role in current org, empty in personal context
+const CtxKeySession = ctxKey("session")    //nil if authorized not by session cookie
+const CtxKeyAuthLimiter = ctxKey("auth-limiter")
+const CtxKeyAuthAttempt = ctxKey("auth-attempt")
+const CtxKeyRateLimiter = ctxKey("rate-limiter")
+const CtxKeyRateLimitConfig = ctxKey("rate-limit-config")
+const CtxKeyErrorStatus = ctxKey("error-status") //see WithErrorStatus
+const CtxKeyBearerAuth = ctxKey("bearer-auth")   //API token checked by WithRateLimit
 
 func unmarshalFromBody(r *http.Request, obj interface{}) *httputils.JsonError {
 	if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
@@ -38,8 +49,11 @@ func unmarshalFromBody(r *http.Request, obj interface{}) *httputils.JsonError {
 	}
 	return nil
 }
-func unmarshalNodeFromBody(r *http.Request, node *core.Node) *httputils.JsonError {
-	if err := json.NewDecoder(r.Body).Decode(node); err != nil {
+
+// unmarshalNodeFromBody is like unmarshalFromBody but reports node ID errors separately.
+// obj is a node or any other struct with node IDs.
+func unmarshalNodeFromBody(r *http.Request, obj interface{}) *httputils.JsonError {
+	if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
 		if strings.HasPrefix(err.Error(), "node ID error") {
 			return &httputils.JsonError{Code: 400, Error: "NODE_ID_DECODE_ERROR", Description: err.Error()}
 		}
@@ -206,7 +220,7 @@ func langFromRequest(r *http.Request) string {
 	return "en"
 }
 
-func StartHTTPServer(address string, env utils.Env) error {
+func StartHTTPServer(address string, env utils.Env, tgBotUsername string, smtpConfig utils.SMTPConfig, authLimitConfig utils.LockoutLimiterConfig, rateLimitConfig utils.RateLimitConfig) error {
 	ex, err := os.Executable()
 	if err != nil {
 		return merry.Wrap(err)
@@ -227,6 +241,29 @@ func StartHTTPServer(address string, env utils.Env) error {
 		return merry.Wrap(err)
 	}
 
+	var mailer utils.Mailer = utils.LogMailer{}
+	if smtpConfig.IsSet() {
+		mailer = utils.NewSMTPMailer(smtpConfig)
+	} else {
+		log.Warn().Msg("no SMTP server address, emails will be just logged")
+	}
+
+	authLimiter := NewAuthLimiter(authLimitConfig)
+
+	if err := rateLimitConfig.Validate(); err != nil {
+		return merry.Wrap(err)
+	}
+	var rateLimitStore utils.RateLimitStore
+	switch rateLimitConfig.Store {
+	case "memory":
+		rateLimitStore = utils.NewMemoryRateLimitStore()
+	case "pg":
+		rateLimitStore = utils.NewPGRateLimitStore(db)
+	default:
+		return merry.Errorf("unknown rate limit store: %s", rateLimitConfig.Store)
+	}
+	rateLimiter := utils.NewRateLimiter(rateLimitStore)
+
 	// Config
 	wrapper := &httputils.Wrapper{
 		ShowErrorDetails: env.IsDev(),
@@ -237,6 +274,11 @@ func StartHTTPServer(address string, env utils.Env) error {
 				r = r.WithContext(context.WithValue(r.Context(), CtxKeyEnv, env))
 				r = r.WithContext(context.WithValue(r.Context(), CtxKeyDB, db))
 				r = r.WithContext(context.WithValue(r.Context(), CtxKeyGeoIPDB, gdb))
+				r = r.WithContext(context.WithValue(r.Context(), CtxKeyMailer, mailer))
+				r = r.WithContext(context.WithValue(r.Context(), CtxKeySiteURL, smtpConfig.SiteURL))
+				r = r.WithContext(context.WithValue(r.Context(), CtxKeyAuthLimiter, authLimiter))
+				r = r.WithContext(context.WithValue(r.Context(), CtxKeyRateLimiter, rateLimiter))
+				r = r.WithContext(context.WithValue(r.Context(), CtxKeyRateLimitConfig, rateLimitConfig))
 				return merry.Wrap(handle(wr, r, params))
 			}
 		},
@@ -248,6 +290,7 @@ func StartHTTPServer(address string, env utils.Env) error {
 				params["L"] = L10nUtls{Lang: langFromRequest(r)}
 				params["BundleFPath"] = bundleFPath
 				params["StylesFPath"] = stylesFPath
+				params["TGBotUsername"] = tgBotUsername
 				return nil
 			},
 			LogBuild: func(path string) { log.Info().Str("path", path).Msg("building template") },
@@ -257,6 +300,7 @@ func StartHTTPServer(address string, env utils.Env) error {
 			// if errors.Is(err, syscall.EPIPE) {
 			// 	log.Warn().Str("method", r.Method).Str("path", r.URL.Path).Msg("broken pipe")
 			// } else {
+			httpErrorsCount.Inc()
 			log.Error().Stack().Err(err).Str("method", r.Method).Str("path", r.URL.Path).Msg("")
 			// }
 		},
@@ -264,7 +308,7 @@ func StartHTTPServer(address string, env utils.Env) error {
 
 	router := httprouter.New()
 	route := func(method, path string, chain ...interface{}) {
-		router.Handle(method, path, wrapper.WrapChain(chain...))
+		router.Handle(method, path, withRequestMetrics(method+" "+path, wrapper.WrapChain(chain...)))
 	}
 
 	// Routes
@@ -273,29 +317,81 @@ func StartHTTPServer(address string, env utils.Env) error {
 	route("GET", "/neighbors", HandleNeighbors)
 	route("GET", "/sanctions", HandleSanctions)
 	route("GET", "/~", WithOptUser, HandleUserDashboard)
+	route("GET", "/share/:key", HandleSharePage)
+	route("GET", "/password_reset", HandlePasswordReset)
 
 	route("POST", "/lang", HandleLang)
-	route("POST", "/api/register", HandleAPIRegister)
-	route("POST", "/api/login", HandleAPILogin)
-	route("POST", "/api/ping_my_node", HandleAPIPingMyNode)
-	route("GET", "/api/neighbors/:subnet", HandleAPINeighbors)
-	route("POST", "/api/neighbors", HandleAPINeighborsExt)
-	route("POST", "/api/ips_info", HandleAPIIPsInfo)
-	route("POST", "/api/ips_sanctions", HandleAPIIPsSanctions)
+	route("POST", "/api/register", WithAuthLimit, HandleAPIRegister)
+	route("POST", "/api/login", WithAuthLimit, HandleAPILogin)
+	route("POST", "/api/logout", WithOptUser, HandleAPILogout)
+	route("POST", "/api/password_reset", WithAuthLimit, HandleAPIStartPasswordReset)
+	route("POST", "/api/password_reset/finish", WithAuthLimit, HandleAPIFinishPasswordReset)
+	route("POST", "/api/user/password", WithUser, WithPersonalContext, WithAuthLimit, HandleAPIChangePassword)
+	route("DELETE", "/api/user", WithUser, WithPersonalContext, WithAuthLimit, HandleAPIDeleteUser)
+	route("GET", "/api/user_sessions", WithUser, WithPersonalContext, HandleAPIGetUserSessions)
+	route("DELETE", "/api/user_sessions", WithUser, WithPersonalContext, HandleAPIDelUserSessions)
+	route("GET", "/api/user/totp", WithUser, WithPersonalContext, HandleAPIGetUserTOTP)
+	route("POST", "/api/user/totp/setup", WithUser, WithPersonalContext, HandleAPIStartTOTPSetup)
+	route("POST", "/api/user/totp/enable", WithUser, WithPersonalContext, HandleAPIEnableTOTP)
+	route("POST", "/api/user/totp/recovery_codes", WithUser, WithPersonalContext, HandleAPIRegenerateTOTPRecoveryCodes)
+	route("POST", "/api/user/totp/disable", WithUser, WithPersonalContext, HandleAPIDisableTOTP)
+	route("POST", "/api/ping_my_node", WithRateLimit, HandleAPIPingMyNode)
+	route("GET", "/api/neighbors/:subnet", WithRateLimit, typed(HandleAPINeighbors).Handle)
+	route("POST", "/api/neighbors", WithRateLimit, typed(HandleAPINeighborsExt).Handle)
+	route("POST", "/api/ips_info", WithRateLimit, typed(HandleAPIIPsInfo).Handle)
+	route("POST", "/api/ips_sanctions", WithRateLimit, HandleAPIIPsSanctions)
+	route("GET", "/api/user_nodes", WithUser, HandleAPIGetUserNodes)
 	route("POST", "/api/user_nodes", WithUser, HandleAPISetUserNode)
 	route("DELETE", "/api/user_nodes", WithUser, HandleAPIDelUserNode)
+	route("POST", "/api/user_nodes/import", WithUser, HandleAPIImportUserNodes)
+	route("GET", "/api/user_nodes/export", WithUser, HandleAPIExportUserNodes)
 	route("GET", "/api/sat_nodes", HandleAPIGetSatNodes)
 	route("GET", "/api/user_nodes/my/:node_id/pings", WithUser, WithGzip, HandleAPIUserNodePings)
 	route("GET", "/api/user_nodes/sat/:node_id/pings", WithGzip, HandleAPIUserNodePings)
+	route("GET", "/api/user_nodes/uptime_report", WithUser, HandleAPIUserNodesUptimeReport)
+	route("GET", "/api/user_nodes/metrics", WithErrorStatus, WithUser, HandleAPIUserNodesMetrics)
 	route("POST", "/api/user_texts", WithUser, HandleAPIUserTexts)
+	route("GET", "/api/user_alerts", WithUser, HandleAPIGetUserAlerts)
+	route("POST", "/api/user_alerts", WithUser, HandleAPISetUserAlerts)
+	route("POST", "/api/user_email", WithUser, HandleAPISetUserEmail)
+	route("POST", "/api/user_email/verify", WithUser, HandleAPIVerifyUserEmail)
+	route("DELETE", "/api/user_email", WithUser, HandleAPIDelUserEmail)
+	route("GET", "/api/user_api_tokens", WithUser, WithPersonalContext, HandleAPIGetUserAPITokens)
+	route("POST", "/api/user_api_tokens", WithUser, WithPersonalContext, HandleAPICreateUserAPIToken)
+	route("DELETE", "/api/user_api_tokens", WithUser, WithPersonalContext, HandleAPIDelUserAPIToken)
+	route("GET", "/api/orgs", WithUser, HandleAPIGetUserOrgs)
+	route("POST", "/api/orgs", WithUser, WithPersonalContext, HandleAPICreateOrg)
+	route("GET", "/api/orgs/:org_id/members", WithUser, HandleAPIGetOrgMembers)
+	route("POST", "/api/orgs/:org_id/members", WithUser, HandleAPISetOrgMember)
+	route("DELETE", "/api/orgs/:org_id/members", WithUser, HandleAPIDelOrgMember)
+	route("GET", "/api/user_webhooks", WithUser, HandleAPIGetUserWebhooks)
+	route("POST", "/api/user_webhooks", WithUser, HandleAPIAddUserWebhook)
+	route("DELETE", "/api/user_webhooks", WithUser, HandleAPIDelUserWebhook)
+	route("GET", "/api/user_node_groups", WithUser, HandleAPIGetUserNodeGroups)
+	route("POST", "/api/user_node_groups", WithUser, HandleAPIAddUserNodeGroup)
+	route("DELETE", "/api/user_node_groups", WithUser, HandleAPIDelUserNodeGroup)
+	route("POST", "/api/user_node_groups/members", WithUser, HandleAPISetUserNodeGroupMembers)
+	route("GET", "/api/user_node_group_shares", WithUser, HandleAPIGetUserNodeGroupShares)
+	route("POST", "/api/user_node_group_shares", WithUser, HandleAPIAddUserNodeGroupShare)
+	route("DELETE", "/api/user_node_group_shares", WithUser, HandleAPIDelUserNodeGroupShare)
+	route("GET", "/api/shares/:key/nodes/:ref/pings", WithGzip, HandleAPISharedNodePings)
+	route("GET", "/api/user_maintenance", WithUser, HandleAPIGetUserMaintenanceWindows)
+	route("POST", "/api/user_maintenance", WithUser, HandleAPIAddUserMaintenanceWindow)
+	route("DELETE", "/api/user_maintenance", WithUser, HandleAPIDelUserMaintenanceWindow)
 	route("GET", "/api/storj_token/summary", WithGzip, HandleAPIStorjTokenTxSummary)
 	route("GET", "/api/nodes/locations", WithGzip, HandleAPINodesLocations)
-	route("GET", "/api/nodes/location_summary", HandleAPINodesLocationSummary)
+	route("GET", "/api/nodes/location_summary", typed(HandleAPINodesLocationSummary).Handle)
 	route("GET", "/api/nodes/countries", WithGzip, HandleAPINodesCountries)
-	route("GET", "/api/nodes/subnet_summary", HandleAPINodesSubnetSummary)
+	route("GET", "/api/nodes/subnet_summary", typed(HandleAPINodesSubnetSummary).Handle)
 	route("GET", "/api/nodes/counts", WithGzip, HandleAPINodesCounts)
 	route("POST", "/api/client_errors", WithOptUser, HandleAPIClientErrors)
 
+	route("GET", "/api/v1/openapi.json", HandleAPIv1OpenAPISpec)
+	route("GET", "/metrics", HandleMetrics)
+	for _, r := range apiV1Routes {
+		route(r.Method, "/api/v1"+r.Path, r.Chain()...)
+	}
+
 	route("GET", "/api/explode", func(wr http.ResponseWriter, r *http.Request, ps httprouter.Params) (interface{}, error) {
 		return nil, merry.New("test API error")
 	})
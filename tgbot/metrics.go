@@ -0,0 +1,12 @@
+package tgbot
+
+import "storjnet/utils/metrics"
+
+var (
+	tgUpdatesCount = metrics.Default.NewCounter("storjnet_tg_updates_total",
+		"Received TG updates by bot command (\"other\" for non-command updates).", "command")
+	tgCommandDuration = metrics.Default.NewHistogram("storjnet_tg_command_duration_seconds",
+		"TG bot commands handling duration.", metrics.DurationBuckets, "command")
+	tgErrorsCount = metrics.Default.NewCounter("storjnet_tg_errors_total",
+		"TG bot commands handling errors.", "command")
+)
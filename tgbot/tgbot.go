@@ -8,12 +8,12 @@ import (
 	"storjnet/utils"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ansel1/merry"
 	"github.com/go-pg/pg/v10"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/net/proxy"
 )
 
 var ErrActionNotAllowed = merry.New("action not allowed")
@@ -38,6 +38,14 @@ func justSend(bot *tgbotapi.BotAPI, chatID int64, text string) error {
 	return merry.Wrap(utils.TGSendMessageMD(bot, chatID, text))
 }
 
+// justSendPlain is for texts with user input (which may break Markdown)
+func justSendPlain(bot *tgbotapi.BotAPI, chatID int64, text string) error {
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.DisableWebPagePreview = true
+	_, err := bot.Send(msg)
+	return merry.Wrap(err)
+}
+
 func extractCommand(bot *tgbotapi.BotAPI, update tgbotapi.Update) (string, string) {
 	m := update.Message
 	if m == nil {
@@ -53,9 +61,23 @@ func extractCommand(bot *tgbotapi.BotAPI, update tgbotapi.Update) (string, strin
 	cmdText := m.Text[0:entity.Length]
 	usernameSuffix := "@" + bot.Self.UserName
 	if strings.HasSuffix(cmdText, usernameSuffix) {
-		return cmdText[:len(cmdText)-len(usernameSuffix)], strings.TrimSpace(m.Text[entity.Offset:])
+		return cmdText[:len(cmdText)-len(usernameSuffix)], strings.TrimSpace(m.Text[entity.Length:])
+	}
+	return cmdText, strings.TrimSpace(m.Text[entity.Length:])
+}
+
+func msgLang(message *tgbotapi.Message) string {
+	if message.From != nil && strings.HasPrefix(message.From.LanguageCode, "ru") {
+		return "ru"
 	}
-	return cmdText, strings.TrimSpace(m.Text[entity.Offset:])
+	return "en"
+}
+
+func loc(lang, en, ru string) string {
+	if lang == "ru" {
+		return ru
+	}
+	return en
 }
 
 func extractSubscriptorID(bot *tgbotapi.BotAPI, db *pg.DB, message *tgbotapi.Message) (int64, error) {
@@ -123,9 +145,71 @@ func unsubscripbe(db *pg.DB, id int64) error {
 }
 
 func handleStart(bot *tgbotapi.BotAPI, db *pg.DB, update tgbotapi.Update, args string) error {
+	if args != "" {
+		// deep link from dashboard: https://t.me/<bot>?start=<link_code>
+		return merry.Wrap(handleLink(bot, db, update, args))
+	}
 	return justSend(bot, update.Message.Chat.ID, "Привет.")
 }
 
+func handleLink(bot *tgbotapi.BotAPI, db *pg.DB, update tgbotapi.Update, args string) error {
+	chatID := update.Message.Chat.ID
+	lang := msgLang(update.Message)
+	if args == "" {
+		return merry.Wrap(justSend(bot, chatID, loc(lang,
+			"Usage: /link <code from storjnet.info/~>",
+			"Использование: /link <код со страницы storjnet.info/~>")))
+	}
+	id, err := extractSubscriptorID(bot, db, update.Message)
+	if merry.Is(err, ErrActionNotAllowed) {
+		return merry.Wrap(justSend(bot, chatID, loc(lang,
+			"Only chat admins can do this.",
+			"У тебя здесь нет власти!")))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	username, userLang, err := core.LinkUserAlertsTGChat(db, args, id)
+	if merry.Is(err, core.ErrTGLinkCodeNotFound) {
+		return merry.Wrap(justSend(bot, chatID, loc(lang,
+			"Code not found. It can be copied from storjnet.info/~",
+			"Код не найден. Его можно скопировать на странице storjnet.info/~")))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	log.Debug().Int64("id", id).Str("username", username).Msg("alerts chat linked")
+	return merry.Wrap(justSendPlain(bot, chatID, loc(userLang,
+		"Node alerts for "+username+" will be sent here.",
+		"Буду присылать сюда уведомления о нодах "+username+".")))
+}
+
+func handleUnlink(bot *tgbotapi.BotAPI, db *pg.DB, update tgbotapi.Update, args string) error {
+	chatID := update.Message.Chat.ID
+	lang := msgLang(update.Message)
+	id, err := extractSubscriptorID(bot, db, update.Message)
+	if merry.Is(err, ErrActionNotAllowed) {
+		return merry.Wrap(justSend(bot, chatID, loc(lang,
+			"Only chat admins can do this.",
+			"У тебя здесь нет власти!")))
+	}
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	count, err := core.UnlinkUserAlertsTGChat(db, id)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	if count == 0 {
+		return merry.Wrap(justSend(bot, chatID, loc(lang,
+			"No node alerts are sent here.",
+			"Уведомления о нодах сюда и так не приходят.")))
+	}
+	return merry.Wrap(justSend(bot, chatID, loc(lang,
+		"Node alerts are turned off.",
+		"Отключил уведомления о нодах.")))
+}
+
 func handleVersions(bot *tgbotapi.BotAPI, db *pg.DB, update tgbotapi.Update, args string) error {
 	sendAction(bot, update.Message.Chat.ID, "typing")
 
@@ -182,18 +266,7 @@ func handleUnsubscribe(bot *tgbotapi.BotAPI, db *pg.DB, update tgbotapi.Update,
 func StartTGBot(tgBotToken, socks5ProxyAddr string, webhook *WebhookConfig) error {
 	db := utils.MakePGConnection()
 
-	httpClient := &http.Client{}
-	if socks5ProxyAddr != "" {
-		// auth := &proxy.Auth{User: *socksUser, Password: *socksPassword}
-		dialer, err := proxy.SOCKS5("tcp", socks5ProxyAddr, nil, proxy.Direct)
-		if err != nil {
-			return merry.Wrap(err)
-		}
-		httpTransport := &http.Transport{Dial: dialer.Dial}
-		httpClient.Transport = httpTransport
-	}
-
-	bot, err := tgbotapi.NewBotAPIWithClient(tgBotToken, httpClient)
+	bot, err := utils.TGMakeBot(tgBotToken, socks5ProxyAddr)
 	if err != nil {
 		return merry.Wrap(err)
 	}
@@ -229,6 +302,8 @@ func StartTGBot(tgBotToken, socks5ProxyAddr string, webhook *WebhookConfig) erro
 		"/winver":      handleVersions,
 		"/subscribe":   handleSubscribe,
 		"/unsubscribe": handleUnsubscribe,
+		"/link":        handleLink,
+		"/unlink":      handleUnlink,
 	}
 
 	for update := range updates {
@@ -236,11 +311,19 @@ func StartTGBot(tgBotToken, socks5ProxyAddr string, webhook *WebhookConfig) erro
 		// fmt.Println(">>> " + string(buf))
 		cmd, args := extractCommand(bot, update)
 		if handler, ok := handlers[cmd]; ok {
-			if err := handler(bot, db, update, args); err != nil {
+			tgUpdatesCount.Inc(cmd)
+			stt := time.Now()
+			err := handler(bot, db, update, args)
+			tgCommandDuration.Observe(time.Since(stt).Seconds(), cmd)
+			if err != nil {
+				tgErrorsCount.Inc(cmd)
 				return merry.Wrap(err)
 			}
-		} else if update.Message != nil && update.Message.Text != "" && !isReplyToBotInGroupChat(bot, update) {
-			justSend(bot, update.Message.Chat.ID, "Не понял.")
+		} else {
+			tgUpdatesCount.Inc("other")
+			if update.Message != nil && update.Message.Text != "" && !isReplyToBotInGroupChat(bot, update) {
+				justSend(bot, update.Message.Chat.ID, "Не понял.")
+			}
 		}
 	}
 	return nil
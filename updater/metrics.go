@@ -0,0 +1,29 @@
+package updater
+
+import (
+	"storjnet/utils/metrics"
+
+	"github.com/ansel1/merry"
+)
+
+var (
+	nodePingsCount = metrics.Default.NewCounter("storjnet_node_pings_total",
+		"User nodes pings (from any satellite) by protocol and result.", "proto", "result")
+	pingQueueLength = metrics.Default.NewGauge("storjnet_ping_queue_length",
+		"User nodes waiting in pinger channels.", "chan")
+	pingLag = metrics.Default.NewGauge("storjnet_ping_lag_seconds",
+		"How late (relative to its ping interval) was the most overdue node of the last loaded chunk.")
+)
+
+func pingResultLabel(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case merry.Is(err, ErrDialFail):
+		return "dial_error"
+	case merry.Is(err, ErrPingFail):
+		return "ping_error"
+	default:
+		return "error"
+	}
+}
@@ -1,18 +1,19 @@
 package updater
 
 import (
-	"context"
 	"encoding/hex"
 	"storjnet/core"
 	"storjnet/utils"
 	"storjnet/utils/storjutils"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/ansel1/merry"
 	"github.com/go-pg/pg/v10"
 	"github.com/rs/zerolog/log"
+	"storj.io/common/storj"
 )
 
 var ErrDialFail = merry.New("dial failed")
@@ -20,21 +21,177 @@ var ErrPingFail = merry.New("ping failed")
 
 type UserNodeWithErr struct {
 	core.UserNode
-	Err error
+	SatLabel   string
+	Err        error
+	QUICPinged bool
+	QUICErr    error
 }
 
-func doPing(sats storjutils.Satellites, node *core.Node) (time.Duration, error) {
+type satPingResult struct {
+	Label    string
+	Duration time.Duration
+	Err      error
+}
+
+// doPing returns ping duration and label of the satellite that performed the (last) check
+func doPing(sats storjutils.Satellites, node *core.Node, mode storjutils.SatMode) (time.Duration, string, error) {
 	var lastErr error
+	var lastLabel string
 	for _, sat := range sats {
 		dialOnly := node.PingMode != "ping"
-		res, err := sat.PingAndClose(node.Address, node.ID, storjutils.SatModeTCP, dialOnly, 5*time.Second)
+		lastLabel = sat.Label()
+		res, err := sat.PingAndClose(node.Address, node.ID, mode, dialOnly, 5*time.Second)
 		if err != nil {
 			lastErr = ErrDialFail.WithCause(err)
 			continue
 		}
-		return time.Duration((res.DialDuration + res.PingDuration) * float64(time.Second)), nil
+		return time.Duration((res.DialDuration + res.PingDuration) * float64(time.Second)), lastLabel, nil
+	}
+	return 0, lastLabel, merry.Wrap(lastErr)
+}
+
+// doPingFromAllSats pings node from every satellite concurrently, results are in sats order
+func doPingFromAllSats(sats storjutils.Satellites, node *core.Node, mode storjutils.SatMode) []satPingResult {
+	results := make([]satPingResult, len(sats))
+	wg := sync.WaitGroup{}
+	for i, sat := range sats {
+		wg.Add(1)
+		go func(i int, sat storjutils.Satellite) {
+			defer wg.Done()
+			dialOnly := node.PingMode != "ping"
+			res, err := sat.PingAndClose(node.Address, node.ID, mode, dialOnly, 5*time.Second)
+			results[i] = satPingResult{Label: sat.Label()}
+			if err != nil {
+				results[i].Err = ErrDialFail.WithCause(err)
+			} else {
+				results[i].Duration = time.Duration((res.DialDuration + res.PingDuration) * float64(time.Second))
+			}
+		}(i, sat)
+	}
+	wg.Wait()
+	return results
+}
+
+// pingNode returns same results as doPing, and also per-satellite results if node must be pinged from all of them
+func pingNode(sats storjutils.Satellites, node *core.Node, mode storjutils.SatMode) (time.Duration, string, []core.SatPing, error) {
+	if !node.PingAllSats {
+		duration, label, err := doPing(sats, node, mode)
+		return duration, label, nil, err
+	}
+
+	results := doPingFromAllSats(sats, node, mode)
+	satPings := make([]core.SatPing, len(results))
+	for i, res := range results {
+		satPings[i] = core.SatPing{Sat: res.Label, Ok: res.Err == nil, Ping: res.Duration.Microseconds() / 1000}
+	}
+	// overall result is the same as doPing's one: the first successful satellite
+	var lastRes satPingResult
+	for _, res := range results {
+		if res.Err == nil {
+			return res.Duration, res.Label, satPings, nil
+		}
+		lastRes = res
+	}
+	return 0, lastRes.Label, satPings, merry.Wrap(lastRes.Err)
+}
+
+// encodeHistoryPing returns second of the (UTC) day and ping value (ping in ms or 1 on failure)
+// for history arrays. Array item index and in-item time hint are calculated by historyItemSQL
+// since they depend on the resolution of the existing history row.
+func encodeHistoryPing(pingedAt time.Time, ok bool, ping int64) (int64, int64) {
+	second := pingedAt.Unix() % (24 * 3600)
+	if !ok {
+		return second, 1
+	}
+	if ping >= 2000 {
+		ping = 2000 - 1
+	}
+	if ping <= 1 {
+		ping = 2
+	}
+	return second, ping
+}
+
+// historyItemSQL updates array item with the ping. Each item covers `resolution` minutes,
+// the value is timeHint*2000+ping where timeHint (0-14) is ping position inside the item.
+// Value is negated (?sign = -1) for pings made during maintenance.
+func historyItemSQL(column string) string {
+	return column + `[?second / (60*resolution) + 1] = ?sign * (?second % (60*resolution) / (4*resolution) * 2000 + ?ping_value)`
+}
+
+func historyValueSign(node *UserNodeWithErr) int64 {
+	if node.InMaintenance {
+		return -1
 	}
-	return 0, merry.Wrap(lastErr)
+	return 1
+}
+
+// saveHistoryPing updates history array item (creating the array if needed).
+// Empty satLabel means main history, otherwise per-satellite one. Returns true if new array was created.
+// New arrays are created with node ping interval resolution, existing ones keep theirs till the end of the day.
+func saveHistoryPing(tx *pg.Tx, node *UserNodeWithErr, satLabel string, second, pingValue int64) (bool, error) {
+	table := "user_nodes_history"
+	satCond := ""
+	if satLabel != "" {
+		table = "user_nodes_sat_history"
+		satCond = " AND sat_label = ?sat_label"
+	}
+	params := struct {
+		Second, PingValue, Sign int64
+		NodeID                  storj.NodeID
+		UserID                  int64
+		SatLabel                string
+		PingedAt                time.Time
+		Resolution              int64
+	}{second, pingValue, historyValueSign(node), node.ID, node.UserID, satLabel, node.LastPingedAt, node.PingInterval}
+
+	updateQuery := `
+		UPDATE ` + table + ` SET ` + historyItemSQL("pings") + `
+		WHERE node_id = ?node_id AND user_id = ?user_id AND date = (?pinged_at at time zone 'utc')::date` + satCond
+
+	// update attempt, most common
+	res, err := tx.Exec(updateQuery, params)
+	if err != nil {
+		return false, merry.Wrap(err)
+	}
+	if res.RowsAffected() > 0 {
+		return false, nil
+	}
+
+	// insert, in case of no updates
+	satCol, satVal := "", ""
+	if satLabel != "" {
+		satCol, satVal = ", sat_label", ", ?sat_label"
+	}
+	_, err = tx.Exec(`
+		INSERT INTO `+table+` (node_id, user_id, date, resolution, pings`+satCol+`)
+		VALUES (?node_id, ?user_id, (?pinged_at at time zone 'utc')::date, ?resolution,
+			array_fill(0::smallint, ARRAY[24*60 / ?resolution])`+satVal+`)`,
+		params)
+	if err != nil {
+		return false, merry.Wrap(err)
+	}
+	if _, err := tx.Exec(updateQuery, params); err != nil {
+		return false, merry.Wrap(err)
+	}
+	return true, nil
+}
+
+// saveQUICHistoryPing updates QUIC history array item. Main history row must already exist.
+func saveQUICHistoryPing(tx *pg.Tx, node *UserNodeWithErr, second, pingValue int64) error {
+	_, err := tx.Exec(`
+		UPDATE user_nodes_history SET quic_pings = array_fill(0::smallint, ARRAY[24*60 / resolution])
+		WHERE node_id = ?node_id AND user_id = ?user_id AND date = (?pinged_at at time zone 'utc')::date
+		  AND quic_pings IS NULL;
+		UPDATE user_nodes_history SET `+historyItemSQL("quic_pings")+`
+		WHERE node_id = ?node_id AND user_id = ?user_id AND date = (?pinged_at at time zone 'utc')::date`,
+		struct {
+			Second, PingValue, Sign int64
+			NodeID                  storj.NodeID
+			UserID                  int64
+			PingedAt                time.Time
+		}{second, pingValue, historyValueSign(node), node.ID, node.UserID, node.LastPingedAt})
+	return merry.Wrap(err)
 }
 
 type NodeIDListAsPGTuple []*core.UserNode
@@ -56,6 +213,88 @@ func (l NodeIDListAsPGTuple) AppendValue(b []byte, flags int) ([]byte, error) {
 	return b, nil
 }
 
+type userNodeKey struct {
+	UserID int64
+	NodeID storj.NodeID
+}
+
+func makeUserNodeKey(node *core.UserNode) userNodeKey {
+	return userNodeKey{UserID: node.UserID, NodeID: node.ID}
+}
+
+type userNodeAlertState struct {
+	core.UserNodeAlertState
+	Rules    core.UserNodeAlertRules
+	LastPing int64
+}
+
+// loadAlertStatesForUpdate locks user_nodes rows and returns their alert states (with user alert rules)
+func loadAlertStatesForUpdate(tx *pg.Tx, userNodes []*core.UserNode) (map[userNodeKey]*userNodeAlertState, error) {
+	var rows []*struct {
+		UserID          int64
+		RawNodeID       []byte
+		FailsCount      int64
+		DownSince       time.Time
+		AlertIsDown     bool
+		CheckBits       int64
+		CheckBitsCount  int64
+		IsFlapping      bool
+		LastPing        int64
+		RuleFailsCount  int64
+		RuleDownMinutes int64
+	}
+	_, err := tx.Query(&rows, `
+		SELECT user_id, node_id AS raw_node_id, user_nodes.fails_count, down_since, alert_is_down,
+			check_bits, check_bits_count, is_flapping, last_ping,
+			COALESCE(settings.fails_count, ?) AS rule_fails_count,
+			COALESCE(settings.down_minutes, ?) AS rule_down_minutes
+		FROM user_nodes
+		LEFT JOIN user_alert_settings AS settings USING (user_id)
+		WHERE (user_id, node_id) IN (?)
+		FOR UPDATE OF user_nodes`,
+		core.DefaultAlertFailsCount, core.DefaultAlertDownMinutes, NodeIDListAsPGTuple(userNodes))
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	states := make(map[userNodeKey]*userNodeAlertState, len(rows))
+	for _, row := range rows {
+		nodeID, err := storj.NodeIDFromBytes(row.RawNodeID)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		states[userNodeKey{UserID: row.UserID, NodeID: nodeID}] = &userNodeAlertState{
+			UserNodeAlertState: core.UserNodeAlertState{
+				FailsCount:     row.FailsCount,
+				DownSince:      row.DownSince,
+				AlertIsDown:    row.AlertIsDown,
+				CheckBits:      row.CheckBits,
+				CheckBitsCount: row.CheckBitsCount,
+				IsFlapping:     row.IsFlapping,
+			},
+			Rules:    core.UserNodeAlertRules{FailsCount: row.RuleFailsCount, DownMinutes: row.RuleDownMinutes},
+			LastPing: row.LastPing,
+		}
+	}
+	return states, nil
+}
+
+// maxPingLag returns how late the most overdue node is (nodes are loaded in last_pinged_at order,
+// but the intervals differ, so the first node is not necessarily the most overdue one).
+func maxPingLag(userNodes []*core.UserNode, now time.Time) time.Duration {
+	lag := time.Duration(0)
+	for _, node := range userNodes {
+		if node.LastPingedAt.IsZero() {
+			continue
+		}
+		nodeLag := now.Sub(node.LastPingedAt) - time.Duration(node.PingInterval)*time.Minute
+		if nodeLag > lag {
+			lag = nodeLag
+		}
+	}
+	return lag
+}
+
 func startOldPingNodesLoader(db *pg.DB, userNodesChan chan *core.UserNode, chunkSize int) utils.Worker {
 	worker := utils.NewSimpleWorker(1)
 
@@ -63,11 +302,13 @@ func startOldPingNodesLoader(db *pg.DB, userNodesChan chan *core.UserNode, chunk
 		defer worker.Done()
 		for {
 			userNodes := make([]*core.UserNode, chunkSize)
-			err := db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			err := utils.RunInTimedTransaction(db, "ping_load", func(tx *pg.Tx) error {
 				_, err := tx.Query(&userNodes, `
-					SELECT user_id, node_id AS raw_id, address, ping_mode FROM user_nodes
+					SELECT user_id, node_id AS raw_id, address, ping_mode, ping_proto, ping_all_sats, ping_interval, last_pinged_at,
+						`+core.InMaintenanceSQL+` AS in_maintenance
+					FROM user_nodes
 					WHERE ping_mode != 'off'
-					  AND (last_pinged_at IS NULL OR last_pinged_at < NOW() - INTERVAL '0.9 minute')
+					  AND (last_pinged_at IS NULL OR last_pinged_at < NOW() - (ping_interval - 0.1) * INTERVAL '1 minute')
 					ORDER BY last_pinged_at ASC NULLS FIRST
 					LIMIT ?
 					FOR UPDATE`, chunkSize)
@@ -90,6 +331,7 @@ func startOldPingNodesLoader(db *pg.DB, userNodesChan chan *core.UserNode, chunk
 			}
 
 			log.Info().Int("IDs count", len(userNodes)).Msg("PING:OLD")
+			pingLag.Set(maxPingLag(userNodes, time.Now()).Seconds())
 			if len(userNodes) == 0 {
 				time.Sleep(10 * time.Second)
 			}
@@ -123,7 +365,31 @@ func startNodesPinger(userNodesInChan chan *core.UserNode, userNodesOutChan chan
 				nodeWithErr := &UserNodeWithErr{UserNode: *userNode, Err: nil}
 				nodeWithErr.LastPingedAt = time.Now()
 
-				pingDuration, err := doPing(sats, &userNode.Node)
+				primaryMode := storjutils.SatModeTCP
+				if userNode.PrimaryPingIsQUIC() {
+					primaryMode = storjutils.SatModeQUIC
+				}
+				pingDuration, satLabel, satPings, err := pingNode(sats, &userNode.Node, primaryMode)
+				nodeWithErr.SatLabel = satLabel
+				nodeWithErr.LastSatPings = satPings
+
+				if userNode.NeedsQUICPing() {
+					quicDuration, quicErr := pingDuration, err
+					if !userNode.PrimaryPingIsQUIC() {
+						quicDuration, _, quicErr = doPing(sats, &userNode.Node, storjutils.SatModeQUIC)
+					}
+					nodePingsCount.Inc(storjutils.SatModeQUIC.String(), pingResultLabel(quicErr))
+					nodeWithErr.QUICPinged = true
+					nodeWithErr.QUICErr = quicErr
+					if quicErr == nil {
+						nodeWithErr.LastQUICPing = quicDuration.Microseconds() / 1000
+						nodeWithErr.LastQUICUpAt = nodeWithErr.LastPingedAt
+					}
+				}
+
+				if !userNode.PrimaryPingIsQUIC() {
+					nodePingsCount.Inc(primaryMode.String(), pingResultLabel(err))
+				}
 				if err != nil {
 					atomic.AddInt64(&countErrTotal, 1)
 					if merry.Is(err, ErrDialFail) {
@@ -168,53 +434,106 @@ func startPingedNodesSaver(db *pg.DB, userNodesChan chan *UserNodeWithErr, chunk
 	countNew := 0
 	go func() {
 		defer worker.Done()
-		err := utils.SaveChunked(db, chunkSize, userNodesChanI, func(tx *pg.Tx, items []interface{}) error {
+		err := utils.SaveChunked(db, "ping_save", chunkSize, userNodesChanI, func(tx *pg.Tx, items []interface{}) error {
 			userNodes := make([]*core.UserNode, len(items))
 			for i, nodeI := range items {
 				userNodes[i] = &nodeI.(*UserNodeWithErr).UserNode
 			}
-			_, err := tx.Exec("SELECT 1 FROM user_nodes WHERE (user_id, node_id) IN (?) FOR UPDATE",
-				NodeIDListAsPGTuple(userNodes))
+			alertStates, err := loadAlertStatesForUpdate(tx, userNodes)
 			if err != nil {
 				return merry.Wrap(err)
 			}
 
 			for _, nodeI := range items {
 				node := nodeI.(*UserNodeWithErr)
-				stamp := node.LastPingedAt.Unix()
-				index := stamp%(24*3600)/60 + 1
-				timeHint := (stamp % 60) / 4
-
-				var pingValue int64
-				if node.Err == nil {
-					ping := node.LastPing
-					if ping >= 2000 {
-						ping = 2000 - 1
-					}
-					if ping <= 1 {
-						ping = 2
+				alertState, hasAlertState := alertStates[makeUserNodeKey(&node.UserNode)]
+				second, pingValue := encodeHistoryPing(node.LastPingedAt, node.Err == nil, node.LastPing)
+
+				// alert state (frozen during maintenance: no events, fails are not counted)
+				var event *core.UserNodeEvent
+				if node.InMaintenance {
+					hasAlertState = false
+				}
+				if hasAlertState {
+					kind, downSince := alertState.Update(alertState.Rules, node.LastPingedAt, node.Err == nil)
+					if kind != "" {
+						lastPing := alertState.LastPing
+						if node.Err == nil {
+							lastPing = node.LastPing
+						}
+						event = &core.UserNodeEvent{
+							UserID:    node.UserID,
+							NodeID:    node.ID,
+							Kind:      kind,
+							Address:   node.Address,
+							LastPing:  lastPing,
+							SatLabel:  node.SatLabel,
+							DownSince: downSince,
+							CreatedAt: node.LastPingedAt,
+						}
 					}
-					pingValue = timeHint*2000 + ping
-				} else {
-					pingValue = timeHint*2000 + 1
 				}
 
 				// user_node flags and timestamps
 				var err error
-				if node.Err == nil {
+				switch {
+				case node.Err == nil && hasAlertState:
 					_, err = tx.Exec(`
-						UPDATE user_nodes SET last_ping = ?, last_ping_was_ok = true, last_up_at = ?
+						UPDATE user_nodes SET last_ping = ?, last_ping_was_ok = true, last_up_at = ?,
+							fails_count = 0, down_since = NULL, alert_is_down = false, last_sat_pings = ?,
+							check_bits = ?, check_bits_count = ?, is_flapping = ?
 						WHERE node_id = ? AND user_id = ?`,
-						node.LastPing, node.LastUpAt, node.ID, node.UserID)
-				} else {
+						node.LastPing, node.LastUpAt, node.LastSatPings,
+						alertState.CheckBits, alertState.CheckBitsCount, alertState.IsFlapping, node.ID, node.UserID)
+				case node.Err == nil:
+					// maintenance: alert state is frozen
 					_, err = tx.Exec(`
-						UPDATE user_nodes SET last_ping_was_ok = false
+						UPDATE user_nodes SET last_ping = ?, last_ping_was_ok = true, last_up_at = ?, last_sat_pings = ?
 						WHERE node_id = ? AND user_id = ?`,
+						node.LastPing, node.LastUpAt, node.LastSatPings, node.ID, node.UserID)
+				case hasAlertState:
+					_, err = tx.Exec(`
+						UPDATE user_nodes SET last_ping_was_ok = false,
+							fails_count = ?, down_since = ?, alert_is_down = ?, last_sat_pings = ?,
+							check_bits = ?, check_bits_count = ?, is_flapping = ?
+						WHERE node_id = ? AND user_id = ?`,
+						alertState.FailsCount, pg.NullTime{Time: alertState.DownSince}, alertState.AlertIsDown,
+						node.LastSatPings, alertState.CheckBits, alertState.CheckBitsCount, alertState.IsFlapping,
 						node.ID, node.UserID)
+				default:
+					_, err = tx.Exec(`
+						UPDATE user_nodes SET last_ping_was_ok = false, last_sat_pings = ?
+						WHERE node_id = ? AND user_id = ?`,
+						node.LastSatPings, node.ID, node.UserID)
 				}
 				if err != nil {
 					return merry.Wrap(err)
 				}
+				if node.QUICPinged {
+					if node.QUICErr == nil {
+						_, err = tx.Exec(`
+							UPDATE user_nodes SET last_quic_ping = ?, last_quic_ping_was_ok = true, last_quic_up_at = ?
+							WHERE node_id = ? AND user_id = ?`,
+							node.LastQUICPing, node.LastQUICUpAt, node.ID, node.UserID)
+					} else {
+						_, err = tx.Exec(`
+							UPDATE user_nodes SET last_quic_ping_was_ok = false
+							WHERE node_id = ? AND user_id = ?`,
+							node.ID, node.UserID)
+					}
+					if err != nil {
+						return merry.Wrap(err)
+					}
+				}
+
+				// user_node event
+				if event != nil {
+					if err := core.SaveUserNodeEvent(tx, event); err != nil {
+						return merry.Wrap(err)
+					}
+					log.Info().Int64("user_id", event.UserID).Str("node_id", event.NodeID.String()).
+						Str("kind", string(event.Kind)).Msg("PING:EVENT")
+				}
 
 				// user_node auto off
 				if node.Err != nil {
@@ -232,24 +551,27 @@ func startPingedNodesSaver(db *pg.DB, userNodesChan chan *UserNodeWithErr, chunk
 					}
 				}
 
-				// history (update attempt, most common)
-				res, err := tx.Exec(`
-					UPDATE user_nodes_history SET pings[?] = ?
-					WHERE node_id = ? AND user_id = ? AND date = (? at time zone 'utc')::date
-					`, index, pingValue, node.ID, node.UserID, node.LastPingedAt)
+				// history
+				isNew, err := saveHistoryPing(tx, node, "", second, pingValue)
 				if err != nil {
 					return merry.Wrap(err)
 				}
-				// history (insert, in case of no updates)
-				if res.RowsAffected() == 0 {
-					_, err := tx.Exec(`
-						INSERT INTO user_nodes_history (node_id, user_id, date, pings)
-						VALUES (?, ?, (? at time zone 'utc')::date, array(SELECT CASE WHEN i = ? THEN ? ELSE 0 END FROM generate_series(1, 24*60) AS i))
-						`, node.ID, node.UserID, node.LastPingedAt, index, pingValue)
-					if err != nil {
+				if isNew {
+					countNew++
+				}
+				// per-satellite history
+				for _, satPing := range node.LastSatPings {
+					second, pingValue := encodeHistoryPing(node.LastPingedAt, satPing.Ok, satPing.Ping)
+					if _, err := saveHistoryPing(tx, node, satPing.Sat, second, pingValue); err != nil {
+						return merry.Wrap(err)
+					}
+				}
+				// QUIC history
+				if node.QUICPinged {
+					second, pingValue := encodeHistoryPing(node.LastPingedAt, node.QUICErr == nil, node.LastQUICPing)
+					if err := saveQUICHistoryPing(tx, node, second, pingValue); err != nil {
 						return merry.Wrap(err)
 					}
-					countNew++
 				}
 				count++
 			}
@@ -284,6 +606,8 @@ func StartUpdater() error {
 		}
 
 		iter += 1
+		pingQueueLength.Set(float64(len(userNodesInChan)), "in")
+		pingQueueLength.Set(float64(len(userNodesOutChan)), "out")
 		if iter%5 == 0 {
 			log.Info().Int("in_chan", len(userNodesInChan)).Int("out_chan", len(userNodesOutChan)).Msg("PING:STAT")
 		}
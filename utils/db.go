@@ -6,6 +6,7 @@ import (
 	"net/netip"
 	"os"
 	"path/filepath"
+	"storjnet/utils/metrics"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -242,13 +243,28 @@ func PrintPGErrInfo(err error) {
 	}
 }
 
-func SaveChunked(db *pg.DB, chunkSize int, channel chan interface{}, handler func(tx *pg.Tx, items []interface{}) error) error {
+var dbTxDuration = metrics.Default.NewHistogram("storjnet_db_tx_duration_seconds",
+	"Duration of DB transactions by name and result.", metrics.DurationBuckets, "tx", "result")
+
+// RunInTimedTransaction is db.RunInTransaction which duration is exposed as a metric labeled by name.
+func RunInTimedTransaction(db *pg.DB, name string, fn func(tx *pg.Tx) error) error {
+	stt := time.Now()
+	err := db.RunInTransaction(context.Background(), fn)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	dbTxDuration.Observe(time.Since(stt).Seconds(), name, result)
+	return merry.Wrap(err)
+}
+
+func SaveChunked(db *pg.DB, txName string, chunkSize int, channel chan interface{}, handler func(tx *pg.Tx, items []interface{}) error) error {
 	var err error
 	items := make([]interface{}, 0, chunkSize)
 	for item := range channel {
 		items = append(items, item)
 		if len(items) >= chunkSize {
-			err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+			err = RunInTimedTransaction(db, txName, func(tx *pg.Tx) error {
 				return merry.Wrap(handler(tx, items))
 			})
 			if err != nil {
@@ -258,7 +274,7 @@ func SaveChunked(db *pg.DB, chunkSize int, channel chan interface{}, handler fun
 		}
 	}
 	if len(items) > 0 {
-		err = db.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		err = RunInTimedTransaction(db, txName, func(tx *pg.Tx) error {
 			return merry.Wrap(handler(tx, items))
 		})
 	}
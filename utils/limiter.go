@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type LockoutLimiterConfig struct {
+	MaxAttempts int           // failed attempts allowed before the first lockout
+	Lockout     time.Duration // first lockout duration, doubled on each next failure
+	MaxLockout  time.Duration // lockout duration limit, also failures are forgotten after this idle time
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LockoutLimiter counts failed attempts (of logging in, for example) by arbitrary keys
+// (IPs, usernames) and locks keys out with exponentially growing durations.
+type LockoutLimiter struct {
+	cfg         LockoutLimiterConfig
+	mutex       sync.Mutex
+	entries     map[string]*lockoutEntry
+	lastCleanup time.Time
+}
+
+func NewLockoutLimiter(cfg LockoutLimiterConfig) *LockoutLimiter {
+	return &LockoutLimiter{cfg: cfg, entries: make(map[string]*lockoutEntry)}
+}
+
+// LockedFor returns remaining lockout duration of the most locked key (zero if none is locked).
+func (l *LockoutLimiter) LockedFor(keys ...string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	res := time.Duration(0)
+	for _, key := range keys {
+		if e, ok := l.entries[key]; ok && e.lockedUntil.Sub(now) > res {
+			res = e.lockedUntil.Sub(now)
+		}
+	}
+	return res
+}
+
+// Fail registers failed attempt for each key.
+func (l *LockoutLimiter) Fail(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	l.cleanupIfNeed(now)
+	for _, key := range keys {
+		e, ok := l.entries[key]
+		if !ok || (now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.cfg.MaxLockout) {
+			e = &lockoutEntry{}
+			l.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+		if extra := e.failures - l.cfg.MaxAttempts; extra >= 0 {
+			lockout := l.cfg.MaxLockout
+			if extra < 30 && l.cfg.Lockout<<extra < l.cfg.MaxLockout {
+				lockout = l.cfg.Lockout << extra
+			}
+			e.lockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+// Reset forgets failed attempts of the keys (e.g. of the username after successful login).
+func (l *LockoutLimiter) Reset(keys ...string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, key := range keys {
+		delete(l.entries, key)
+	}
+}
+
+func (l *LockoutLimiter) cleanupIfNeed(now time.Time) {
+	if now.Sub(l.lastCleanup) < time.Minute {
+		return
+	}
+	l.lastCleanup = now
+	for key, e := range l.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > l.cfg.MaxLockout {
+			delete(l.entries, key)
+		}
+	}
+}
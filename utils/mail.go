@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/rs/zerolog/log"
+)
+
+type Mailer interface {
+	Send(to, subject, text string) error
+}
+
+type SMTPConfig struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	SiteURL  string //for links in emails
+}
+
+func (c SMTPConfig) IsSet() bool {
+	return c.Addr != ""
+}
+
+// SMTPMailer sends plain text emails. Works with any SMTP server, including local stand-ins
+// like MailHog/smtp4dev (no auth, no TLS).
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (m *SMTPMailer) Send(to, subject, text string) error {
+	msg, err := buildPlainTextEmail(m.cfg.From, to, subject, text)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		host, _, err := net.SplitHostPort(m.cfg.Addr)
+		if err != nil {
+			return merry.Wrap(err)
+		}
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, host)
+	}
+	fromAddr, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	return merry.Wrap(smtp.SendMail(m.cfg.Addr, auth, fromAddr.Address, []string{to}, msg))
+}
+
+// LogMailer just logs emails, for development without SMTP server.
+type LogMailer struct{}
+
+func (m LogMailer) Send(to, subject, text string) error {
+	log.Info().Str("to", to).Str("subject", subject).Str("text", text).Msg("MAIL:LOG")
+	return nil
+}
+
+func buildPlainTextEmail(from, to, subject, text string) ([]byte, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	toAddr, err := mail.ParseAddress(to)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "From: %s\r\n", fromAddr.String())
+	fmt.Fprintf(buf, "To: %s\r\n", toAddr.String())
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "Message-ID: <%s@storjnet>\r\n", RandHexString(32))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(buf)
+	if _, err := qp.Write([]byte(text)); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	if err := qp.Close(); err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return buf.Bytes(), nil
+}
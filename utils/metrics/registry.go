@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ansel1/merry"
+	"github.com/rs/zerolog/log"
+)
+
+// DurationBuckets are default histogram buckets for durations in seconds.
+var DurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type series struct {
+	labels  []string //name-value pairs
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+// family is a metric with a fixed set of label names and a series per label values combination.
+// Series are created on first update, families without series are not written at all
+// (so metrics of workers not running in the current process are not exposed).
+type family struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+	mutex      sync.Mutex
+	series     map[string]*series
+}
+
+func (f *family) getSeries(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic("metrics: " + f.name + ": wrong label values count")
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: make([]string, 0, len(labelValues)*2)}
+		for i, value := range labelValues {
+			s.labels = append(s.labels, f.labelNames[i], value)
+		}
+		if f.buckets != nil {
+			s.buckets = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) add(value float64, labelValues []string) {
+	f.mutex.Lock()
+	f.getSeries(labelValues).value += value
+	f.mutex.Unlock()
+}
+
+func (f *family) set(value float64, labelValues []string) {
+	f.mutex.Lock()
+	f.getSeries(labelValues).value = value
+	f.mutex.Unlock()
+}
+
+func (f *family) observe(value float64, labelValues []string) {
+	f.mutex.Lock()
+	s := f.getSeries(labelValues)
+	for i, bound := range f.buckets {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.value += value
+	s.count++
+	f.mutex.Unlock()
+}
+
+func (f *family) write(mw *Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if len(f.series) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	mw.Header(f.name, f.typ, f.help)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != TypeHistogram {
+			mw.Sample(f.name, s.value, s.labels...)
+			continue
+		}
+		for i, bound := range f.buckets {
+			mw.Sample(f.name+"_bucket", float64(s.buckets[i]), append(s.labels, "le", formatValue(bound))...)
+		}
+		mw.Sample(f.name+"_bucket", float64(s.count), append(s.labels, "le", formatValue(math.Inf(1)))...)
+		mw.Sample(f.name+"_sum", s.value, s.labels...)
+		mw.Sample(f.name+"_count", float64(s.count), s.labels...)
+	}
+}
+
+type Counter struct{ f *family }
+
+func (c Counter) Inc(labelValues ...string) {
+	c.f.add(1, labelValues)
+}
+
+func (c Counter) Add(value float64, labelValues ...string) {
+	c.f.add(value, labelValues)
+}
+
+type Gauge struct{ f *family }
+
+func (g Gauge) Set(value float64, labelValues ...string) {
+	g.f.set(value, labelValues)
+}
+
+func (g Gauge) Add(value float64, labelValues ...string) {
+	g.f.add(value, labelValues)
+}
+
+type Histogram struct{ f *family }
+
+func (h Histogram) Observe(value float64, labelValues ...string) {
+	h.f.observe(value, labelValues)
+}
+
+type collector interface {
+	write(mw *Writer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry of the process metrics, served by StartServer.
+var Default = NewRegistry()
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mutex.Unlock()
+}
+
+func (r *Registry) newFamily(name, help, typ string, buckets []float64, labelNames []string) *family {
+	f := &family{name: name, help: help, typ: typ, labelNames: labelNames, buckets: buckets, series: make(map[string]*series)}
+	r.register(f)
+	return f
+}
+
+func (r *Registry) NewCounter(name, help string, labelNames ...string) Counter {
+	return Counter{r.newFamily(name, help, TypeCounter, nil, labelNames)}
+}
+
+func (r *Registry) NewGauge(name, help string, labelNames ...string) Gauge {
+	return Gauge{r.newFamily(name, help, TypeGauge, nil, labelNames)}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) Histogram {
+	return Histogram{r.newFamily(name, help, TypeHistogram, buckets, labelNames)}
+}
+
+func (r *Registry) Write(mw *Writer) {
+	r.mutex.Lock()
+	collectors := r.collectors
+	r.mutex.Unlock()
+	for _, c := range collectors {
+		c.write(mw)
+	}
+}
+
+func (r *Registry) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
+	wr.Header().Set("Content-Type", ContentType)
+	mw := NewWriter(wr)
+	r.Write(mw)
+	if err := mw.Flush(); err != nil {
+		log.Warn().Err(err).Msg("metrics: write failed")
+	}
+}
+
+// StartServer serves Default registry at http://address/metrics in background.
+// Does nothing if address is empty.
+func StartServer(address string) error {
+	if address == "" {
+		return nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Default)
+	log.Info().Str("address", address).Msg("starting metrics server")
+	go func() {
+		log.Fatal().Err(http.Serve(listener, mux)).Msg("metrics server failed")
+	}()
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package metrics writes metrics in Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ansel1/merry"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+const (
+	TypeGauge     = "gauge"
+	TypeCounter   = "counter"
+	TypeHistogram = "histogram"
+)
+
+// Writer writes metric families: Header followed by samples. Write errors
+// are remembered and returned by Flush, so samples may be written without checks.
+type Writer struct {
+	buf *bufio.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{buf: bufio.NewWriter(w)}
+}
+
+func (w *Writer) write(strs ...string) {
+	for _, s := range strs {
+		if w.err != nil {
+			return
+		}
+		_, w.err = w.buf.WriteString(s)
+	}
+}
+
+// Header starts a metric family.
+func (w *Writer) Header(name, typ, help string) {
+	w.write("# HELP ", name, " ", escapeHelp(help), "\n")
+	w.write("# TYPE ", name, " ", typ, "\n")
+}
+
+// Sample writes a value, labels are name-value pairs: Sample("x", 1, "sat", "us1", "proto", "tcp").
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.write(name)
+	if len(labels) > 0 {
+		w.write("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.write(",")
+			}
+			w.write(labels[i], `="`, escapeLabelValue(labels[i+1]), `"`)
+		}
+		w.write("}")
+	}
+	w.write(" ", formatValue(value), "\n")
+}
+
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return merry.Wrap(w.err)
+	}
+	return merry.Wrap(w.buf.Flush())
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/go-pg/pg/v10"
+)
+
+type RateLimitConfig struct {
+	IPLimit    int           // requests per period for anonymous clients (by IP)
+	TokenLimit int           // requests per period for API tokens
+	Period     time.Duration // time to fully refill the bucket
+	Store      string        // "memory" or "pg" (shared between several HTTP server instances)
+}
+
+func (c RateLimitConfig) Validate() error {
+	if c.IPLimit <= 0 || c.TokenLimit <= 0 {
+		return merry.New("rate limits must be positive")
+	}
+	if c.Period <= 0 {
+		return merry.New("rate limit period must be positive")
+	}
+	return nil
+}
+
+// RateLimitStore keeps token buckets. Buckets are stored as "theoretical arrival time" (GCRA):
+// the moment when the bucket will be full again. Each request moves it by interval to the future,
+// request is allowed if the result is not further than period from now.
+type RateLimitStore interface {
+	Take(key string, interval, period time.Duration) (tat time.Time, ok bool, err error)
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next request will be allowed (for denied requests)
+}
+
+type RateLimiter struct {
+	store RateLimitStore
+}
+
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store}
+}
+
+// Take tries to take one request from the key's bucket with size limit which refills in period.
+func (l *RateLimiter) Take(key string, limit int, period time.Duration) (RateLimitResult, error) {
+	if limit <= 0 || period <= 0 {
+		return RateLimitResult{}, merry.Errorf("invalid rate limit: %d per %s", limit, period)
+	}
+	interval := period / time.Duration(limit)
+	tat, ok, err := l.store.Take(key, interval, period)
+	if err != nil {
+		return RateLimitResult{}, merry.Wrap(err)
+	}
+	res := RateLimitResult{Allowed: ok, Limit: limit}
+	res.Reset = time.Until(tat)
+	if res.Reset < 0 {
+		res.Reset = 0
+	}
+	if ok {
+		res.Remaining = int((period - res.Reset) / interval)
+	} else {
+		res.RetryAfter = res.Reset + interval - period
+	}
+	return res, nil
+}
+
+type MemoryRateLimitStore struct {
+	mutex       sync.Mutex
+	tats        map[string]time.Time
+	lastCleanup time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{tats: make(map[string]time.Time)}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, interval, period time.Duration) (time.Time, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(s.lastCleanup) > time.Minute {
+		s.lastCleanup = now
+		for k, tat := range s.tats {
+			if tat.Before(now) {
+				delete(s.tats, k)
+			}
+		}
+	}
+
+	tat := s.tats[key]
+	if tat.Before(now) {
+		tat = now
+	}
+	newTat := tat.Add(interval)
+	if newTat.Sub(now) > period {
+		return tat, false, nil
+	}
+	s.tats[key] = newTat
+	return newTat, true, nil
+}
+
+// PGRateLimitStore keeps buckets in rate_limit_buckets table (expired rows are removed by optimizer).
+type PGRateLimitStore struct {
+	db *pg.DB
+}
+
+func NewPGRateLimitStore(db *pg.DB) *PGRateLimitStore {
+	return &PGRateLimitStore{db: db}
+}
+
+func (s *PGRateLimitStore) Take(key string, interval, period time.Duration) (time.Time, bool, error) {
+	var tat time.Time
+	_, err := s.db.QueryOne(pg.Scan(&tat), `
+		INSERT INTO rate_limit_buckets AS b (key, tat) VALUES (?0, NOW() + ?1 * INTERVAL '1 microsecond')
+		ON CONFLICT (key) DO UPDATE SET tat = GREATEST(b.tat, NOW()) + ?1 * INTERVAL '1 microsecond'
+		WHERE GREATEST(b.tat, NOW()) + ?1 * INTERVAL '1 microsecond' <= NOW() + ?2 * INTERVAL '1 microsecond'
+		RETURNING tat`,
+		key, interval.Microseconds(), period.Microseconds())
+	if err == nil {
+		return tat, true, nil
+	}
+	if err != pg.ErrNoRows {
+		return tat, false, merry.Wrap(err)
+	}
+	// denied: bucket was not updated, loading its current state for headers
+	_, err = s.db.QueryOne(pg.Scan(&tat), `SELECT tat FROM rate_limit_buckets WHERE key = ?`, key)
+	if err != nil {
+		return tat, false, merry.Wrap(err)
+	}
+	return tat, false, nil
+}
@@ -0,0 +1,26 @@
+package storjutils
+
+import "storjnet/utils/metrics"
+
+var (
+	satPingsCount = metrics.Default.NewCounter("storjnet_sat_pings_total",
+		"Node dials (and pings) made via satellite by result.", "sat", "proto", "result")
+	satDialDuration = metrics.Default.NewHistogram("storjnet_sat_dial_duration_seconds",
+		"Successful node dials duration.", metrics.DurationBuckets, "sat", "proto")
+	satPingDuration = metrics.Default.NewHistogram("storjnet_sat_ping_duration_seconds",
+		"Successful node pings duration (after dial).", metrics.DurationBuckets, "sat", "proto")
+	proxyErrorsCount = metrics.Default.NewCounter("storjnet_proxy_errors_total",
+		"Ping proxy errors (except node dial/ping ones) by proxy mode and kind.", "mode", "kind")
+)
+
+func observePing(satLabel string, mode SatMode, dialOnly bool, durs PingDurations, err error) {
+	if err != nil {
+		satPingsCount.Inc(satLabel, mode.String(), "error")
+		return
+	}
+	satPingsCount.Inc(satLabel, mode.String(), "ok")
+	satDialDuration.Observe(durs.DialDuration, satLabel, mode.String())
+	if !dialOnly {
+		satPingDuration.Observe(durs.PingDuration, satLabel, mode.String())
+	}
+}
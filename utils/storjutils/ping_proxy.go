@@ -68,6 +68,7 @@ func StartPingHTTPProxy(address, endpointPath string, sat *SatelliteLocal) error
 		nodeID, err := storj.NodeIDFromString(nodeIDStr)
 		if err != nil {
 			log.Error().Err(err).Str("raw", nodeIDStr).Msg("HTTP: invalid node ID")
+			proxyErrorsCount.Inc("http", "invalid_request")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -80,6 +81,7 @@ func StartPingHTTPProxy(address, endpointPath string, sat *SatelliteLocal) error
 			mode = SatModeQUIC
 		} else {
 			log.Error().Err(err).Str("raw", modeStr).Msg("HTTP: invalid mode")
+			proxyErrorsCount.Inc("http", "invalid_request")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -88,6 +90,7 @@ func StartPingHTTPProxy(address, endpointPath string, sat *SatelliteLocal) error
 		timeoutMS, err := strconv.Atoi(timeoutStr)
 		if err != nil || timeoutMS <= 0 || timeoutMS > 60*1000 {
 			log.Error().Err(err).Str("raw", timeoutStr).Msg("HTTP: invalid timeout")
+			proxyErrorsCount.Inc("http", "invalid_request")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -135,18 +138,21 @@ func StartPingUDPProxy(address, endpointPath string, sat *SatelliteLocal) error
 		n, remoteaddr, err := ser.ReadFromUDP(inBuf)
 		if err != nil {
 			log.Error().Err(err).Msg("UDP: reading socket")
+			proxyErrorsCount.Inc("udp", "socket")
 			continue
 		}
 
 		payload, endpointMatches := DecodePingUDPProxyMaskedBuf(inBuf[:n], endpointPath)
 		if !endpointMatches {
 			log.Error().Msg("UDP: invalid payload prefix")
+			proxyErrorsCount.Inc("udp", "invalid_request")
 			continue
 		}
 
 		var data PingUDPProxyRequest
 		if err := json.Unmarshal(payload, &data); err != nil {
 			log.Error().Err(err).Msg("UDP: invalid payload data")
+			proxyErrorsCount.Inc("udp", "invalid_request")
 			continue
 		}
 
@@ -170,6 +176,7 @@ func StartPingUDPProxy(address, endpointPath string, sat *SatelliteLocal) error
 			nodeID, err := storj.NodeIDFromString(data.ID)
 			if err != nil {
 				log.Error().Err(err).Str("raw", data.ID).Msg("UDP: invalid node ID")
+				proxyErrorsCount.Inc("udp", "invalid_request")
 				return
 			}
 
@@ -180,11 +187,13 @@ func StartPingUDPProxy(address, endpointPath string, sat *SatelliteLocal) error
 				mode = SatModeQUIC
 			} else {
 				log.Error().Err(err).Str("raw", data.Mode).Msg("UDP: invalid mode")
+				proxyErrorsCount.Inc("udp", "invalid_request")
 				return
 			}
 
 			if data.Timeout <= 0 || data.Timeout > 60*1000 {
 				log.Error().Err(err).Int64("raw", data.Timeout).Msg("UDP: invalid timeout")
+				proxyErrorsCount.Inc("udp", "invalid_request")
 				return
 			}
 
@@ -200,6 +209,7 @@ func StartPingUDPProxy(address, endpointPath string, sat *SatelliteLocal) error
 			})
 			if err != nil {
 				log.Error().Err(err).Msg("UDP: JSON encode error")
+				proxyErrorsCount.Inc("udp", "encode")
 				return
 			}
 			outBuf := EncodePingUDPProxyMaskedBuf(respPayload, endpointPath)
@@ -207,6 +217,7 @@ func StartPingUDPProxy(address, endpointPath string, sat *SatelliteLocal) error
 			for i := 0; i < PingUDPProxyPacketRepeat; i++ {
 				if _, err := ser.WriteToUDP(outBuf, remoteaddr); err != nil {
 					log.Error().Err(err).Int("iteration", i).Msg("UDP: write error")
+					proxyErrorsCount.Inc("udp", "socket")
 				}
 			}
 		}()
@@ -29,6 +29,13 @@ const (
 	SatModeQUIC
 )
 
+func (m SatMode) String() string {
+	if m == SatModeQUIC {
+		return "quic"
+	}
+	return "tcp"
+}
+
 // Since v1.30.2 nodes return error to pings from untrusted satellites
 // https://github.com/storj/storj/releases/tag/v1.30.2
 func IsUntrustedSatPingError(err error) bool {
@@ -109,7 +116,9 @@ func (sat *SatelliteLocal) UsesProxy() bool {
 	return false
 }
 
-func (sat *SatelliteLocal) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (PingDurations, error) {
+func (sat *SatelliteLocal) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (durs PingDurations, err error) {
+	defer func() { observePing(sat.label, mode, dialOnly, durs, err) }()
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -156,16 +165,13 @@ func (sat *SatelliteHTTPProxy) UsesProxy() bool {
 	return true
 }
 
-func (sat *SatelliteHTTPProxy) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (PingDurations, error) {
-	modeStr := "tcp"
-	if mode == SatModeQUIC {
-		modeStr = "quic"
-	}
+func (sat *SatelliteHTTPProxy) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (durs PingDurations, err error) {
+	defer func() { observePing(sat.label, mode, dialOnly, durs, err) }()
 
 	query := make(url.Values)
 	query.Set("id", id.String())
 	query.Set("addr", address)
-	query.Set("mode", modeStr)
+	query.Set("mode", mode.String())
 	query.Set("timeout", strconv.FormatInt(int64(timeout/time.Millisecond), 10))
 	if dialOnly {
 		query.Set("dialOnly", "1")
@@ -213,17 +219,14 @@ func (sat *SatelliteUDPProxy) UsesProxy() bool {
 	return true
 }
 
-func (sat *SatelliteUDPProxy) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (PingDurations, error) {
-	modeStr := "tcp"
-	if mode == SatModeQUIC {
-		modeStr = "quic"
-	}
+func (sat *SatelliteUDPProxy) PingAndClose(address string, id storj.NodeID, mode SatMode, dialOnly bool, timeout time.Duration) (durs PingDurations, err error) {
+	defer func() { observePing(sat.label, mode, dialOnly, durs, err) }()
 
 	req := PingUDPProxyRequest{
 		RequestID: sat.lastRequestID.Add(1),
 		ID:        id.String(),
 		Addr:      address,
-		Mode:      modeStr,
+		Mode:      mode.String(),
 		Timeout:   int64(timeout / time.Millisecond),
 		DialOnly:  dialOnly,
 	}
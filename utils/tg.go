@@ -1,10 +1,32 @@
 package utils
 
 import (
+	"net/http"
+
 	"github.com/ansel1/merry"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"golang.org/x/net/proxy"
 )
 
+func TGMakeBot(botToken, socks5ProxyAddr string) (*tgbotapi.BotAPI, error) {
+	httpClient := &http.Client{}
+	if socks5ProxyAddr != "" {
+		// auth := &proxy.Auth{User: *socksUser, Password: *socksPassword}
+		dialer, err := proxy.SOCKS5("tcp", socks5ProxyAddr, nil, proxy.Direct)
+		if err != nil {
+			return nil, merry.Wrap(err)
+		}
+		httpTransport := &http.Transport{Dial: dialer.Dial}
+		httpClient.Transport = httpTransport
+	}
+
+	bot, err := tgbotapi.NewBotAPIWithClient(botToken, httpClient)
+	if err != nil {
+		return nil, merry.Wrap(err)
+	}
+	return bot, nil
+}
+
 func TGSendMessageMD(bot *tgbotapi.BotAPI, chatID int64, text string) error {
 	_, err := bot.Send(tgbotapi.MessageConfig{
 		BaseChat: tgbotapi.BaseChat{
@@ -1,30 +1,17 @@
 package versions
 
 import (
-	"net/http"
 	"storjnet/core"
 	"storjnet/utils"
 	"time"
 
 	"github.com/ansel1/merry"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/go-pg/pg/v10"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/net/proxy"
 )
 
 func sendTGMessages(botToken, socks5ProxyAddr, text string, chatIDs []int64) error {
-	httpClient := &http.Client{}
-	if socks5ProxyAddr != "" {
-		// auth := &proxy.Auth{User: *socksUser, Password: *socksPassword}
-		dialer, err := proxy.SOCKS5("tcp", socks5ProxyAddr, nil, proxy.Direct)
-		if err != nil {
-			return merry.Wrap(err)
-		}
-		httpTransport := &http.Transport{Dial: dialer.Dial}
-		httpClient.Transport = httpTransport
-	}
-
-	bot, err := tgbotapi.NewBotAPIWithClient(botToken, httpClient)
+	bot, err := utils.TGMakeBot(botToken, socks5ProxyAddr)
 	if err != nil {
 		return merry.Wrap(err)
 	}
@@ -43,9 +30,32 @@ func sendTGMessages(botToken, socks5ProxyAddr, text string, chatIDs []int64) err
 	return nil
 }
 
-func CheckVersions(tgBotToken, tgSocks5ProxyAddr string) error {
+func sendEmails(db *pg.DB, mailer utils.Mailer, checker core.VersionChecker) error {
+	var users []struct{ Email, Lang string }
+	_, err := db.Query(&users, `
+		SELECT u.email, s.lang FROM users AS u
+		JOIN user_alert_settings AS s ON s.user_id = u.id
+		WHERE u.email IS NOT NULL AND s.email_versions`)
+	if err != nil {
+		return merry.Wrap(err)
+	}
+	for _, user := range users {
+		subject, text := checker.EmailNew(user.Lang)
+		if err := mailer.Send(user.Email, "storjnet: "+subject, text); err != nil {
+			log.Error().Err(err).Str("email", user.Email).Msg("email sending error")
+		}
+	}
+	return nil
+}
+
+func CheckVersions(tgBotToken, tgSocks5ProxyAddr string, smtpConfig utils.SMTPConfig) error {
 	db := utils.MakePGConnection()
 
+	var mailer utils.Mailer
+	if smtpConfig.IsSet() {
+		mailer = utils.NewSMTPMailer(smtpConfig)
+	}
+
 	for _, checker := range core.MakeVersionCheckers(db) {
 		if err := checker.FetchPrevVersion(); err != nil {
 			return merry.Wrap(err)
@@ -65,6 +75,11 @@ func CheckVersions(tgBotToken, tgSocks5ProxyAddr string) error {
 			if err := sendTGMessages(tgBotToken, tgSocks5ProxyAddr, text, tgChatIDs); err != nil {
 				return merry.Wrap(err)
 			}
+			if mailer != nil {
+				if err := sendEmails(db, mailer, checker); err != nil {
+					return merry.Wrap(err)
+				}
+			}
 			if err := checker.SaveCurVersion(); err != nil {
 				return merry.Wrap(err)
 			}
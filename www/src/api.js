@@ -14,6 +14,24 @@ class APIError extends Error {
 	}
 }
 
+/**
+ * Organization ID if the page is opened in organization context (like /~?org=123)
+ * @returns {string|null}
+ */
+export function currentOrgID() {
+	return new URLSearchParams(location.search).get('org')
+}
+
+/**
+ * Adds current organization to the API link (for downloads and other non-fetch requests)
+ * @param {string} path
+ */
+export function withOrgQuery(path) {
+	const orgID = currentOrgID()
+	if (!orgID) return path
+	return path + (path.includes('?') ? '&' : '?') + encodeKeyValue('org', orgID)
+}
+
 /**
  * @param {'GET'|'POST'|'DELETE'} method
  * @param {string} path
@@ -26,6 +44,10 @@ export async function apiReq(method, path, params) {
 	// подефолту шлём куки
 	if (!params.credentials) params.credentials = 'include'
 
+	// запросы со страницы организации делаем от её имени (кроме управления самими организациями)
+	const orgID = currentOrgID()
+	if (orgID && !path.startsWith('/api/orgs')) params.headers = { 'X-Org-Id': orgID, ...params.headers }
+
 	// если это GET-зпрос, добавляем params.data как query
 	if ('data' in params && (!params.method || params.method === 'GET')) {
 		let args = []
@@ -7,11 +7,17 @@ import { L } from 'src/i18n'
 
 import './auth.css'
 
+function tooManyAttemptsMsg() {
+	return L('too many attempts, try again later', 'ru', 'слишком много попыток, попробуйте позже')
+}
+
 /**
  * @class
  * @typedef AF_State
- * @prop {'register'|'login'} mode
+ * @prop {'register'|'login'|'reset'} mode
  * @prop {string|null} authError
+ * @prop {boolean} resetSent
+ * @prop {boolean} totpRequired
  * @extends {PureComponent<{}, AF_State>}
  */
 export class AuthForm extends PureComponent {
@@ -19,7 +25,7 @@ export class AuthForm extends PureComponent {
 		super()
 		bindHandlers(this)
 		/** @type {AF_State} */
-		this.state = { mode: 'login', authError: null }
+		this.state = { mode: 'login', authError: null, resetSent: false, totpRequired: false }
 	}
 
 	register(form) {
@@ -37,6 +43,7 @@ export class AuthForm extends PureComponent {
 					this.setState({
 						authError: L('username not available', 'ru', 'логин занят'),
 					})
+				else if (err.error === 'TOO_MANY_REQUESTS') this.setState({ authError: tooManyAttemptsMsg() })
 				else onError(err)
 			})
 	}
@@ -51,14 +58,33 @@ export class AuthForm extends PureComponent {
 					this.setState({
 						authError: L('wrong username or password', 'ru', 'неправильный логин или пароль'),
 					})
+				else if (err.error === 'TOTP_REQUIRED') this.setState({ totpRequired: true })
+				else if (err.error === 'TOO_MANY_REQUESTS') this.setState({ authError: tooManyAttemptsMsg() })
+				else if (err.error === 'WRONG_TOTP_CODE')
+					this.setState({
+						authError: L('wrong code', 'ru', 'неправильный код'),
+					})
 				else onError(err)
 			})
 	}
 
+	reset(form) {
+		this.setState({ authError: null })
+		apiReq('POST', '/api/password_reset', { data: { login: new FormData(form).get('login') } })
+			.then(res => {
+				this.setState({ resetSent: true })
+			})
+			.catch(onError)
+	}
+
 	onSubmit(e) {
 		e.preventDefault()
 		this[this.state.mode](e.target)
 	}
+	onResetModeClick(e) {
+		e.preventDefault()
+		this.setState({ mode: this.state.mode === 'reset' ? 'login' : 'reset', authError: null, resetSent: false })
+	}
 	onClick(e) {
 		if (e.target.name !== this.state.mode) {
 			e.preventDefault() //иначе на инпутах срабатывает валидация
@@ -75,7 +101,32 @@ export class AuthForm extends PureComponent {
 	 * @param {{}} props
 	 * @param {AF_State} state
 	 */
-	render(props, { mode, authError }) {
+	render(props, { mode, authError, resetSent, totpRequired }) {
+		if (mode === 'reset')
+			return html`
+				<form class="registration-form" onsubmit=${this.onSubmit}>
+					${resetSent
+						? html`<div>
+								${L(
+									'If this account has a verified email, a password reset link was sent to it.',
+									'ru',
+									'Если у аккаунта есть подтверждённая почта, на неё отправлена ссылка для сброса пароля.',
+								)}
+						  </div>`
+						: html`
+								<input
+									type="text"
+									name="login"
+									required
+									placeholder="${L('Username or email', 'ru', 'Логин или почта')}"
+								/>
+								<div class="buttons-wrap">
+									<button type="submit">${L('Reset password', 'ru', 'Сбросить пароль')}</button>
+								</div>
+						  `}
+					<a class="reset-link" href="#" onclick=${this.onResetModeClick}>${L('back', 'ru', 'назад')}</a>
+				</form>
+			`
 		const regButType = mode === 'register' ? 'submit' : 'button'
 		const logButType = mode === 'login' ? 'submit' : 'button'
 		return html`
@@ -88,6 +139,16 @@ export class AuthForm extends PureComponent {
 					required
 					placeholder="${L('Password', 'ru', 'Пароль')}"
 				/>
+				${totpRequired &&
+				html`
+					<input
+						type="text"
+						name="totpCode"
+						required
+						autocomplete="one-time-code"
+						placeholder="${L('Code from the app or recovery code', 'ru', 'Код из приложения или код восстановления')}"
+					/>
+				`}
 				<div class="buttons-wrap">
 					<button type=${regButType} name="register" onclick=${this.onClick}>
 						${L('Register', 'ru', 'Регистрация')}
@@ -96,6 +157,9 @@ export class AuthForm extends PureComponent {
 						${L('Login', 'ru', 'Вход')}
 					</button>
 				</div>
+				<a class="reset-link" href="#" onclick=${this.onResetModeClick}>
+					${L('forgot password?', 'ru', 'забыли пароль?')}
+				</a>
 			</form>
 		`
 	}
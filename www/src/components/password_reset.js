@@ -0,0 +1,53 @@
+import { useCallback, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { html } from 'src/utils/htm'
+
+import './auth.css'
+
+export function PasswordResetForm() {
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const token = location.hash.slice(1)
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const data = new FormData(e.target)
+			if (data.get('password') !== data.get('password2')) {
+				setError(L('passwords do not match', 'ru', 'пароли не совпадают'))
+				return
+			}
+			setError(null)
+			apiReq('POST', '/api/password_reset/finish', { data: { token, password: data.get('password') } })
+				.then(() => {
+					location.href = '/~'
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_TOKEN') {
+						setError(L('link is wrong or expired', 'ru', 'ссылка неправильная или устарела'))
+					} else onError(err)
+				})
+		},
+		[token],
+	)
+
+	if (!token) return html`<p>${L('Wrong link', 'ru', 'Неправильная ссылка')}</p>`
+
+	return html`
+		<form class="registration-form" onsubmit=${onSubmit}>
+			<div class="auth-error">${error}</div>
+			<input type="password" name="password" required placeholder=${L('New password', 'ru', 'Новый пароль')} />
+			<input
+				type="password"
+				name="password2"
+				required
+				placeholder=${L('New password again', 'ru', 'Новый пароль ещё раз')}
+			/>
+			<div class="buttons-wrap">
+				<button type="submit">${L('Set password', 'ru', 'Задать пароль')}</button>
+			</div>
+		</form>
+	`
+}
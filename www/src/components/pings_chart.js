@@ -23,22 +23,32 @@ import { html } from 'src/utils/htm'
 import './pings_chart.css'
 import { Fragment } from 'preact'
 
-/** @typedef {{id:string, address:string}} PingNode */
+/**
+ * @typedef {{
+ *   id: string,
+ *   address: string,
+ *   pingProto?: 'tcp'|'quic'|'both',
+ *   pingAllSats?: boolean,
+ *   lastSatPings?: {sat:string}[] | null,
+ * }} PingNode
+ */
 
 /**
  * Data mode, short of full.
  *
- * In both modes one value correspondes to one minute.
+ * Data consists of day blocks: uint32 day start stamp (seconds), uint16 resolution
+ * (minutes per value: 1, 5 or 15, depends on node ping interval) and 1440/resolution values.
  *
  * In short mode each value is 1-byte:
  *   ping_ms = (raw_byte_value+0.5) * 2000 / 256
- *   seconds_from_start_of_minute = 30
+ *   seconds_from_start_of_value_interval = resolution * 30
  *   raw_byte_value == 0 - no data
  *   raw_byte_value == 1 - error/timeout
+ *   raw_byte_value == 255 - check during maintenance window
  *
- * In full mode each each value is 2-bytes:
- *   ping_ms = raw_byte_value % 2000
- *   seconds_from_start_of_minute = floor(raw_byte_value / 2000) * 4
+ * In full mode each each value is 2-bytes (int16, negative during maintenance windows):
+ *   ping_ms = abs(raw_value) % 2000
+ *   seconds_from_start_of_value_interval = floor(raw_byte_value / 2000) * 4 * resolution
  *   ping_ms == 0 - no data (here also raw_byte_value == 0)
  *   ping_ms == 1 - error/timeout
  */
@@ -50,7 +60,8 @@ const PING_DATA_SHORT_MODE = true
  * @param {Date} endDate
  */
 function processPingsData(buf, startDate, endDate) {
-	let pings = PING_DATA_SHORT_MODE ? new Uint8Array(buf) : new Uint16Array(buf)
+	let data = new DataView(buf)
+	let valueSize = PING_DATA_SHORT_MODE ? 1 : 2
 
 	let startStamp = Math.floor(startDate.getTime())
 	let endStamp = Math.floor(endDate.getTime() + DAY_DURATION)
@@ -59,23 +70,33 @@ function processPingsData(buf, startDate, endDate) {
 	let flatPings = new Uint16Array(len)
 	let reductionN = 30
 	let reducedPings = new Uint16Array(Math.floor(len / reductionN))
-
-	// flatting
-	for (let j = 0; j < pings.length; j += 1440 + (PING_DATA_SHORT_MODE ? 4 : 2)) {
-		let stamp = PING_DATA_SHORT_MODE
-			? (pings[j] + (pings[j + 1] << 8) + (pings[j + 2] << 16) + (pings[j + 3] << 24)) * 1000
-			: (pings[j] + (pings[j + 1] << 16)) * 1000
+	// PING_OK for minutes of maintenance windows (so it can be drawn with drawPingRegions)
+	let maintenance = new Uint16Array(len)
+
+	// flatting (each value is repeated for every minute of its interval)
+	for (let pos = 0; pos + 6 <= data.byteLength; ) {
+		let stamp = data.getUint32(pos, true) * 1000
+		let resolution = data.getUint16(pos + 4, true)
+		let count = Math.floor(1440 / resolution)
+		pos += 6
 		let offset = Math.floor((stamp - startStamp) / 60 / 1000)
-		let iFrom = offset < 0 ? -offset : 0
-		let iTo = offset + 1440 > flatPings.length ? flatPings.length - offset : 1440
-		for (let i = iFrom; i < iTo; i++) {
+		for (let i = 0; i < count; i++) {
+			let val = PING_DATA_SHORT_MODE ? data.getUint8(pos + i) : data.getInt16(pos + i * 2, true)
+			let isMaintenance = PING_DATA_SHORT_MODE ? val === 255 : val < 0
 			if (PING_DATA_SHORT_MODE) {
-				let val = pings[j + 4 + i]
-				flatPings[offset + i] = val <= 1 ? val : 7 * 2000 + ((pings[j + 4 + i] + 0.5) * 2000) / 256
+				if (isMaintenance) val = 0
+				else if (val > 1) val = 7 * 2000 + ((val + 0.5) * 2000) / 256
 			} else {
-				flatPings[offset + i] = pings[j + 2 + i]
+				val = Math.abs(val)
+			}
+			let mFrom = Math.max(0, offset + i * resolution)
+			let mTo = Math.min(flatPings.length, offset + (i + 1) * resolution)
+			for (let m = mFrom; m < mTo; m++) {
+				flatPings[m] = val
+				if (isMaintenance) maintenance[m] = PING_OK
 			}
 		}
+		pos += count * valueSize
 	}
 
 	// reducing
@@ -97,6 +118,7 @@ function processPingsData(buf, startDate, endDate) {
 		pings: flatPings,
 		reducedPings,
 		reducedPingsN: reductionN,
+		maintenance,
 	}
 }
 
@@ -111,6 +133,9 @@ function cutOffDefaultSatPort(address) {
  * @typedef PC_Props
  * @prop {PingNode} node
  * @prop {'my'|'sat'} group
+ * @prop {string} [sat] vantage point (satellite label), only for nodes pinged from all sats
+ * @prop {'quic'} [proto] separate QUIC history, only for nodes checked by both TCP and QUIC
+ * @prop {string} [pingsPath] custom pings API path (for nodes on shared pages)
  * @prop {boolean} isPending
  * @typedef PC_State
  * @prop {Date} startDate
@@ -118,6 +143,7 @@ function cutOffDefaultSatPort(address) {
  * @prop {Uint16Array|null} pings
  * @prop {Uint16Array|null} reducedPings
  * @prop {number} reducedPingsN
+ * @prop {Uint16Array|null} maintenance
  * @prop {{isShown:boolean, cusorX:number, boxX:number, boxWidth:number, pos:number, isTouch:boolean}} zoom
  * @extends {PureComponent<PC_Props, PC_State>}
  */
@@ -152,7 +178,7 @@ class PingsChart extends PureComponent {
 
 		let watch = watchHashInterval((startDate, endDate) => {
 			let onSet = () => this.loadData()
-			this.setState({ ...this.state, startDate, endDate, pings: null, reducedPings: null }, onSet)
+			this.setState({ ...this.state, startDate, endDate, pings: null, reducedPings: null, maintenance: null }, onSet)
 		})
 		this.stopWatchingHashInterval = watch.off
 
@@ -163,6 +189,7 @@ class PingsChart extends PureComponent {
 			pings: null,
 			reducedPings: null,
 			reducedPingsN: 0,
+			maintenance: null,
 			zoom: { isShown: false, cusorX: 0, boxX: 0, boxWidth: 0, pos: 0, isTouch: false },
 		}
 	}
@@ -170,9 +197,12 @@ class PingsChart extends PureComponent {
 	loadData() {
 		if (this.props.isPending) return
 		let { startDateStr: start, endDateStr: end } = toISODateStringInterval(this.state)
-		apiReq('GET', `/api/user_nodes/${this.props.group}/${this.props.node.id}/pings`, {
-			data: { start_date: start, end_date: end },
-		})
+		/** @type {Record<string, string>} */
+		let data = { start_date: start, end_date: end }
+		if (this.props.sat) data.sat = this.props.sat
+		if (this.props.proto) data.proto = this.props.proto
+		let path = this.props.pingsPath || `/api/user_nodes/${this.props.group}/${this.props.node.id}/pings`
+		apiReq('GET', path, { data })
 			.then(r => r.arrayBuffer())
 			.then(buf => {
 				let { startDate, endDate } = this.state
@@ -204,7 +234,7 @@ class PingsChart extends PureComponent {
 
 	onRedraw() {
 		let { canvasExt, rect, view } = this
-		let { pings, reducedPings, reducedPingsN, startDate, endDate } = this.state
+		let { pings, reducedPings, reducedPingsN, maintenance, startDate, endDate } = this.state
 		let { rc } = canvasExt
 
 		if (!canvasExt.created() || rc === null) return
@@ -236,6 +266,9 @@ class PingsChart extends PureComponent {
 
 			drawPingRegions(rc, rect, view, pings, +startDate, 60 * 1000, PING_ERR, 'red', 0.5)
 		}
+		if (maintenance !== null) {
+			drawPingRegions(rc, rect, view, maintenance, +startDate, 60 * 1000, PING_OK, 'rgba(70,130,180,0.5)', 0.5)
+		}
 
 		drawMonthDays(canvasExt, rect, view, { hLineColor: 'rgba(0,0,0,0.1)' })
 
@@ -256,7 +289,7 @@ class PingsChart extends PureComponent {
 	onZoomRedraw() {
 		let { canvasZoomExt: canvasExt, zoomView: view } = this
 		let { rect: mainRect, zoomRect: rect, zoomLabelsRect: labelsRect } = this
-		let { zoom, pings, startDate, endDate } = this.state
+		let { zoom, pings, maintenance, startDate, endDate } = this.state
 		let { rc } = canvasExt
 
 		if (!canvasExt.created() || rc === null) return
@@ -292,6 +325,9 @@ class PingsChart extends PureComponent {
 			drawPingLine(rc, rect, view, pings, +startDate, 60 * 1000, 'rgba(0,0,0,0.5)')
 			drawPingRegions(rc, rect, view, pings, +startDate, 60 * 1000, 1, 'red', 0.5)
 		}
+		if (maintenance !== null) {
+			drawPingRegions(rc, rect, view, maintenance, +startDate, 60 * 1000, PING_OK, 'rgba(70,130,180,0.5)', 0.5)
+		}
 
 		rc.restore()
 
@@ -323,7 +359,7 @@ class PingsChart extends PureComponent {
 	 * @param {PC_Props} props
 	 * @param {PC_State} state
 	 */
-	render({ node, group }, { zoom }) {
+	render({ node, group, sat, proto }, { zoom }) {
 		let zoomElem =
 			zoom.isShown &&
 			html`
@@ -334,8 +370,10 @@ class PingsChart extends PureComponent {
 				></canvas>
 			`
 		let legend = group === 'sat' ? cutOffDefaultSatPort(node.address) : shortNodeID(node.id)
+		if (node.pingProto === 'quic' || proto === 'quic') legend += ' · QUIC'
+		if (sat) legend += ' · ' + sat
 		return html`
-			<div class="chart pings-chart" ref=${this.hoverCtl.setRef}>
+			<div class="chart pings-chart ${sat || proto ? 'vantage' : ''}" ref=${this.hoverCtl.setRef}>
 				<canvas class="main-canvas" ref=${this.canvasExt.setRef}></canvas>
 				<div class="legend">${legend}</div>
 				${zoomElem}
@@ -345,8 +383,29 @@ class PingsChart extends PureComponent {
 }
 
 export class PingsChartsList extends PureComponent {
-	render({ nodes, group }, state) {
-		return nodes.map(n => html` <${PingsChart} group=${group} node=${n} isPending=${false} /> `)
+	render({ nodes, group, pingsPathFunc }, state) {
+		return nodes.map(
+			n => html`
+				<${PingsChart}
+					group=${group}
+					node=${n}
+					pingsPath=${pingsPathFunc && pingsPathFunc(n)}
+					isPending=${false}
+				/>
+				${n.pingProto === 'both' &&
+				html`<${PingsChart}
+					group=${group}
+					node=${n}
+					pingsPath=${pingsPathFunc && pingsPathFunc(n)}
+					proto="quic"
+					isPending=${false}
+				/>`}
+				${n.pingAllSats &&
+				(n.lastSatPings || []).map(
+					p => html`<${PingsChart} group=${group} node=${n} sat=${p.sat} isPending=${false} />`,
+				)}
+			`,
+		)
 	}
 }
 
@@ -0,0 +1,102 @@
+import { getJSONContent } from 'src/utils/elems'
+import { L } from 'src/i18n'
+import { html } from 'src/utils/htm'
+import { PingsChartsList } from './pings_chart'
+
+import './user_nodes.css'
+import './shared_dashboard.css'
+
+/**
+ * @typedef {{
+ *   ref: number,
+ *   id: string,
+ *   address: string,
+ *   pingMode: 'off'|'dial'|'ping',
+ *   pingProto: 'tcp'|'quic'|'both',
+ *   pingInterval: number,
+ *   lastPingedAt: Date,
+ *   lastPing: number,
+ *   lastPingWasOk: boolean,
+ *   lastUpAt: Date,
+ *   lastQuicPing: number,
+ *   lastQuicPingWasOk: boolean,
+ *   inMaintenance: boolean,
+ *   isFlapping: boolean,
+ * }} SharedNode
+ */
+
+/**
+ * @param {SharedNode} node
+ * @param {Date} updateTime
+ */
+function nodeStatus(node, updateTime) {
+	const lastPingedAgo = +updateTime - +node.lastPingedAt
+	if (node.pingMode === 'off' || lastPingedAgo > (node.pingInterval + 4) * 60 * 1000) return 'unknown'
+	if (node.inMaintenance) return 'maintenance'
+	if (node.isFlapping) return 'flapping'
+	return node.lastPingWasOk ? 'ok' : 'error'
+}
+
+/** @param {{node:SharedNode, updateTime:Date}} props */
+function SharedNodeItem({ node, updateTime }) {
+	const status = nodeStatus(node, updateTime)
+	const statusLabel = {
+		unknown: L('not checked', 'ru', 'не проверяется'),
+		maintenance: L('maintenance', 'ru', 'обслуживание'),
+		flapping: L('flapping', 'ru', 'нестабильна'),
+		ok: L('online', 'ru', 'онлайн'),
+		error: L('offline', 'ru', 'офлайн'),
+	}[status]
+	return html`
+		<tr class="node status-${status}">
+			<td><div class="node-status"></div></td>
+			<td><code>${node.id}</code></td>
+			<td>${node.address}</td>
+			<td>${statusLabel}</td>
+			<td>
+				${status === 'ok' && node.lastPing > 0 && html`${node.lastPing} ${L('ms', 'ru', 'мс')}`}
+				${status === 'error' &&
+				+node.lastUpAt > 0 &&
+				html`<span class="dim">${L('last up', 'ru', 'была онлайн')}</span> ${node.lastUpAt.toLocaleString()}`}
+			</td>
+		</tr>
+	`
+}
+
+/** @param {SharedNode} node */
+function convertFromJSON(node) {
+	node.lastPingedAt = new Date(node.lastPingedAt)
+	node.lastUpAt = new Date(node.lastUpAt)
+	return node
+}
+
+export function SharedDashboard() {
+	/** @type {{share:{key:string, groupName:string}, nodes:SharedNode[], updateTime:string}} */
+	const data = getJSONContent('shared_nodes_data')
+	const nodes = data.nodes.map(convertFromJSON)
+	const updateTime = new Date(data.updateTime)
+	const pingsPathFunc = (/**@type {SharedNode}*/ n) =>
+		`/api/shares/${encodeURIComponent(data.share.key)}/nodes/${n.ref}/pings`
+
+	return html`
+		<div class="shared-dashboard">
+			<div class="user-nodes-list">
+				${nodes.length === 0 && L('No nodes in this group', 'ru', 'В группе нет нод')}
+				${nodes.length > 0 &&
+				html`
+					<table class="user-nodes-table">
+						<tbody>
+							${nodes.map(n => html`<${SharedNodeItem} key=${n.ref} node=${n} updateTime=${updateTime} />`)}
+						</tbody>
+					</table>
+				`}
+			</div>
+			<p class="dim">
+				${L('Updated at', 'ru', 'Обновлено')} ${updateTime.toLocaleString()}${' · '}
+				${nodes.filter(n => nodeStatus(n, updateTime) === 'ok').length}/${nodes.length}${' '}
+				${L('online', 'ru', 'онлайн')}
+			</p>
+			<${PingsChartsList} nodes=${nodes} group="my" pingsPathFunc=${pingsPathFunc} />
+		</div>
+	`
+}
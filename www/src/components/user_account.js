@@ -0,0 +1,347 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { html } from 'src/utils/htm'
+
+import './user_account.css'
+
+/**
+ * Message for password confirmation errors (null for other errors)
+ * @param {{error?: string}} err
+ */
+function credentialsErrorMsg(err) {
+	if (err.error === 'WRONG_PASSWORD') return L('Wrong password', 'ru', 'Неправильный пароль')
+	if (err.error === 'WRONG_TOTP_CODE') return L('Wrong code', 'ru', 'Неправильный код')
+	if (err.error === 'TOO_MANY_REQUESTS')
+		return L('Too many attempts, try again later', 'ru', 'Слишком много попыток, попробуйте позже')
+	return null
+}
+
+const totpCodeInput = () => html`
+	<input
+		name="totpCode"
+		required
+		autocomplete="one-time-code"
+		placeholder=${L('Code from the app or recovery code', 'ru', 'Код из приложения или код восстановления')}
+	/>
+`
+
+function ChangePasswordForm() {
+	const [message, setMessage] = useState(/**@type {{text:string, isError:boolean}|null}*/ (null))
+	const [totpRequired, setTotpRequired] = useState(false)
+
+	const onSubmit = useCallback(e => {
+		e.preventDefault()
+		const form = e.target
+		const data = new FormData(form)
+		if (data.get('newPassword') !== data.get('newPassword2')) {
+			setMessage({ text: L('Passwords do not match', 'ru', 'Пароли не совпадают'), isError: true })
+			return
+		}
+		setMessage(null)
+		apiReq('POST', '/api/user/password', {
+			data: {
+				oldPassword: data.get('oldPassword'),
+				newPassword: data.get('newPassword'),
+				totpCode: data.get('totpCode') ?? '',
+			},
+		})
+			.then(() => {
+				form.reset()
+				setTotpRequired(false)
+				setMessage({ text: L('Password changed', 'ru', 'Пароль изменён'), isError: false })
+			})
+			.catch(err => {
+				if (err.error === 'WRONG_PASSWORD') {
+					setMessage({ text: L('Wrong current password', 'ru', 'Неправильный текущий пароль'), isError: true })
+				} else if (err.error === 'TOTP_REQUIRED') {
+					setTotpRequired(true)
+				} else {
+					const text = credentialsErrorMsg(err)
+					if (text) setMessage({ text, isError: true })
+					else onError(err)
+				}
+			})
+	}, [])
+
+	return html`
+		<form class="user-account-form" onsubmit=${onSubmit}>
+			<input type="password" name="oldPassword" required placeholder=${L('Current password', 'ru', 'Текущий пароль')} />
+			${' '}
+			<input type="password" name="newPassword" required placeholder=${L('New password', 'ru', 'Новый пароль')} />
+			${' '}
+			<input type="password" name="newPassword2" required placeholder=${L('Once more', 'ru', 'Ещё раз')} />
+			${' '}
+			${totpRequired && html`${totpCodeInput()}${' '}`}
+			<button>${L('Change password', 'ru', 'Сменить пароль')}</button>
+			${message && html`<div class=${message.isError ? 'warn' : 'dim'}>${message.text}</div>`}
+		</form>
+	`
+}
+
+function DeleteAccountForm() {
+	const [isShown, setIsShown] = useState(false)
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [totpRequired, setTotpRequired] = useState(false)
+
+	const onSubmit = useCallback(e => {
+		e.preventDefault()
+		const data = new FormData(e.target)
+		setError(null)
+		apiReq('DELETE', '/api/user', {
+			data: {
+				password: data.get('password'),
+				totpCode: data.get('totpCode') ?? '',
+				confirmUsername: data.get('confirmUsername'),
+			},
+		})
+			.then(() => {
+				location.href = '/'
+			})
+			.catch(err => {
+				const credentialsError = credentialsErrorMsg(err)
+				if (credentialsError) {
+					setError(credentialsError)
+				} else if (err.error === 'TOTP_REQUIRED') {
+					setTotpRequired(true)
+				} else if (err.error === 'WRONG_CONFIRMATION') {
+					setError(L('Username does not match', 'ru', 'Логин не совпадает'))
+				} else if (err.error === 'LAST_ORG_OWNER') {
+					setError(
+						L(
+							'You are the only owner of an organization with other members, pass the ownership first',
+							'ru',
+							'Вы единственный владелец организации с другими участниками, сначала передайте владение',
+						),
+					)
+				} else onError(err)
+			})
+	}, [])
+
+	if (!isShown)
+		return html`
+			<button type="button" class="link-button" onclick=${() => setIsShown(true)}>
+				${L('Delete account…', 'ru', 'Удалить аккаунт…')}
+			</button>
+		`
+
+	return html`
+		<form class="user-account-form" onsubmit=${onSubmit}>
+			<p class="warn">
+				${L(
+					'All your nodes, their history, texts and settings will be deleted permanently. ' +
+						'Type your username and password to confirm.',
+					'ru',
+					'Все ваши ноды, их история, тексты и настройки будут удалены безвозвратно. ' +
+						'Для подтверждения введите логин и пароль.',
+				)}
+			</p>
+			<input name="confirmUsername" required autocomplete="off" placeholder=${L('Username', 'ru', 'Логин')} />
+			${' '}
+			<input type="password" name="password" required placeholder=${L('Password', 'ru', 'Пароль')} />
+			${' '}
+			${totpRequired && html`${totpCodeInput()}${' '}`}
+			<button>${L('Delete account', 'ru', 'Удалить аккаунт')}</button>
+			${' '}
+			<button type="button" onclick=${() => setIsShown(false)}>${L('Cancel', 'ru', 'Отмена')}</button>
+			${error && html`<div class="warn">${error}</div>`}
+		</form>
+	`
+}
+
+/** @typedef {{enabled: boolean, recoveryCodesLeft: number}} TOTPStatus */
+/** @typedef {{secret: string, url: string, qrCode: string}} TOTPSetup */
+
+function TwoFactorAuth() {
+	const [status, setStatus] = useState(/**@type {TOTPStatus|null}*/ (null))
+	const [setup, setSetup] = useState(/**@type {TOTPSetup|null}*/ (null))
+	const [recoveryCodes, setRecoveryCodes] = useState(/**@type {string[]|null}*/ (null))
+	const [code, setCode] = useState('')
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+
+	const reloadStatus = useCallback(() => {
+		apiReq('GET', '/api/user/totp').then(setStatus).catch(onError)
+	}, [])
+	useEffect(reloadStatus, [])
+
+	const onCodeError = useCallback(err => {
+		if (err.error === 'WRONG_TOTP_CODE') {
+			setError(L('Wrong code', 'ru', 'Неправильный код'))
+		} else onError(err)
+	}, [])
+
+	const onCodeInput = useCallback(e => setCode(e.target.value), [])
+	const onSetupClick = useCallback(() => {
+		setError(null)
+		setRecoveryCodes(null)
+		apiReq('POST', '/api/user/totp/setup').then(setSetup).catch(onError)
+	}, [])
+	/** @param {'enable'|'recovery_codes'|'disable'} action */
+	const sendCode = action => {
+		setError(null)
+		apiReq('POST', '/api/user/totp/' + action, { data: { code } })
+			.then(res => {
+				setCode('')
+				setSetup(null)
+				setRecoveryCodes(res.recoveryCodes ?? null)
+				reloadStatus()
+			})
+			.catch(onCodeError)
+	}
+	const onEnableSubmit = e => {
+		e.preventDefault()
+		sendCode('enable')
+	}
+
+	if (!status) return null
+
+	const codeInput = html`
+		<input
+			name="code"
+			required
+			autocomplete="one-time-code"
+			value=${code}
+			oninput=${onCodeInput}
+			placeholder=${L('Code from the app', 'ru', 'Код из приложения')}
+		/>
+	`
+
+	return html`
+		<div class="user-totp">
+			<h4>${L('Two-factor authentication', 'ru', 'Двухфакторная аутентификация')}</h4>
+			${recoveryCodes &&
+			html`
+				<p>
+					${L(
+						'Recovery codes (each can be used once instead of an app code). Save them now, they will not be shown again:',
+						'ru',
+						'Коды восстановления (каждый можно один раз использовать вместо кода из приложения). Сохраните их сейчас, больше они показаны не будут:',
+					)}
+				</p>
+				<pre class="user-totp-recovery-codes">${recoveryCodes.join('\n')}</pre>
+			`}
+			${status.enabled
+				? html`
+						<p>
+							${L('Enabled', 'ru', 'Включена')}.
+							${L('Recovery codes left', 'ru', 'Осталось кодов восстановления')}: ${status.recoveryCodesLeft}
+						</p>
+						<form class="user-account-form" onsubmit=${e => e.preventDefault()}>
+							${codeInput} ${' '}
+							<button type="button" onclick=${() => sendCode('recovery_codes')}>
+								${L('New recovery codes', 'ru', 'Новые коды восстановления')}
+							</button>
+							${' '}
+							<button type="button" onclick=${() => sendCode('disable')}>
+								${L('Disable', 'ru', 'Отключить')}
+							</button>
+						</form>
+				  `
+				: setup
+				? html`
+						<p>
+							${L(
+								'Scan the QR code with an authenticator app (or enter the secret manually) and type the code from the app:',
+								'ru',
+								'Отсканируйте QR-код приложением-аутентификатором (или введите секрет вручную) и введите код из приложения:',
+							)}
+						</p>
+						<img class="user-totp-qr" src=${setup.qrCode} width="192" height="192" alt=${setup.url} />
+						<p><code>${setup.secret}</code></p>
+						<form class="user-account-form" onsubmit=${onEnableSubmit}>
+							${codeInput} ${' '}
+							<button>${L('Enable', 'ru', 'Включить')}</button>
+							${' '}
+							<button type="button" onclick=${() => setSetup(null)}>${L('Cancel', 'ru', 'Отмена')}</button>
+						</form>
+				  `
+				: html`
+						<p>
+							<button type="button" onclick=${onSetupClick}>
+								${L('Enable two-factor authentication', 'ru', 'Включить двухфакторную аутентификацию')}
+							</button>
+						</p>
+				  `}
+			${error && html`<div class="warn">${error}</div>`}
+		</div>
+	`
+}
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   userAgent: string,
+ *   ip: string,
+ *   createdAt: string,
+ *   lastSeenAt: string,
+ *   isCurrent: boolean,
+ * }} UserSession
+ */
+
+function UserSessions() {
+	const [sessions, setSessions] = useState(/**@type {UserSession[]|null}*/ (null))
+
+	useEffect(() => {
+		apiReq('GET', '/api/user_sessions').then(setSessions).catch(onError)
+	}, [])
+
+	const delSessions = useCallback((/**@type {Record<string, unknown>}*/ data) => {
+		apiReq('DELETE', '/api/user_sessions', { data }).then(setSessions).catch(onError)
+	}, [])
+	const onLogoutClick = useCallback(() => {
+		apiReq('POST', '/api/logout')
+			.then(() => {
+				location.href = '/'
+			})
+			.catch(onError)
+	}, [])
+
+	if (!sessions) return null
+
+	return html`
+		<table class="user-sessions">
+			${sessions.map(
+				s => html`
+					<tr key=${s.id} class=${s.isCurrent ? 'current' : ''}>
+						<td class="user-agent" title=${s.userAgent}>${s.userAgent || '—'}</td>
+						<td>${s.ip}</td>
+						<td>${new Date(s.lastSeenAt).toLocaleString()}</td>
+						<td>
+							${s.isCurrent
+								? html`<span class="dim">${L('this device', 'ru', 'это устройство')}</span>`
+								: html`
+										<button type="button" onclick=${() => delSessions({ id: s.id })}>
+											${L('Log out', 'ru', 'Выйти')}
+										</button>
+								  `}
+						</td>
+					</tr>
+				`,
+			)}
+		</table>
+		<p>
+			<button type="button" onclick=${onLogoutClick}>${L('Log out', 'ru', 'Выйти')}</button>
+			${sessions.length > 1 &&
+			html`
+				${' '}
+				<button type="button" onclick=${() => delSessions({ allOthers: true })}>
+					${L('Log out all other sessions', 'ru', 'Выйти на остальных устройствах')}
+				</button>
+			`}
+		</p>
+	`
+}
+
+export function UserAccount() {
+	return html`
+		<div class="user-account">
+			<h3>${L('Account', 'ru', 'Аккаунт')}</h3>
+			<${UserSessions} />
+			<${ChangePasswordForm} />
+			<${TwoFactorAuth} />
+			<${DeleteAccountForm} />
+		</div>
+	`
+}
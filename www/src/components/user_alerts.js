@@ -0,0 +1,188 @@
+import { useCallback, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { getJSONContent } from 'src/utils/elems'
+import { html } from 'src/utils/htm'
+
+import './user_alerts.css'
+
+/**
+ * @typedef {{
+ *   failsCount: number,
+ *   downMinutes: number,
+ *   lang: string,
+ *   tgLinkCode: string,
+ *   tgLinked: boolean,
+ *   emailNodeEvents: boolean,
+ *   emailVersions: boolean,
+ *   email: string,
+ *   pendingEmail: string,
+ * }} AlertSettings
+ */
+
+/** @returns {{settings:AlertSettings, tgBotUsername:string}|null} */
+function loadAlertsData() {
+	try {
+		return getJSONContent('user_alerts_data')
+	} catch (ex) {
+		return null
+	}
+}
+
+/** @param {{settings:AlertSettings, tgBotUsername:string}} props */
+function TGLinkInfo({ settings, tgBotUsername }) {
+	const cmd = `/link ${settings.tgLinkCode}`
+	return html`
+		<p>
+			${settings.tgLinked
+				? html`<span class="ok">${L('Telegram chat is linked.', 'ru', 'Телеграм-чат привязан.')}</span> `
+				: L('Telegram chat is not linked. ', 'ru', 'Телеграм-чат не привязан. ')}
+			${L('To link a chat send ', 'ru', 'Чтобы привязать чат, отправьте ')}
+			<code>${cmd}</code>
+			${tgBotUsername
+				? html`
+						${L(' to ', 'ru', ' боту ')}
+						<a href="https://t.me/${tgBotUsername}?start=${settings.tgLinkCode}">@${tgBotUsername}</a>
+				  `
+				: L(' to the bot', 'ru', ' боту')}
+			${L(' (in a group chat — as an admin). ', 'ru', ' (в группе — от имени админа). ')}
+			${L('To unlink send ', 'ru', 'Чтобы отвязать, отправьте ')}<code>/unlink</code>.
+		</p>
+	`
+}
+
+/** @param {{settings:AlertSettings, onChange:(settings:AlertSettings) => unknown}} props */
+function EmailInfo({ settings, onChange }) {
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [isSaving, setIsSaving] = useState(false)
+
+	const onRequestError = useCallback(err => {
+		const msg = {
+			WRONG_EMAIL: L('Wrong email', 'ru', 'Неправильная почта'),
+			TOO_FREQUENT: L('Too frequent, try again in a minute', 'ru', 'Слишком часто, попробуйте через минуту'),
+			WRONG_CODE: L('Wrong code', 'ru', 'Неправильный код'),
+			VERIFICATION_NOT_FOUND: L('Code expired, request a new one', 'ru', 'Код устарел, запросите новый'),
+			EMAIL_EXISTS: L('Email is used by another account', 'ru', 'Почта используется другим аккаунтом'),
+		}[err.error]
+		if (msg) setError(msg)
+		else onError(err)
+	}, [])
+
+	const req = useCallback(
+		(/**@type {'POST'|'DELETE'}*/ method, /**@type {string}*/ path, data) => {
+			setError(null)
+			setIsSaving(true)
+			return apiReq(method, path, { data })
+				.then(onChange)
+				.catch(onRequestError)
+				.finally(() => setIsSaving(false))
+		},
+		[onChange, onRequestError],
+	)
+
+	const onEmailSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			req('POST', '/api/user_email', { email: new FormData(e.target).get('email') + '' })
+		},
+		[req],
+	)
+	const onCodeSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			req('POST', '/api/user_email/verify', { code: new FormData(e.target).get('code') + '' })
+		},
+		[req],
+	)
+	const onRemoveClick = useCallback(() => {
+		if (confirm(L('Remove email?', 'ru', 'Удалить почту?'))) req('DELETE', '/api/user_email', {})
+	}, [req])
+
+	return html`
+		<div class="user-alerts-email ${isSaving ? 'loading' : ''}">
+			${settings.email &&
+			html`
+				<p>
+					${L('Email: ', 'ru', 'Почта: ')}<span class="ok">${settings.email}</span>${' '}
+					<button type="button" onclick=${onRemoveClick}>${L('Remove', 'ru', 'Удалить')}</button>
+				</p>
+			`}
+			${settings.pendingEmail &&
+			html`
+				<form onsubmit=${onCodeSubmit}>
+					${L('Code sent to ', 'ru', 'Код отправлен на ')}${settings.pendingEmail}${': '}
+					<input type="text" name="code" inputmode="numeric" autocomplete="one-time-code" required />${' '}
+					<button>${L('Verify', 'ru', 'Подтвердить')}</button>
+				</form>
+			`}
+			<form onsubmit=${onEmailSubmit}>
+				<input type="email" name="email" placeholder="email@example.com" required />${' '}
+				<button>
+					${settings.email
+						? L('Change email', 'ru', 'Сменить почту')
+						: L('Add email', 'ru', 'Добавить почту')}
+				</button>
+			</form>
+			${error && html`<div class="warn">${error}</div>`}
+		</div>
+	`
+}
+
+export function UserAlerts() {
+	const [data] = useState(loadAlertsData)
+	const [settings, setSettings] = useState(data?.settings ?? null)
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [isSaving, setIsSaving] = useState(false)
+
+	const onSubmit = useCallback(e => {
+		e.preventDefault()
+		const form = new FormData(e.target)
+		const failsCount = parseInt(form.get('failsCount') + '', 10)
+		const downMinutes = parseInt(form.get('downMinutes') + '', 10)
+		const emailNodeEvents = form.get('emailNodeEvents') === 'on'
+		const emailVersions = form.get('emailVersions') === 'on'
+		setError(null)
+		setIsSaving(true)
+		apiReq('POST', '/api/user_alerts', { data: { failsCount, downMinutes, emailNodeEvents, emailVersions } })
+			.then(setSettings)
+			.catch(err => {
+				if (err.error === 'WRONG_FAILS_COUNT' || err.error === 'WRONG_DOWN_MINUTES') {
+					setError(L('Wrong value', 'ru', 'Неправильное значение'))
+				} else onError(err)
+			})
+			.finally(() => setIsSaving(false))
+	}, [])
+
+	if (!data || !settings) return null
+
+	return html`
+		<div class="user-alerts">
+			<h3>${L('Alerts', 'ru', 'Уведомления')}</h3>
+			<form class="user-alerts-form ${isSaving ? 'loading' : ''}" onsubmit=${onSubmit}>
+				${L('Node is down after ', 'ru', 'Нода считается недоступной после ')}
+				<input type="number" name="failsCount" min="1" max="1440" value=${settings.failsCount} />
+				${L(' failed pings in a row and at least ', 'ru', ' неудачных пингов подряд и минимум ')}
+				<input type="number" name="downMinutes" min="0" max="1440" value=${settings.downMinutes} />
+				${L(' minutes of downtime', 'ru', ' минут простоя')}
+				<div>
+					<label>
+						<input type="checkbox" name="emailNodeEvents" checked=${settings.emailNodeEvents} />
+						${L(' email node outages', 'ru', ' присылать на почту недоступность нод')}
+					</label>
+				</div>
+				<div>
+					<label>
+						<input type="checkbox" name="emailVersions" checked=${settings.emailVersions} />
+						${L(' email new storagenode versions', 'ru', ' присылать на почту новые версии ноды')}
+					</label>
+				</div>
+				<button>${L('Save', 'ru', 'Сохранить')}</button>
+				${error && html`<div class="warn">${error}</div>`}
+			</form>
+			<${TGLinkInfo} settings=${settings} tgBotUsername=${data.tgBotUsername} />
+			<${EmailInfo} settings=${settings} onChange=${setSettings} />
+		</div>
+	`
+}
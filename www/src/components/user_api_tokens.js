@@ -0,0 +1,144 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { html } from 'src/utils/htm'
+
+import './user_api_tokens.css'
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   name: string,
+ *   readOnly: boolean,
+ *   createdAt: string,
+ *   lastUsedAt: string,
+ * }} APIToken
+ */
+
+/** @param {string} dateStr */
+function formatDate(dateStr) {
+	const d = new Date(dateStr)
+	// zero Go time
+	if (d.getFullYear() <= 1) return '—'
+	return d.toLocaleDateString() + ' ' + d.toLocaleTimeString()
+}
+
+/** @param {{token:APIToken, onRemove:(token:APIToken) => unknown}} props */
+function TokenRow({ token, onRemove }) {
+	const onRemoveClick = useCallback(() => {
+		if (confirm(L(`Revoke token "${token.name}"?`, 'ru', `Отозвать токен «${token.name}»?`))) onRemove(token)
+	}, [token, onRemove])
+	return html`
+		<tr>
+			<td>${token.name}</td>
+			<td>${token.readOnly ? L('read only', 'ru', 'только чтение') : L('full', 'ru', 'полный')}</td>
+			<td>${formatDate(token.createdAt)}</td>
+			<td>${formatDate(token.lastUsedAt)}</td>
+			<td>
+				<button type="button" onclick=${onRemoveClick}>${L('Revoke', 'ru', 'Отозвать')}</button>
+			</td>
+		</tr>
+	`
+}
+
+export function UserAPITokens() {
+	const [tokens, setTokens] = useState(/**@type {APIToken[]|null}*/ (null))
+	const [newToken, setNewToken] = useState(/**@type {string|null}*/ (null))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [isSaving, setIsSaving] = useState(false)
+
+	const reload = useCallback(() => {
+		apiReq('GET', '/api/user_api_tokens').then(setTokens).catch(onError)
+	}, [])
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const data = new FormData(form)
+			const name = data.get('name') + ''
+			const readOnly = data.get('readOnly') === 'on'
+			setError(null)
+			setIsSaving(true)
+			apiReq('POST', '/api/user_api_tokens', { data: { name, readOnly } })
+				.then(res => {
+					setNewToken(res.token)
+					form.reset()
+					reload()
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_NAME') {
+						setError(L('Wrong name', 'ru', 'Неправильное название'))
+					} else if (err.error === 'TOO_MANY_TOKENS') {
+						setError(L('Too many tokens', 'ru', 'Слишком много токенов'))
+					} else onError(err)
+				})
+				.finally(() => setIsSaving(false))
+		},
+		[reload],
+	)
+
+	const onRemove = useCallback(
+		(/**@type {APIToken}*/ token) => {
+			apiReq('DELETE', '/api/user_api_tokens', { data: { id: token.id } })
+				.then(reload)
+				.catch(onError)
+		},
+		[reload],
+	)
+
+	useEffect(reload, [reload])
+
+	if (!tokens) return null
+
+	return html`
+		<div class="user-api-tokens">
+			<h3>${L('API tokens', 'ru', 'API-токены')}</h3>
+			<p class="dim">
+				${L('Send token in header ', 'ru', 'Передавайте токен в заголовке ')}
+				<code>Authorization: Bearer snt_…</code>.
+				${L(
+					' Read-only tokens can be used only for GET requests.',
+					'ru',
+					' Токены только для чтения работают только для GET-запросов.',
+				)}
+			</p>
+			${tokens.length > 0 &&
+			html`
+				<table class="user-api-tokens-table">
+					<tr>
+						<th>${L('Name', 'ru', 'Название')}</th>
+						<th>${L('Access', 'ru', 'Доступ')}</th>
+						<th>${L('Created', 'ru', 'Создан')}</th>
+						<th>${L('Last used', 'ru', 'Использован')}</th>
+						<th></th>
+					</tr>
+					${tokens.map(t => html`<${TokenRow} key=${t.id} token=${t} onRemove=${onRemove} />`)}
+				</table>
+			`}
+			${newToken &&
+			html`
+				<p class="user-api-tokens-new">
+					${L(
+						'New token (it will not be shown again): ',
+						'ru',
+						'Новый токен (больше не будет показан): ',
+					)}
+					<code>${newToken}</code>
+				</p>
+			`}
+			<form class="user-api-tokens-form ${isSaving ? 'loading' : ''}" onsubmit=${onSubmit}>
+				<input type="text" name="name" maxlength="64" placeholder=${L('name', 'ru', 'название')} required />
+				${' '}
+				<label>
+					<input type="checkbox" name="readOnly" /> ${L('read only', 'ru', 'только чтение')}
+				</label>
+				${' '}
+				<button>${L('Create', 'ru', 'Создать')}</button>
+				${error && html`<div class="warn">${error}</div>`}
+			</form>
+		</div>
+	`
+}
@@ -3,6 +3,8 @@ import createStore from 'unistore'
 import { sortNodes } from 'src/utils/nodes'
 import { UserNodesList } from './user_nodes'
 import { PingsChartsList } from './pings_chart'
+import { UserMaintenance } from './user_maintenance'
+import { UserNodeGroups } from './user_node_groups'
 import { getJSONContent } from 'src/utils/elems'
 
 import './user_dashboard.css'
@@ -12,10 +14,11 @@ import { connectAndWrap } from 'src/utils/store'
 function convertFromJSON(node) {
 	node.lastPingedAt = new Date(node.lastPingedAt)
 	node.lastUpAt = new Date(node.lastUpAt)
+	node.lastQuicUpAt = new Date(node.lastQuicUpAt)
 	return node
 }
 
-let storeData = { nodes: [], nodesUpdateTime: new Date() }
+let storeData = { nodes: [], nodesUpdateTime: new Date(), groupFilter: '' }
 try {
 	let data = getJSONContent('user_nodes_data')
 	storeData.nodes = sortNodes(data.nodes.map(convertFromJSON))
@@ -41,17 +44,28 @@ let nodesActions = {
 		let nodes = state.nodes.filter(n => n.id !== node.id)
 		return { nodes }
 	},
+	setGroupFilter(state, groupFilter) {
+		return { groupFilter }
+	},
+}
+
+/** nodes of the selected group (or all nodes) */
+function filteredNodes({ nodes, groupFilter }) {
+	if (!groupFilter) return nodes
+	return nodes.filter(n => n.groups && n.groups.includes(groupFilter))
 }
 
 export const UserDashboardNodes = connectAndWrap(
 	UserNodesList,
 	store,
-	['nodes', 'nodesUpdateTime'],
+	state => ({ nodes: filteredNodes(state), nodesUpdateTime: state.nodesUpdateTime }),
 	nodesActions,
 )
 export const UserDashboardPings = connectAndWrap(
 	props => h(PingsChartsList, { ...props, group: 'my' }),
 	store,
-	'nodes',
+	state => ({ nodes: filteredNodes(state) }),
 	nodesActions,
 )
+export const UserDashboardMaintenance = connectAndWrap(UserMaintenance, store, 'nodes', nodesActions)
+export const UserDashboardGroups = connectAndWrap(UserNodeGroups, store, ['nodes', 'groupFilter'], nodesActions)
@@ -0,0 +1,155 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { shortNodeID } from 'src/utils/nodes'
+import { html } from 'src/utils/htm'
+
+import './user_maintenance.css'
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   nodeId: string|null,
+ *   startsAt: string,
+ *   durationMinutes: number,
+ *   recurrence: 'none'|'daily'|'weekly',
+ *   createdAt: string,
+ * }} MaintenanceWindow
+ */
+
+/** @param {string} dateStr */
+function formatDateTime(dateStr) {
+	const d = new Date(dateStr)
+	return d.toLocaleDateString() + ' ' + d.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' })
+}
+
+/** @param {MaintenanceWindow} w */
+function recurrenceText(w) {
+	if (w.recurrence === 'daily') return L('daily since', 'ru', 'ежедневно с')
+	if (w.recurrence === 'weekly') return L('weekly since', 'ru', 'еженедельно с')
+	return L('once at', 'ru', 'однократно в')
+}
+
+/** @param {{window:MaintenanceWindow, onRemove:(w:MaintenanceWindow) => unknown}} props */
+function WindowItem({ window: w, onRemove }) {
+	const onRemoveClick = useCallback(() => onRemove(w), [w, onRemove])
+	const isFinished =
+		w.recurrence === 'none' && +new Date(w.startsAt) + w.durationMinutes * 60 * 1000 < Date.now()
+	return html`
+		<tr class=${isFinished ? 'dim' : ''}>
+			<td>${w.nodeId ? html`<code>${shortNodeID(w.nodeId)}</code>` : L('all nodes', 'ru', 'все ноды')}</td>
+			<td>${recurrenceText(w)} ${formatDateTime(w.startsAt)}</td>
+			<td>${w.durationMinutes} ${L('min', 'ru', 'мин')}</td>
+			<td>
+				<button type="button" class="link-button" onclick=${onRemoveClick}>
+					${L('remove', 'ru', 'удалить')}
+				</button>
+			</td>
+		</tr>
+	`
+}
+
+/** @param {{nodes:{id:string, address:string}[]}} props */
+export function UserMaintenance({ nodes }) {
+	const [windows, setWindows] = useState(/**@type {MaintenanceWindow[]|null}*/ (null))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [isSaving, setIsSaving] = useState(false)
+
+	const reload = useCallback(() => {
+		apiReq('GET', '/api/user_maintenance').then(setWindows).catch(onError)
+	}, [])
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const fd = new FormData(form)
+			const startsAt = new Date(fd.get('startsAt') + '')
+			if (isNaN(+startsAt)) {
+				setError(L('Wrong start time', 'ru', 'Неправильное время начала'))
+				return
+			}
+			const data = {
+				nodeId: fd.get('nodeId') + '',
+				startsAt: startsAt.toISOString(),
+				durationMinutes: parseInt(fd.get('durationMinutes') + '', 10),
+				recurrence: fd.get('recurrence') + '',
+			}
+			setError(null)
+			setIsSaving(true)
+			apiReq('POST', '/api/user_maintenance', { data })
+				.then(() => {
+					form.reset()
+					reload()
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_MAINTENANCE_WINDOW') {
+						setError(
+							L(
+								'Wrong window: duration must be shorter than the repeat period (or up to 7 days for one-off)',
+								'ru',
+								'Неправильное окно: длительность должна быть меньше периода повтора (или до 7 дней для однократного)',
+							),
+						)
+					} else if (err.error === 'TOO_MANY_MAINTENANCE_WINDOWS') {
+						setError(L('Too many windows', 'ru', 'Слишком много окон'))
+					} else onError(err)
+				})
+				.finally(() => setIsSaving(false))
+		},
+		[reload],
+	)
+
+	const onRemove = useCallback(
+		(/**@type {MaintenanceWindow}*/ w) => {
+			apiReq('DELETE', '/api/user_maintenance', { data: { id: w.id } })
+				.then(reload)
+				.catch(onError)
+		},
+		[reload],
+	)
+
+	useEffect(reload, [reload])
+
+	if (!windows) return null
+
+	return html`
+		<div class="user-maintenance">
+			<h3>${L('Maintenance windows', 'ru', 'Окна обслуживания')}</h3>
+			<p class="dim">
+				${L(
+					'Nodes are still checked during maintenance, but downtime is excluded from uptime stats and no notifications are sent.',
+					'ru',
+					'Во время обслуживания ноды проверяются, но простой не учитывается в аптайме и уведомления не отправляются.',
+				)}
+			</p>
+			${windows.length > 0 &&
+			html`
+				<table class="maintenance-windows">
+					${windows.map(w => html`<${WindowItem} key=${w.id} window=${w} onRemove=${onRemove} />`)}
+				</table>
+			`}
+			<form class="user-maintenance-form ${isSaving ? 'loading' : ''}" onsubmit=${onSubmit}>
+				<select name="nodeId">
+					<option value="">${L('all nodes', 'ru', 'все ноды')}</option>
+					${nodes.map(n => html`<option value=${n.id}>${shortNodeID(n.id)} ${n.address}</option>`)}
+				</select>
+				${' '}
+				<select name="recurrence">
+					<option value="none">${L('once', 'ru', 'однократно')}</option>
+					<option value="daily">${L('daily', 'ru', 'ежедневно')}</option>
+					<option value="weekly">${L('weekly', 'ru', 'еженедельно')}</option>
+				</select>
+				${' '}
+				<input type="datetime-local" name="startsAt" required />
+				${' '}
+				<input type="number" name="durationMinutes" min="1" max="10080" value="30" required />
+				${L(' min', 'ru', ' мин')}${' '}
+				<button>${L('Add', 'ru', 'Добавить')}</button>
+				${error && html`<div class="warn">${error}</div>`}
+			</form>
+		</div>
+	`
+}
@@ -0,0 +1,345 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { shortNodeID } from 'src/utils/nodes'
+import { html } from 'src/utils/htm'
+
+import './user_node_groups.css'
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   name: string,
+ *   createdAt: string,
+ *   nodesCount: number,
+ *   upCount: number,
+ *   downCount: number,
+ *   nodeIds: string[],
+ *   monthUptime: number,
+ *   monthOutages: number,
+ * }} NodeGroup
+ */
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   key: string,
+ *   groupId: number,
+ *   groupName: string,
+ *   isPublic: boolean,
+ *   maskIds: boolean,
+ *   createdAt: string,
+ * }} NodeGroupShare
+ */
+
+/** @typedef {{id:string, address:string, groups:string[]|null}} GroupNode */
+
+/**
+ * @param {{
+ *   group: NodeGroup,
+ *   shares: NodeGroupShare[],
+ *   onChange: () => unknown,
+ * }} props
+ */
+function GroupShares({ group, shares, onChange }) {
+	const [isFormShown, setIsFormShown] = useState(false)
+	const [isPublic, setIsPublic] = useState(false)
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = new FormData(e.target)
+			const data = {
+				groupId: group.id,
+				isPublic,
+				key: (form.get('key') + '').trim(),
+				maskIds: form.get('maskIds') === 'on',
+			}
+			setError(null)
+			apiReq('POST', '/api/user_node_group_shares', { data })
+				.then(() => {
+					setIsFormShown(false)
+					onChange()
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_SHARE_KEY') {
+						setError(L('Wrong link name', 'ru', 'Неправильное имя ссылки'))
+					} else if (err.error === 'SHARE_KEY_EXISTS') {
+						setError(L('Link name is taken', 'ru', 'Имя ссылки занято'))
+					} else if (err.error === 'TOO_MANY_SHARES') {
+						setError(L('Too many shared links', 'ru', 'Слишком много ссылок'))
+					} else onError(err)
+				})
+		},
+		[group, isPublic, onChange],
+	)
+	const onRemove = useCallback(
+		(/**@type {NodeGroupShare}*/ share) => {
+			if (!confirm(L('Remove shared link?', 'ru', 'Удалить ссылку?'))) return
+			apiReq('DELETE', '/api/user_node_group_shares', { data: { id: share.id } })
+				.then(onChange)
+				.catch(onError)
+		},
+		[onChange],
+	)
+
+	return html`
+		<div class="group-shares">
+			${shares.map(
+				share => html`
+					<div key=${share.id}>
+						<a href="/share/${share.key}" target="_blank">
+							${location.host}/share/${share.isPublic ? share.key : share.key.slice(0, 6) + '…'}
+						</a>
+						${' '}
+						<span class="dim">
+							${share.isPublic ? L('public', 'ru', 'публичная') : L('secret', 'ru', 'секретная')}
+							${share.maskIds && ', ' + L('IDs masked', 'ru', 'ID скрыты')}
+						</span>
+						${' '}
+						<button type="button" class="link-button" onclick=${() => onRemove(share)}>
+							${L('remove', 'ru', 'удалить')}
+						</button>
+					</div>
+				`,
+			)}
+			${isFormShown
+				? html`
+						<form onsubmit=${onSubmit}>
+							<label>
+								<input
+									type="checkbox"
+									checked=${isPublic}
+									onchange=${e => setIsPublic(e.target.checked)}
+								/>
+								${L('public', 'ru', 'публичная')}
+							</label>
+							${' '}
+							${isPublic &&
+							html`<input name="key" placeholder="my-nodes" pattern="[a-z0-9][a-z0-9\-]{2,31}" required />`}
+							${' '}
+							<label>
+								<input type="checkbox" name="maskIds" checked />
+								${L('mask IDs and addresses', 'ru', 'скрыть ID и адреса')}
+							</label>
+							${' '}
+							<button>${L('Create link', 'ru', 'Создать ссылку')}</button>
+							${error && html`<div class="warn">${error}</div>`}
+						</form>
+				  `
+				: html`
+						<button type="button" class="link-button" onclick=${() => setIsFormShown(true)}>
+							${L('share status page', 'ru', 'поделиться страницей статуса')}
+						</button>
+				  `}
+		</div>
+	`
+}
+
+/**
+ * @param {{
+ *   group: NodeGroup,
+ *   shares: NodeGroupShare[],
+ *   nodes: GroupNode[],
+ *   isSelected: boolean,
+ *   onSelect: (group:NodeGroup) => unknown,
+ *   onRemove: (group:NodeGroup) => unknown,
+ *   onMembersChange: (group:NodeGroup, nodeIds:string[], remove:boolean) => unknown,
+ *   onSharesChange: () => unknown,
+ * }} props
+ */
+function GroupItem({ group, shares, nodes, isSelected, onSelect, onRemove, onMembersChange, onSharesChange }) {
+	const onSelectClick = useCallback(() => onSelect(group), [group, onSelect])
+	const onRemoveClick = useCallback(() => {
+		if (confirm(L('Remove group?', 'ru', 'Удалить группу?'))) onRemove(group)
+	}, [group, onRemove])
+	const onAddNode = useCallback(
+		e => {
+			const nodeId = e.target.value
+			e.target.value = ''
+			if (nodeId === '*') {
+				const ids = nodes.map(n => n.id).filter(id => !group.nodeIds.includes(id))
+				onMembersChange(group, ids, false)
+			} else if (nodeId) onMembersChange(group, [nodeId], false)
+		},
+		[group, nodes, onMembersChange],
+	)
+	const notInGroup = nodes.filter(n => !group.nodeIds.includes(n.id))
+
+	return html`
+		<div class="group ${isSelected ? 'selected' : ''}">
+			<div>
+				<button
+					type="button"
+					class="link-button group-name"
+					title=${L('show only these nodes', 'ru', 'показывать только эти ноды')}
+					onclick=${onSelectClick}
+				>
+					${group.name}
+				</button>
+				${' '}
+				<span class="group-status">
+					<span class="up">${group.upCount} ${L('up', 'ru', 'работают')}</span>${', '}
+					<span class=${group.downCount > 0 ? 'down' : ''}>
+						${group.downCount} ${L('down', 'ru', 'недоступны')}
+					</span>
+					${' '}${L('of', 'ru', 'из')} ${group.nodesCount}
+				</span>
+				${' · '}
+				<span class="dim">${L('month uptime', 'ru', 'аптайм за месяц')}</span>${' '}
+				${group.monthUptime < 0 ? '—' : group.monthUptime.toFixed(3) + '%'}
+				${group.monthOutages > 0 &&
+				html`, ${group.monthOutages} <span class="dim">${L('outages', 'ru', 'простоев')}</span>`}
+				${' '}
+				<button type="button" class="link-button" onclick=${onRemoveClick}>
+					${L('remove', 'ru', 'удалить')}
+				</button>
+			</div>
+			<div class="group-nodes">
+				${group.nodeIds.map(
+					id => html`
+						<span class="group-node" key=${id}>
+							<code>${shortNodeID(id)}</code>
+							<button
+								type="button"
+								class="link-button"
+								onclick=${() => onMembersChange(group, [id], true)}
+							>
+								✕
+							</button>
+						</span>
+					`,
+				)}
+				${notInGroup.length > 0 &&
+				html`
+					<select onchange=${onAddNode}>
+						<option value="">${L('+ add node', 'ru', '+ добавить ноду')}</option>
+						<option value="*">${L('all nodes', 'ru', 'все ноды')}</option>
+						${notInGroup.map(n => html`<option value=${n.id}>${shortNodeID(n.id)} ${n.address}</option>`)}
+					</select>
+				`}
+			</div>
+			<${GroupShares} group=${group} shares=${shares} onChange=${onSharesChange} />
+		</div>
+	`
+}
+
+/**
+ * @param {{
+ *   nodes: GroupNode[],
+ *   groupFilter: string,
+ *   setGroupFilter: (name:string) => unknown,
+ *   setNode: (node:GroupNode) => unknown,
+ * }} props
+ */
+export function UserNodeGroups({ nodes, groupFilter, setGroupFilter, setNode }) {
+	const [groups, setGroups] = useState(/**@type {NodeGroup[]|null}*/ (null))
+	const [shares, setShares] = useState(/**@type {NodeGroupShare[]}*/ ([]))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+
+	const reload = useCallback(() => {
+		apiReq('GET', '/api/user_node_groups').then(setGroups).catch(onError)
+	}, [])
+	const reloadShares = useCallback(() => {
+		apiReq('GET', '/api/user_node_group_shares').then(setShares).catch(onError)
+	}, [])
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const name = (new FormData(form).get('name') + '').trim()
+			setError(null)
+			apiReq('POST', '/api/user_node_groups', { data: { name } })
+				.then(() => {
+					form.reset()
+					reload()
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_GROUP_NAME') {
+						setError(L('Wrong name', 'ru', 'Неправильное название'))
+					} else if (err.error === 'GROUP_EXISTS') {
+						setError(L('Group already exists', 'ru', 'Такая группа уже есть'))
+					} else if (err.error === 'TOO_MANY_GROUPS') {
+						setError(L('Too many groups', 'ru', 'Слишком много групп'))
+					} else onError(err)
+				})
+		},
+		[reload],
+	)
+
+	const onSelect = useCallback(
+		(/**@type {NodeGroup}*/ group) => {
+			setGroupFilter(groupFilter === group.name ? '' : group.name)
+		},
+		[groupFilter, setGroupFilter],
+	)
+
+	const onRemove = useCallback(
+		(/**@type {NodeGroup}*/ group) => {
+			apiReq('DELETE', '/api/user_node_groups', { data: { id: group.id } })
+				.then(() => {
+					for (const node of nodes) {
+						const groups = node.groups || []
+						if (groups.includes(group.name))
+							setNode({ ...node, groups: groups.filter(x => x !== group.name) })
+					}
+					if (groupFilter === group.name) setGroupFilter('')
+					reload()
+				})
+				.catch(onError)
+		},
+		[nodes, groupFilter, setGroupFilter, setNode, reload],
+	)
+
+	const onMembersChange = useCallback(
+		(/**@type {NodeGroup}*/ group, /**@type {string[]}*/ nodeIds, /**@type {boolean}*/ remove) => {
+			apiReq('POST', '/api/user_node_groups/members', { data: { groupId: group.id, nodeIds, remove } })
+				.then(() => {
+					for (const node of nodes) {
+						if (!nodeIds.includes(node.id)) continue
+						const groups = (node.groups || []).filter(x => x !== group.name)
+						if (!remove) groups.push(group.name)
+						setNode({ ...node, groups: groups.sort() })
+					}
+					reload()
+				})
+				.catch(onError)
+		},
+		[nodes, setNode, reload],
+	)
+
+	useEffect(reload, [reload])
+	useEffect(reloadShares, [reloadShares])
+
+	if (!groups) return null
+
+	return html`
+		<div class="user-node-groups">
+			<h3>${L('Groups', 'ru', 'Группы')}</h3>
+			${groups.map(
+				g => html`
+					<${GroupItem}
+						key=${g.id}
+						group=${g}
+						shares=${shares.filter(s => s.groupId === g.id)}
+						nodes=${nodes}
+						isSelected=${g.name === groupFilter}
+						onSelect=${onSelect}
+						onRemove=${onRemove}
+						onMembersChange=${onMembersChange}
+						onSharesChange=${reloadShares}
+					/>
+				`,
+			)}
+			<form class="user-node-groups-form" onsubmit=${onSubmit}>
+				<input name="name" maxlength="64" placeholder=${L('site-A', 'ru', 'дача')} required />${' '}
+				<button>${L('Add group', 'ru', 'Добавить группу')}</button>
+				${error && html`<div class="warn">${error}</div>`}
+			</form>
+		</div>
+	`
+}
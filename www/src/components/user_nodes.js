@@ -1,6 +1,6 @@
 import { useCallback, useEffect, useMemo, useState } from 'preact/hooks'
 
-import { apiReq, apiReqIPsSanctions } from 'src/api'
+import { apiReq, apiReqIPsSanctions, withOrgQuery } from 'src/api'
 import { ago, L, lang } from 'src/i18n'
 import { onError } from 'src/errors'
 import {
@@ -28,10 +28,20 @@ import { useStorageState } from 'src/utils/store'
  *   id: string,
  *   address: string,
  *   pingMode: 'off'|'dial'|'ping',
+ *   pingProto: 'tcp'|'quic'|'both',
+ *   pingInterval: 1|5|15,
+ *   pingAllSats: boolean,
  *   lastPingedAt: Date,
  *   lastUpAt: Date,
  *   lastPing: number,
  *   lastPingWasOk: boolean,
+ *   lastSatPings: {sat:string, ok:boolean, ping:number}[] | null,
+ *   lastQuicPing: number,
+ *   lastQuicPingWasOk: boolean,
+ *   lastQuicUpAt: Date,
+ *   inMaintenance: boolean,
+ *   isFlapping: boolean,
+ *   groups: string[] | null,
  *   isLoading?: boolean
  * }} UserNode
  */
@@ -76,6 +86,10 @@ const BLANK_NODE = {
 	id: '',
 	address: '',
 	pingMode: 'off',
+	pingProto: 'tcp',
+	pingInterval: 1,
+	groups: [],
+	pingAllSats: false,
 	lastPingedAt: new Date(0),
 	lastPingWasOk: false,
 	lastPing: 0,
@@ -284,6 +298,14 @@ function NodeIPInfoFull({ ipInfo }) {
  * @prop {NodeIPSanction|undefined|Promise<unknown>} sanction
  * @extends {PureComponent<UNI_Props, {}>}
  */
+/**
+ * TCP works but QUIC does not: most likely UDP port is not forwarded
+ * @param {UserNode} node
+ */
+function quicIsBroken(node) {
+	return node.pingProto === 'both' && node.lastPingWasOk && !node.lastQuicPingWasOk
+}
+
 class UserNodeItem extends PureComponent {
 	constructor() {
 		super()
@@ -292,7 +314,9 @@ class UserNodeItem extends PureComponent {
 
 	onChange(e) {
 		let changed = { ...this.props.node }
-		changed[e.target.name] = e.target.value
+		let value = e.target.type === 'checkbox' ? e.target.checked : e.target.value
+		if (e.target.name === 'pingInterval') value = parseInt(value)
+		changed[e.target.name] = value
 		this.props.onChange(changed)
 	}
 	onRemoveClick(e) {
@@ -301,6 +325,22 @@ class UserNodeItem extends PureComponent {
 	onNodeStatusDetails() {
 		const node = this.props.node
 		return html`
+			${node.inMaintenance &&
+			html`<p class="warn">
+				${L(
+					'Maintenance window is active: downtime is not counted and not notified.',
+					'ru',
+					'Идёт окно обслуживания: простой не учитывается, уведомления не отправляются.',
+				)}
+			</p>`}
+			${node.isFlapping &&
+			html`<p class="warn">
+				${L(
+					'Node is flapping: it goes up and down repeatedly. Down/up notifications are paused until it is stable.',
+					'ru',
+					'Нода то пропадает, то появляется. Уведомления о падениях приостановлены до стабилизации.',
+				)}
+			</p>`}
 			<h3>${L('Last connection attempt', 'ru', 'Последняя попытка подключения')}</h3>
 			${+node.lastPingedAt < 0
 				? html`<p>${L('N/a', 'ru', 'Н/д')}</p>`
@@ -322,6 +362,38 @@ class UserNodeItem extends PureComponent {
 						${L('Has failed. More info on ', 'ru', 'Провалилось. Подробнее: ')}
 						<a href="/ping_my_node">/ping_my_node</a>
 				  </p>`}
+			${node.pingProto === 'both' &&
+			html`
+				<h3>QUIC</h3>
+				${node.lastQuicPingWasOk
+					? html`<p>
+							${node.lastQuicPing} ${L('ms', 'ru', 'мс')}${' '}
+							<span class="dim">${L('response time', 'ru', 'время ответа')}</span>
+					  </p>`
+					: html`<p class="warn">
+							${L(
+								'Unreachable via QUIC. If TCP works, check UDP port forwarding.',
+								'ru',
+								'Недоступна по QUIC. Если TCP работает, проверьте проброс UDP-порта.',
+							)}
+					  </p>`}
+			`}
+			${node.pingAllSats &&
+			node.lastSatPings &&
+			html`
+				<h3>${L('From each satellite', 'ru', 'С каждого сателлита')}</h3>
+				<p>
+					${node.lastSatPings.map(
+						p => html`
+							${p.sat}:${' '}
+							${p.ok
+								? html`<span class="ok">${p.ping} ${L('ms', 'ru', 'мс')}</span>`
+								: html`<span class="warn">${L('unreachable', 'ru', 'недоступна')}</span>`}
+							<br />
+						`,
+					)}
+				</p>
+			`}
 		`
 	}
 
@@ -338,11 +410,23 @@ class UserNodeItem extends PureComponent {
 
 		const lastPingedAgo = +nodeUpdateTime - +node.lastPingedAt
 		const status =
-			node.pingMode === 'off' || lastPingedAgo > 5 * 60 * 1000
+			node.pingMode === 'off' || lastPingedAgo > (node.pingInterval + 4) * 60 * 1000
 				? 'unknown'
+				: node.inMaintenance
+				? 'maintenance'
+				: node.isFlapping
+				? 'flapping'
 				: node.lastPingWasOk
-				? 'ok'
+				? quicIsBroken(node)
+					? 'warn'
+					: 'ok'
 				: 'error'
+		const pingProtos = [
+			['tcp', 'TCP'],
+			['quic', 'QUIC'],
+			['both', 'TCP+QUIC'],
+		]
+		const pingIntervals = [1, 5, 15]
 
 		return html`
 			<tr class="node ${node.isLoading ? 'loading' : ''} ${'status-' + status}">
@@ -376,6 +460,43 @@ class UserNodeItem extends PureComponent {
 									`,
 							)}
 						</select>
+						<select name="pingProto" onchange=${this.onChange}>
+							${pingProtos.map(
+								([name, label]) =>
+									html`
+										<option value=${name} selected=${name === node.pingProto}>
+											${label}
+										</option>
+									`,
+							)}
+						</select>
+						<select
+							name="pingInterval"
+							title=${L('check interval', 'ru', 'интервал проверки')}
+							onchange=${this.onChange}
+						>
+							${pingIntervals.map(
+								minutes =>
+									html`
+										<option value=${minutes} selected=${minutes === node.pingInterval}>
+											${minutes} ${L('min', 'ru', 'мин')}
+										</option>
+									`,
+							)}
+						</select>
+						${status === 'warn' &&
+						html`<span class="warn" title=${L('QUIC is unreachable', 'ru', 'QUIC недоступен')}>⚠</span>`}
+						<label
+							class="node-ping-all-sats"
+							title=${L('ping from all satellites', 'ru', 'пинговать со всех сателлитов')}
+						>
+							<input
+								type="checkbox"
+								name="pingAllSats"
+								checked=${node.pingAllSats}
+								onchange=${this.onChange}
+							/>${L('all sats', 'ru', 'все')}
+						</label>
 					</div>
 				</td>
 				<${NodeIPCell} resolvedIP=${resolvedIP} sanction=${sanction} />
@@ -451,8 +572,35 @@ class NewUserNodeForm extends PureComponent {
 
 function getPingModeHelpContent() {
 	return html`
-		<p>${L('Availability check (once a minute)', 'ru', 'Проверка доступности (раз в минуту).')}</p>
+		<p>${L('Availability check', 'ru', 'Проверка доступности.')}</p>
 		<${PingModeDescription} />
+		<p>
+			${L(
+				'Interval — check once in 1, 5 or 15 minutes. History is saved with the same resolution ' +
+					'(a new interval is applied to history from the next day, UTC).',
+				'ru',
+				'Интервал — проверять раз в 1, 5 или 15 минут. История сохраняется с тем же разрешением ' +
+					'(новый интервал применяется к истории со следующего дня, UTC).',
+			)}
+		</p>
+		<p>
+			${L(
+				'TCP+QUIC — check both protocols, main status is by TCP. ' +
+					'If QUIC fails while TCP works, UDP port forwarding is probably broken.',
+				'ru',
+				'TCP+QUIC — проверять оба протокола, основной статус — по TCP. ' +
+					'Если QUIC не работает при работающем TCP, скорее всего, сломан проброс UDP-порта.',
+			)}
+		</p>
+		<p>
+			${L(
+				'«All sats» — check from every satellite and proxy (not only until the first success) ' +
+					'and save each result: helps to tell node outages from regional routing problems.',
+				'ru',
+				'«Все» — проверять со всех сателлитов и прокси (а не до первого успешного) ' +
+					'и сохранять каждый результат: помогает отличить падение ноды от проблем с маршрутизацией в регионе.',
+			)}
+		</p>
 		<p class="warn">
 			${lang === 'ru'
 				? 'Обновления автоматически отключатся после месяца оффлайна.'
@@ -641,6 +789,14 @@ export const UserNodesList = memo(function UserNodesList(
 			<${NewUserNodeForm} onNodeAdd=${setNodeInner} />
 		</div>
 		${nodeError !== null && html`<p class="warn">${nodeError}</p>`}
+		${nodes.length > 0 &&
+		html`
+			<p class="user-nodes-export dim">
+				${L('Export', 'ru', 'Экспорт')}:${' '}
+				<a href=${withOrgQuery('/api/user_nodes/export')} download>txt</a>,${' '}
+				<a href=${withOrgQuery('/api/user_nodes/export?format=json')} target="_blank">json</a>
+			</p>
+		`}
 	`
 })
 
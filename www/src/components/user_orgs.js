@@ -0,0 +1,213 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq, currentOrgID } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { getJSONContent } from 'src/utils/elems'
+import { html } from 'src/utils/htm'
+
+import './user_orgs.css'
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   name: string,
+ *   role: 'owner'|'editor'|'viewer',
+ *   createdAt: string,
+ * }} Org
+ */
+
+/**
+ * @typedef {{
+ *   userId: number,
+ *   username: string,
+ *   role: 'owner'|'editor'|'viewer',
+ *   createdAt: string,
+ * }} OrgMember
+ */
+
+function roleLabels() {
+	return {
+		owner: L('owner', 'ru', 'владелец'),
+		editor: L('editor', 'ru', 'редактор'),
+		viewer: L('viewer', 'ru', 'наблюдатель'),
+	}
+}
+
+/** @param {{org:Org, authUserId:number}} props */
+function OrgMembers({ org, authUserId }) {
+	const [members, setMembers] = useState(/**@type {OrgMember[]|null}*/ (null))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const isOwner = org.role === 'owner'
+	const labels = roleLabels()
+
+	const reload = useCallback(() => {
+		apiReq('GET', `/api/orgs/${org.id}/members`).then(setMembers).catch(onError)
+	}, [org])
+
+	const handleErr = useCallback(err => {
+		if (err.error === 'USER_NOT_FOUND') {
+			setError(L('User not found', 'ru', 'Пользователь не найден'))
+		} else if (err.error === 'LAST_OWNER') {
+			setError(L('Organization must have an owner', 'ru', 'У организации должен быть владелец'))
+		} else if (err.error === 'TOO_MANY_MEMBERS') {
+			setError(L('Too many members', 'ru', 'Слишком много участников'))
+		} else onError(err)
+	}, [])
+
+	const setMember = useCallback(
+		(/**@type {string}*/ username, /**@type {string}*/ role) => {
+			setError(null)
+			return apiReq('POST', `/api/orgs/${org.id}/members`, { data: { username, role } }).then(reload)
+		},
+		[org, reload],
+	)
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const data = new FormData(form)
+			setMember(data.get('username') + '', data.get('role') + '')
+				.then(() => form.reset())
+				.catch(handleErr)
+		},
+		[setMember, handleErr],
+	)
+	const onRemove = useCallback(
+		(/**@type {OrgMember}*/ member) => {
+			const isSelf = member.userId === authUserId
+			const msg = isSelf
+				? L('Leave the organization?', 'ru', 'Покинуть организацию?')
+				: L(`Remove ${member.username}?`, 'ru', `Удалить ${member.username}?`)
+			if (!confirm(msg)) return
+			setError(null)
+			apiReq('DELETE', `/api/orgs/${org.id}/members`, { data: { userId: member.userId } })
+				.then(() => {
+					if (isSelf) location.href = '/~'
+					else reload()
+				})
+				.catch(handleErr)
+		},
+		[org, authUserId, reload, handleErr],
+	)
+
+	useEffect(reload, [reload])
+
+	if (!members) return null
+
+	return html`
+		<table class="user-orgs-members">
+			${members.map(
+				m => html`
+					<tr key=${m.userId}>
+						<td>${m.username}</td>
+						<td>
+							${isOwner
+								? html`
+										<select onchange=${e => setMember(m.username, e.target.value).catch(handleErr)}>
+											${Object.entries(labels).map(
+												([role, label]) =>
+													html`<option value=${role} selected=${role === m.role}>${label}</option>`,
+											)}
+										</select>
+								  `
+								: labels[m.role]}
+						</td>
+						<td>
+							${(isOwner || m.userId === authUserId) &&
+							html`
+								<button type="button" class="link-button" onclick=${() => onRemove(m)}>
+									${m.userId === authUserId ? L('leave', 'ru', 'выйти') : L('remove', 'ru', 'удалить')}
+								</button>
+							`}
+						</td>
+					</tr>
+				`,
+			)}
+		</table>
+		${isOwner &&
+		html`
+			<form class="user-orgs-form" onsubmit=${onSubmit}>
+				<input name="username" placeholder=${L('username', 'ru', 'имя пользователя')} required />${' '}
+				<select name="role">
+					${Object.entries(labels).map(
+						([role, label]) => html`<option value=${role} selected=${role === 'viewer'}>${label}</option>`,
+					)}
+				</select>
+				${' '}
+				<button>${L('Add member', 'ru', 'Добавить участника')}</button>
+			</form>
+		`}
+		${error && html`<div class="warn">${error}</div>`}
+	`
+}
+
+export function UserOrgs() {
+	const [orgs, setOrgs] = useState(/**@type {Org[]|null}*/ (null))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const { authUserId } = getJSONContent('user_orgs_data')
+	const orgID = currentOrgID()
+	const labels = roleLabels()
+
+	const reload = useCallback(() => {
+		apiReq('GET', '/api/orgs').then(setOrgs).catch(onError)
+	}, [])
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const name = (new FormData(form).get('name') + '').trim()
+			setError(null)
+			apiReq('POST', '/api/orgs', { data: { name } })
+				.then(org => {
+					location.href = '/~?org=' + org.id
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_ORG_NAME') {
+						setError(L('Wrong name', 'ru', 'Неправильное название'))
+					} else if (err.error === 'ORG_NAME_EXISTS') {
+						setError(L('Name is already taken', 'ru', 'Название уже занято'))
+					} else if (err.error === 'TOO_MANY_ORGS') {
+						setError(L('Too many organizations', 'ru', 'Слишком много организаций'))
+					} else onError(err)
+				})
+		},
+		[],
+	)
+
+	useEffect(reload, [reload])
+
+	if (!orgs) return null
+	const curOrg = orgs.find(o => o.id + '' === orgID)
+
+	return html`
+		<div class="user-orgs">
+			<h3>${L('Organizations', 'ru', 'Организации')}</h3>
+			<p>
+				${orgID
+					? html`<a href="/~">${L('personal account', 'ru', 'личный аккаунт')}</a>`
+					: html`<b>${L('personal account', 'ru', 'личный аккаунт')}</b>`}
+				${orgs.map(
+					o => html`
+						${' · '}
+						${o === curOrg
+							? html`<b>${o.name}</b>`
+							: html`<a href=${'/~?org=' + o.id}>${o.name}</a>`}
+						${' '}<span class="dim">(${labels[o.role]})</span>
+					`,
+				)}
+			</p>
+			${curOrg && html`<${OrgMembers} org=${curOrg} authUserId=${authUserId} />`}
+			${!orgID &&
+			html`
+				<form class="user-orgs-form" onsubmit=${onSubmit}>
+					<input name="name" minlength="3" maxlength="64" placeholder=${L('name', 'ru', 'название')} required />
+					${' '}
+					<button>${L('Create organization', 'ru', 'Создать организацию')}</button>
+					${error && html`<div class="warn">${error}</div>`}
+				</form>
+			`}
+		</div>
+	`
+}
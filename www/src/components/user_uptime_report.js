@@ -0,0 +1,112 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq, withOrgQuery } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { shortNodeID } from 'src/utils/nodes'
+import { html } from 'src/utils/htm'
+
+import './user_uptime_report.css'
+
+/**
+ * @typedef {{
+ *   nodeId: string,
+ *   address: string,
+ *   month: string,
+ *   checkedMinutes: number,
+ *   downMinutes: number,
+ *   maintenanceMinutes: number,
+ *   uptimePercent: number,
+ *   outagesCount: number,
+ *   longestOutageMinutes: number,
+ *   medianPing: number,
+ *   p95Ping: number,
+ * }} UptimeReport
+ */
+
+/** @param {Date} date */
+function toMonthString(date) {
+	return date.toISOString().slice(0, 7)
+}
+
+/** @param {number} minutes */
+function formatMinutes(minutes) {
+	if (minutes < 60) return minutes + L(' min', 'ru', ' мин')
+	const hours = Math.floor(minutes / 60)
+	return hours + L(' h ', 'ru', ' ч ') + (minutes % 60) + L(' min', 'ru', ' мин')
+}
+
+/** @param {{report:UptimeReport}} props */
+function ReportRow({ report: r }) {
+	const hasData = r.checkedMinutes > 0
+	return html`
+		<tr>
+			<td><code>${shortNodeID(r.nodeId)}</code></td>
+			<td>${r.address}</td>
+			<td class=${hasData && r.uptimePercent < 99.3 ? 'uptime-low' : ''}>
+				${hasData ? r.uptimePercent.toFixed(3) + '%' : '—'}
+			</td>
+			<td>${r.outagesCount}</td>
+			<td>${r.outagesCount > 0 ? formatMinutes(r.longestOutageMinutes) : '—'}</td>
+			<td>${r.medianPing ? r.medianPing + L(' ms', 'ru', ' мс') : '—'}</td>
+			<td>${r.p95Ping ? r.p95Ping + L(' ms', 'ru', ' мс') : '—'}</td>
+		</tr>
+	`
+}
+
+export function UserUptimeReport() {
+	const [month, setMonth] = useState(toMonthString(new Date()))
+	const [reports, setReports] = useState(/**@type {UptimeReport[]|null}*/ (null))
+
+	useEffect(() => {
+		apiReq('GET', '/api/user_nodes/uptime_report', { data: { month } })
+			.then(setReports)
+			.catch(onError)
+	}, [month])
+
+	const onMonthChange = useCallback(e => {
+		if (e.target.value) setMonth(e.target.value)
+	}, [])
+
+	if (!reports) return null
+	if (reports.length === 0) return null
+
+	const downloadURL = format => withOrgQuery(`/api/user_nodes/uptime_report?month=${month}&format=${format}`)
+
+	return html`
+		<div class="user-uptime-report">
+			<h3>${L('Monthly uptime', 'ru', 'Аптайм за месяц')}</h3>
+			<p>
+				<input type="month" value=${month} onchange=${onMonthChange} />${' '}
+				${L('download', 'ru', 'скачать')}${' '}
+				<a href=${downloadURL('csv')}>CSV</a>${' '}
+				<a href=${downloadURL('json')}>JSON</a>
+			</p>
+			<div class="wide-block">
+				<table>
+					<tr>
+						<td>${L('Node', 'ru', 'Нода')}</td>
+						<td>${L('Address', 'ru', 'Адрес')}</td>
+						<td>${L('Uptime', 'ru', 'Аптайм')}</td>
+						<td>${L('Outages', 'ru', 'Простои')}</td>
+						<td>${L('Longest', 'ru', 'Самый долгий')}</td>
+						<td>${L('Median ping', 'ru', 'Медиана пинга')}</td>
+						<td>p95</td>
+					</tr>
+					${reports.map(r => html`<${ReportRow} key=${r.nodeId} report=${r} />`)}
+				</table>
+			</div>
+			<p class="dim">
+				${L(
+					'Calculated from the availability checks history (UTC months). ' +
+						'Minutes without checks and maintenance windows are not counted. ' +
+						'Uptime below 99.3% is highlighted: the satellites may start to suspend such nodes.',
+					'ru',
+					'Считается по истории проверок доступности (месяцы по UTC). ' +
+						'Минуты без проверок и окна обслуживания не учитываются. ' +
+						'Аптайм ниже 99.3% подсвечен: сателлиты могут начать отстранять такие ноды.',
+				)}
+			</p>
+		</div>
+	`
+}
@@ -0,0 +1,160 @@
+import { useCallback, useEffect, useState } from 'preact/hooks'
+
+import { apiReq } from 'src/api'
+import { L } from 'src/i18n'
+import { onError } from 'src/errors'
+import { html } from 'src/utils/htm'
+
+import './user_webhooks.css'
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   eventId: number,
+ *   eventKind: 'down'|'up'|'flapping'|'flapping_stopped',
+ *   nodeId: string,
+ *   attempts: number,
+ *   nextAttemptAt: string,
+ *   lastStatus: number,
+ *   lastError: string,
+ *   createdAt: string,
+ *   status: 'pending'|'delivered'|'failed',
+ * }} WebhookDelivery
+ */
+
+/**
+ * @typedef {{
+ *   id: number,
+ *   url: string,
+ *   secret: string,
+ *   createdAt: string,
+ *   deliveries: WebhookDelivery[],
+ * }} Webhook
+ */
+
+/** @param {string} dateStr */
+function formatDateTime(dateStr) {
+	const d = new Date(dateStr)
+	return d.toLocaleDateString() + ' ' + d.toLocaleTimeString()
+}
+
+/** @param {{delivery:WebhookDelivery}} props */
+function DeliveryRow({ delivery: d }) {
+	const statusText =
+		d.status === 'delivered'
+			? L('delivered', 'ru', 'доставлено')
+			: d.status === 'failed'
+			? L('failed', 'ru', 'не доставлено')
+			: L('pending', 'ru', 'ожидает')
+	return html`
+		<tr>
+			<td>${formatDateTime(d.createdAt)}</td>
+			<td>${d.eventKind}</td>
+			<td><code>${d.nodeId.slice(0, 8)}…</code></td>
+			<td class=${'status-' + d.status}>${statusText}</td>
+			<td>${d.attempts}</td>
+			<td class="last-error">${d.lastError}</td>
+		</tr>
+	`
+}
+
+/** @param {{webhook:Webhook, onRemove:(webhook:Webhook) => unknown}} props */
+function WebhookItem({ webhook, onRemove }) {
+	const [secretShown, setSecretShown] = useState(false)
+	const onRemoveClick = useCallback(() => {
+		if (confirm(L('Remove webhook?', 'ru', 'Удалить вебхук?'))) onRemove(webhook)
+	}, [webhook, onRemove])
+	const toggleSecret = useCallback(() => setSecretShown(x => !x), [])
+
+	return html`
+		<div class="webhook">
+			<div>
+				<code>${webhook.url}</code>${' '}
+				<button type="button" class="link-button" onclick=${toggleSecret}>
+					${L('secret', 'ru', 'секрет')}
+				</button>
+				${' '}
+				<button type="button" class="link-button" onclick=${onRemoveClick}>
+					${L('remove', 'ru', 'удалить')}
+				</button>
+			</div>
+			${secretShown && html`<div><code>${webhook.secret}</code></div>`}
+			${webhook.deliveries.length === 0
+				? html`<div class="dim">${L('No deliveries yet', 'ru', 'Отправок пока не было')}</div>`
+				: html`
+						<table class="webhook-deliveries">
+							${webhook.deliveries.map(d => html`<${DeliveryRow} key=${d.id} delivery=${d} />`)}
+						</table>
+				  `}
+		</div>
+	`
+}
+
+export function UserWebhooks() {
+	const [webhooks, setWebhooks] = useState(/**@type {Webhook[]|null}*/ (null))
+	const [error, setError] = useState(/**@type {string|null}*/ (null))
+	const [isSaving, setIsSaving] = useState(false)
+
+	const reload = useCallback(() => {
+		apiReq('GET', '/api/user_webhooks').then(setWebhooks).catch(onError)
+	}, [])
+
+	const onSubmit = useCallback(
+		e => {
+			e.preventDefault()
+			const form = e.target
+			const url = new FormData(form).get('url') + ''
+			setError(null)
+			setIsSaving(true)
+			apiReq('POST', '/api/user_webhooks', { data: { url } })
+				.then(() => {
+					form.reset()
+					reload()
+				})
+				.catch(err => {
+					if (err.error === 'WRONG_URL') {
+						setError(L('Wrong URL', 'ru', 'Неправильный URL'))
+					} else if (err.error === 'TOO_MANY_WEBHOOKS') {
+						setError(L('Too many webhooks', 'ru', 'Слишком много вебхуков'))
+					} else onError(err)
+				})
+				.finally(() => setIsSaving(false))
+		},
+		[reload],
+	)
+
+	const onRemove = useCallback(
+		(/**@type {Webhook}*/ webhook) => {
+			apiReq('DELETE', '/api/user_webhooks', { data: { id: webhook.id } })
+				.then(reload)
+				.catch(onError)
+		},
+		[reload],
+	)
+
+	useEffect(reload, [reload])
+
+	if (!webhooks) return null
+
+	return html`
+		<div class="user-webhooks">
+			<h3>${L('Webhooks', 'ru', 'Вебхуки')}</h3>
+			<p class="dim">
+				${L(
+					'On node state change a JSON POST request is sent to each URL. ',
+					'ru',
+					'При изменении состояния ноды на каждый URL отправляется POST-запрос с JSON. ',
+				)}
+				${L('Request is signed: ', 'ru', 'Запрос подписан: ')}
+				<code>X-Storjnet-Signature: sha256=HMAC_SHA256(secret, timestamp + "." + body)</code>
+				${L(', timestamp is in ', 'ru', ', timestamp передаётся в ')}<code>X-Storjnet-Timestamp</code>.
+			</p>
+			${webhooks.map(w => html`<${WebhookItem} key=${w.id} webhook=${w} onRemove=${onRemove} />`)}
+			<form class="user-webhooks-form ${isSaving ? 'loading' : ''}" onsubmit=${onSubmit}>
+				<input type="url" name="url" placeholder="https://example.com/hook" required />${' '}
+				<button>${L('Add', 'ru', 'Добавить')}</button>
+				${error && html`<div class="warn">${error}</div>`}
+			</form>
+		</div>
+	`
+}
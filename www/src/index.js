@@ -13,8 +13,21 @@ import { PingMyNode } from './components/ping_my_node'
 import { AuthForm } from './components/auth'
 import { SearchNeighbors } from './components/search_neighbors'
 import { CheckSanctions } from './components/check_sanctions'
-import { UserDashboardNodes, UserDashboardPings } from './components/user_dashboard'
+import {
+	UserDashboardNodes,
+	UserDashboardPings,
+	UserDashboardMaintenance,
+	UserDashboardGroups,
+} from './components/user_dashboard'
 import { NodesSubnetSummary } from './components/nodes_subnet_summary'
+import { UserAlerts } from './components/user_alerts'
+import { UserWebhooks } from './components/user_webhooks'
+import { UserAPITokens } from './components/user_api_tokens'
+import { UserUptimeReport } from './components/user_uptime_report'
+import { SharedDashboard } from './components/shared_dashboard'
+import { UserOrgs } from './components/user_orgs'
+import { UserAccount } from './components/user_account'
+import { PasswordResetForm } from './components/password_reset'
 
 renderIfExists(AuthForm, '.auth-forms')
 renderIfExists(RewindControl, '.rewind-control')
@@ -26,5 +39,15 @@ renderIfExists(NodesSubnetSummary, '.nodes-subnet-summary')
 renderIfExists(PingMyNode, '.ping-my-node')
 renderIfExists(SearchNeighbors, '.search-neighbors')
 renderIfExists(CheckSanctions, '.check-sanctions')
+renderIfExists(UserDashboardGroups, '.user-dashboard-groups')
 renderIfExists(UserDashboardNodes, '.user-dashboard-nodes')
 renderIfExists(UserDashboardPings, '.user-dashboard-pings')
+renderIfExists(UserUptimeReport, '.user-dashboard-uptime-report')
+renderIfExists(UserAlerts, '.user-dashboard-alerts')
+renderIfExists(UserWebhooks, '.user-dashboard-webhooks')
+renderIfExists(UserDashboardMaintenance, '.user-dashboard-maintenance')
+renderIfExists(UserOrgs, '.user-dashboard-orgs')
+renderIfExists(UserAPITokens, '.user-dashboard-api-tokens')
+renderIfExists(UserAccount, '.user-dashboard-account')
+renderIfExists(PasswordResetForm, '.password-reset-form')
+renderIfExists(SharedDashboard, '.shared-dashboard-wrap')